@@ -4,13 +4,18 @@ import (
 	"archive/zip"
 	"bytes"
 	"encoding/csv"
+	"errors"
+	"flag"
 	"fmt"
 	"io"
+	"io/fs"
 	"log"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/Paaaark/hanquant/internal/data"
 )
@@ -22,12 +27,33 @@ type marketConfig struct {
 }
 
 func main() {
+	var (
+		snapshotDate = flag.String("date", time.Now().Format("20060102"), "Date of the listing snapshot (YYYYMMDD)")
+		importPath   = flag.String("import", "", "Record an existing listings CSV as the snapshot of -date instead of downloading")
+	)
+	flag.Parse()
+	if _, err := time.Parse("20060102", *snapshotDate); err != nil {
+		log.Fatalf("invalid -date %q: %v", *snapshotDate, err)
+	}
+
 	// Create .kis_data directory if it doesn't exist
 	dataDir := ".kis_data"
 	if err := os.MkdirAll(dataDir, 0755); err != nil {
 		log.Fatalf("create data directory: %v", err)
 	}
 
+	if *importPath != "" {
+		stocks, err := data.LoadStockListings(*importPath)
+		if err != nil {
+			log.Fatalf("load %s: %v", *importPath, err)
+		}
+		if err := recordSnapshot(*snapshotDate, stocks); err != nil {
+			log.Fatalf("record snapshot: %v", err)
+		}
+		fmt.Printf("Recorded %d stocks from %s as the %s listing snapshot\n", len(stocks), *importPath, *snapshotDate)
+		return
+	}
+
 	outPath := filepath.Join(dataDir, "stock_listings.csv")
 
 	// Market configurations with download URLs
@@ -65,12 +91,12 @@ func main() {
 	if err := w.Write([]string{
 		"Code", "ISIN", "Name", "SecurityType",
 		"CapSize", "IndLarge", "IndMedium", "IndSmall",
-		"Market",
+		"Market", "MarketCap",
 	}); err != nil {
 		log.Fatalf("write header: %v", err)
 	}
 
-	var total int
+	var all []data.StockMeta
 	for _, m := range markets {
 		filePath := filepath.Join(dataDir, m.filename)
 		stocks, err := data.ParseStockListingFile(filePath)
@@ -79,18 +105,49 @@ func main() {
 		}
 
 		for _, s := range stocks {
+			s.Market = m.markID
+			all = append(all, s)
 			if err := w.Write([]string{
 				s.Code, s.ISIN, s.Name, s.SecurityType,
 				s.CapSize, s.IndLarge, s.IndMedium, s.IndSmall,
-				m.markID,
+				m.markID, strconv.FormatInt(s.MarketCap, 10),
 			}); err != nil {
 				log.Fatalf("write row: %v", err)
 			}
 		}
-		total += len(stocks)
 	}
 
-	fmt.Printf("Downloaded, parsed %d stocks (KOSPI+KOSDAQ) to %s\n", total, outPath)
+	fmt.Printf("Downloaded, parsed %d stocks (KOSPI+KOSDAQ) to %s\n", len(all), outPath)
+
+	if err := recordSnapshot(*snapshotDate, all); err != nil {
+		log.Fatalf("record snapshot: %v", err)
+	}
+}
+
+// recordSnapshot keeps the listings as the dated snapshot of date and merges them into the
+// listing history, which tracks when each code was first and last seen
+func recordSnapshot(date string, stocks []data.StockMeta) error {
+	snapshotDir := data.ListingSnapshotDir()
+	if err := os.MkdirAll(snapshotDir, 0755); err != nil {
+		return fmt.Errorf("create snapshot directory: %w", err)
+	}
+	snapshotPath := filepath.Join(snapshotDir, date+".csv")
+	if err := data.WriteToCSV(stocks, snapshotPath); err != nil {
+		return err
+	}
+
+	historyPath := data.ListingHistoryPath()
+	history, err := data.LoadListingHistory(historyPath)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	history = data.MergeListingSnapshot(history, date, stocks)
+	if err := data.WriteListingHistory(history, historyPath); err != nil {
+		return err
+	}
+
+	fmt.Printf("Saved snapshot %s and updated %s (%d codes)\n", snapshotPath, historyPath, len(history))
+	return nil
 }
 
 // downloadAndExtract downloads a zip file from URL and extracts the specified file
@@ -15,24 +15,10 @@ import (
 	"github.com/Paaaark/hanquant/internal/service"
 )
 
-// rateLimiter ensures we don't exceed 20 API calls per second across multiple service calls
-type rateLimiter struct {
-	lastCall time.Time
-}
-
-func (rl *rateLimiter) wait() {
-	// Ensure at least 50ms between calls (20 calls per second = 50ms per call)
-	elapsed := time.Since(rl.lastCall)
-	if elapsed < 50*time.Millisecond {
-		time.Sleep(50*time.Millisecond - elapsed)
-	}
-	rl.lastCall = time.Now()
-}
-
 func main() {
 	// Define command line flags
 	var (
-		action     = flag.String("action", "", "Action to perform: fetch-daily, fetch-daily-today, fetch-minute, fetch-minute-today")
+		action     = flag.String("action", "", "Action to perform: fetch-daily, fetch-daily-today, fetch-minute, fetch-minute-today, fetch-actions")
 		symbol     = flag.String("symbol", "", "Stock symbol (e.g., 005930)")
 		fromDate   = flag.String("from", "", "Start date (YYYYMMDD format)")
 		toDate     = flag.String("to", "", "End date (YYYYMMDD format)")
@@ -48,6 +34,7 @@ func main() {
 		fmt.Println("  fetch-daily-today  - Fetch today's daily data for all symbols (efficient)")
 		fmt.Println("  fetch-minute       - Fetch minute data for a single symbol")
 		fmt.Println("  fetch-minute-today - Fetch minute data for a single symbol")
+		fmt.Println("  fetch-actions      - Refetch traded daily prices and record corporate actions")
 		fmt.Println("")
 		fmt.Println("Example usage:")
 		fmt.Println("  ./historical_data -action fetch-daily -to 20241231")
@@ -129,11 +116,57 @@ func main() {
 		}
 		fmt.Println("Successfully completed fetch-all-daily-data-today")
 
+	case "fetch-actions":
+		if *toDate == "" {
+			today := time.Now().Format("20060102")
+			toDate = &today
+		}
+		if *fromDate == "" {
+			toTime, err := time.Parse("20060102", *toDate)
+			if err != nil {
+				log.Fatal("Invalid to date format: ", err)
+			}
+			toTimeStr := toTime.AddDate(-10, 0, 0).Format("20060102")
+			fromDate = &toTimeStr
+		}
+		var err error
+		if *symbol == "" {
+			err = fetchActionsAll(historicalService, *fromDate, *toDate)
+		} else {
+			err = historicalService.RefreshCorporateActions(*symbol, *fromDate, *toDate)
+		}
+		if err != nil {
+			log.Fatalf("Failed to fetch corporate actions: %v", err)
+		}
+		fmt.Println("Successfully completed fetch-actions")
+
 	default:
 		log.Fatalf("Unknown action: %s", *action)
 	}
 }
 
+// fetchActionsAll rebuilds the traded daily prices and corporate action log of every symbol
+func fetchActionsAll(historicalService *service.HistoricalService, fromDate string, toDate string) error {
+	symbols, err := loadStockSymbolsFromCSV()
+	if err != nil {
+		return fmt.Errorf("failed to load stock symbols: %w", err)
+	}
+
+	fmt.Printf("Fetching corporate actions from %s to %s for %d symbols\n", fromDate, toDate, len(symbols))
+
+	errorCount := 0
+	for i, symbol := range symbols {
+		fmt.Printf("Processing symbol %d/%d: %s\n", i+1, len(symbols), symbol)
+		if err := historicalService.RefreshCorporateActions(symbol, fromDate, toDate); err != nil {
+			fmt.Printf("Error fetching corporate actions for %s: %v\n", symbol, err)
+			errorCount++
+		}
+	}
+
+	fmt.Printf("Completed: %d symbols, %d errors\n", len(symbols), errorCount)
+	return nil
+}
+
 // loadStockSymbolsFromCSV reads stock symbols from the stock_listings.csv file
 func loadStockSymbolsFromCSV() ([]string, error) {
 	csvPath := filepath.Join(".kis_data", "stock_listings.csv")
@@ -188,15 +221,10 @@ func fetchDailyAll(historicalService *service.HistoricalService, toDate string,
 
 	fmt.Printf("Fetching 10 years of daily data from %s to %s for %d symbols\n", fromDate, toDate, len(symbols))
 
-	// Create rate limiter for cross-service call rate limiting
-	rateLimiter := &rateLimiter{}
-	
 	successCount := 0
 	errorCount := 0
 
 	for i, symbol := range symbols {
-		rateLimiter.wait()
-		
 		fmt.Printf("Processing symbol %d/%d: %s\n", i+1, len(symbols), symbol)
 		
 		// Use intelligent heuristics to fetch only missing data
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Paaaark/hanquant/internal/data"
+	"github.com/Paaaark/hanquant/internal/service"
+)
+
+// Paper trading runs a backtest strategy on live daily bars with the simulated broker. It reads
+// KIS snapshots after every close and keeps going until interrupted, then prints the result.
+func main() {
+	var (
+		strategy    = flag.String("strategy", "", "Registered strategy name (see /backtest/strategies)")
+		params      = flag.String("params", "", "Strategy parameters, e.g. sma_short=10,sma_long=30")
+		rulesFile   = flag.String("rules", "", "File with a rule set to trade instead of -strategy")
+		tickers     = flag.String("tickers", "", "Comma-separated stock codes; empty uses the service default universe")
+		initialCash = flag.Float64("cash", 0, "Starting capital in KRW; 0 uses the backtest default")
+		fromDate    = flag.String("from", "", "Start of the warm-up history (YYYYMMDD); defaults to a year ago")
+		retry       = flag.Duration("retry", 5*time.Minute, "Wait between attempts to read a session's bars")
+	)
+	flag.Parse()
+
+	backtest := data.BacktestParams{
+		Strategy:    *strategy,
+		From:        *fromDate,
+		InitialCash: *initialCash,
+	}
+	if *params != "" {
+		backtest.StrategyParams = make(map[string]float64)
+		for _, pair := range strings.Split(*params, ",") {
+			name, value, found := strings.Cut(pair, "=")
+			parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+			if !found || err != nil {
+				log.Fatalf("invalid -params entry %q, expected name=value", pair)
+			}
+			backtest.StrategyParams[strings.TrimSpace(name)] = parsed
+		}
+	}
+	if *rulesFile != "" {
+		source, err := os.ReadFile(*rulesFile)
+		if err != nil {
+			log.Fatalf("read rules: %v", err)
+		}
+		backtest.Rules = string(source)
+	}
+	if *tickers != "" {
+		backtest.Universe.Tickers = strings.Split(*tickers, ",")
+	}
+
+	stockService, err := service.NewStockService()
+	if err != nil {
+		log.Fatalf("Failed to initialize stock service: %v", err)
+	}
+	backtestService := service.NewBacktestService(stockService)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	reported := 0
+	log.Println("Paper trading started, waiting for the next close. Press Ctrl+C to stop.")
+	result, err := backtestService.RunPaper(ctx, backtest, *retry, func(snapshot data.PortfolioSnapshot, trades []data.Trade) {
+		for _, trade := range trades[reported:] {
+			fmt.Printf("%s %-4s %s x%d @ %.0f\n", trade.Date, trade.Side, trade.Symbol, trade.Quantity, trade.Price)
+		}
+		reported = len(trades)
+		fmt.Printf("%s total %.0f cash %.0f positions %d\n", snapshot.Date, snapshot.Portfolio.Total, snapshot.Portfolio.Cash, len(snapshot.Portfolio.Positions))
+	})
+	if err != nil {
+		log.Fatalf("Paper trading failed: %v", err)
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(result.Metrics); err != nil {
+		log.Fatalf("encode result: %v", err)
+	}
+}
@@ -19,7 +19,7 @@ func main() {
     // fmt.Println("✅ Access Token acquired.", token)
 
     // Step 2: Fetch daily price for Samsung Electronics (005930)
-    body, err := client.GetDailyPrice("005930", "20240530", "20240630", "D")
+    body, err := client.GetDailyPrice("005930", "20240530", "20240630", "D", false)
     if err != nil {
         log.Fatalf("Failed to get daily price: %v", err)
     }
@@ -10,11 +10,91 @@ type BacktestParams struct {
 	To        string `json:"to"`        // End date in YYYYMMDD format
 	SMA_short int    `json:"sma_short"` // Short SMA window
 	SMA_long  int    `json:"sma_long"`  // Long SMA window
+
+	Strategy       string             `json:"strategy,omitempty"`        // Registered strategy name for /backtest/run
+	StrategyParams map[string]float64 `json:"strategy_params,omitempty"` // Strategy-specific parameters
+	Rules          string             `json:"rules,omitempty"`           // Rule set to trade instead of a registered strategy, e.g. "entry: rsi(14) < 30; exit: rsi(14) > 70"
+
+	Universe    UniverseSpec    `json:"universe"`     // Which stocks to trade
+	InitialCash float64         `json:"initial_cash"` // Starting capital in KRW
+	Sizing      SizingRule      `json:"sizing"`       // How BUY orders are sized
+	Costs       CostModel       `json:"costs"`        // Commission, tax and slippage
+	Execution   ExecutionModel  `json:"execution"`    // How the simulated broker fills orders
+	Settlement  SettlementModel `json:"settlement"`   // When trades settle, buying power, cash interest and margin
+
+	Benchmark    string  `json:"benchmark,omitempty"` // Index to compare against: "KOSPI", "KOSDAQ", "KOSPI200" or an index code
+	RiskFreeRate float64 `json:"risk_free_rate"`      // Annual risk-free rate for Sharpe, Sortino and alpha (0.035 = 3.5%)
+
+	Interval    int  `json:"interval,omitempty"`      // Intraday bar size in minutes (1, 5, 15 or 60) built from S3 minute data; 0 trades daily bars
+	FlatAtClose bool `json:"flat_at_close,omitempty"` // Intraday only: sell every position on the last bar of each session
+
+	Rebalance RebalanceSchedule `json:"rebalance"` // When target-weight strategies trade
+
+	Adjusted bool   `json:"adjusted,omitempty"` // Trade on split/dividend-adjusted prices instead of the traded ones
+	Source   string `json:"source,omitempty"`   // Where bars come from: "store" (default; S3, then KIS) or "csv", the files in BACKTEST_CSV_DIR
+
+	Snapshots string `json:"snapshots,omitempty"` // Which days portfolio_history keeps: "changes" (default, days positions change), "all" or "none"
+}
+
+// RebalanceSchedule picks the trading days, from the KRX trading calendar, on which target-weight
+// strategies rebalance. The first day of the backtest always rebalances.
+type RebalanceSchedule struct {
+	Frequency string `json:"frequency,omitempty"` // "monthly", "quarterly" or "days"; target-weight strategies default to "monthly"
+	Days      int    `json:"days,omitempty"`      // days: rebalance every N trading days
+}
+
+// UniverseSpec selects the stocks a backtest trades. At most one of tickers, sector and top_n
+// may be set; when none is set the service default universe is used.
+type UniverseSpec struct {
+	Tickers []string `json:"tickers,omitempty"` // Explicit stock codes
+	Sector  string   `json:"sector,omitempty"`  // IndLarge code from stock_listings.csv (e.g. "27")
+	TopN    int      `json:"top_n,omitempty"`   // Largest N common stocks by market cap
+
+	Market      string `json:"market,omitempty"`        // "KOSPI" or "KOSDAQ": narrows sector and top_n, or alone selects every common stock of the market
+	PointInTime bool   `json:"point_in_time,omitempty"` // Resolve sector and market from the listing history: every stock listed during the backtest, including delisted ones. Stocks without bars in the range are skipped.
+}
+
+// CostModel describes trading frictions. Nil rates take the service defaults, which are
+// echoed back in the result; set a rate to 0 explicitly to switch that cost off.
+type CostModel struct {
+	CommissionBps *float64 `json:"commission_bps,omitempty"` // Broker commission per side, in basis points
+	KOSPITaxBps   *float64 `json:"kospi_tax_bps,omitempty"`  // Sell tax override for KOSPI; nil follows the KRX schedule of the trade date
+	KOSDAQTaxBps  *float64 `json:"kosdaq_tax_bps,omitempty"` // Sell tax override for KOSDAQ; nil follows the KRX schedule of the trade date
+	Slippage      string   `json:"slippage"`                 // "fixed_bps" or "volume_share"
+	SlippageBps   *float64 `json:"slippage_bps,omitempty"`   // fixed_bps: price concession per fill
+	ImpactBps     *float64 `json:"impact_bps,omitempty"`     // volume_share: price concession per 1% of the bar volume taken
+}
+
+// ExecutionModel configures the simulated broker. Orders are filled on bars after the one
+// that produced them, at KRX tick sizes and within the daily price limit.
+type ExecutionModel struct {
+	MaxVolumeShare *float64 `json:"max_volume_share,omitempty"` // Largest fraction of a bar's volume one order fills per bar; the rest carries over. Nil takes the default, 0 disables the cap.
+}
+
+// SettlementModel follows trades to settlement on the trading calendar. KRX trades settle on
+// D+2, and brokers let the D+2 cash (the deposit after every pending settlement) be spent
+// right away, which is the default. Nil fields take the defaults, echoed back in the result.
+type SettlementModel struct {
+	Days         *int    `json:"days,omitempty"`          // Trading days from a trade to its settlement; nil takes 2, 0 settles at once
+	BuyingPower  string  `json:"buying_power,omitempty"`  // "d2" (default): cash after pending settlements; "settled": only settled cash, sale proceeds wait for settlement
+	InterestRate float64 `json:"interest_rate,omitempty"` // Annual rate paid on settled cash, accrued per calendar day (0.02 = 2%)
+	MarginRatio  float64 `json:"margin_ratio,omitempty"`  // Extra buying power as a fraction of the portfolio total; 0 trades without margin
+	MarginRate   float64 `json:"margin_rate,omitempty"`   // Annual rate charged on negative settled cash, accrued per calendar day
+}
+
+// SizingRule decides the KRW value of a new position
+type SizingRule struct {
+	Method    string  `json:"method"`               // "fixed_fraction", "equal_weight", "vol_target" or "fixed_amount"
+	Fraction  float64 `json:"fraction,omitempty"`   // fixed_fraction: share of portfolio total per position
+	Amount    float64 `json:"amount,omitempty"`     // fixed_amount: KRW per position
+	TargetVol float64 `json:"target_vol,omitempty"` // vol_target: annualized volatility budget per position (e.g. 0.02)
+	VolWindow int     `json:"vol_window,omitempty"` // vol_target: lookback in bars (trading days unless intraday)
 }
 
 // Portfolio represents the current state of the portfolio
 type Portfolio struct {
-	Cash      float64            `json:"cash"`      // Available cash
+	Cash      float64            `json:"cash"`      // Cash once every pending trade has settled (the D+2 deposit)
+	Settled   float64            `json:"settled"`   // Cash that has settled; negative while margin is borrowed
 	Positions map[string]int     `json:"positions"` // Stock code -> quantity
 	Values    map[string]float64 `json:"values"`    // Stock code -> current value
 	Total     float64            `json:"total"`     // Total portfolio value
@@ -22,22 +102,65 @@ type Portfolio struct {
 
 // Trade represents a single trade execution
 type Trade struct {
-	Date      string  `json:"date"`      // Trade date in YYYY-MM-DD format
-	Symbol    string  `json:"symbol"`    // Stock code
-	Side      string  `json:"side"`      // "BUY" or "SELL"
-	Quantity  int     `json:"quantity"`  // Number of shares
-	Price     float64 `json:"price"`     // Execution price
-	Value     float64 `json:"value"`     // Total trade value
-	Portfolio float64 `json:"portfolio"` // Portfolio value after trade
+	Date      string  `json:"date"`           // Trade date in YYYY-MM-DD format
+	Time      string  `json:"time,omitempty"` // Bar time in HH:MM format, intraday runs only
+	Symbol    string  `json:"symbol"`         // Stock code
+	Side      string  `json:"side"`           // "BUY" or "SELL"
+	Quantity  int     `json:"quantity"`       // Number of shares
+	Price     float64 `json:"price"`          // Execution price
+	Value     float64 `json:"value"`          // Total trade value
+	Portfolio float64 `json:"portfolio"`      // Portfolio value after trade
+
+	Commission float64 `json:"commission"` // Broker commission in KRW
+	Tax        float64 `json:"tax"`        // Securities transaction tax in KRW (sells only)
+	Slippage   float64 `json:"slippage"`   // Cost of filling away from the reference price (open, stop or close), in KRW
 }
 
 // BacktestResult contains the complete backtest results
 type BacktestResult struct {
 	Params           BacktestParams         `json:"params"`
-	PortfolioHistory []PortfolioSnapshot    `json:"portfolio_history"`
+	EquityCurve      EquityCurve            `json:"equity_curve"`
+	PortfolioHistory []PortfolioSnapshot    `json:"portfolio_history,omitempty"` // Position snapshots on the days params.Snapshots selects
 	Trades           []Trade                `json:"trades"`
+	RoundTrips       []RoundTrip            `json:"round_trips"`
 	Metrics          BacktestMetrics        `json:"metrics"`
 	Universe         []string               `json:"universe"`
+	Benchmark        *BenchmarkComparison   `json:"benchmark,omitempty"`
+	Orders           []OrderRecord          `json:"orders,omitempty"`
+}
+
+// BenchmarkComparison measures the backtest against a market index over the same days.
+// Returns are in percent; alpha and tracking error are annualized.
+type BenchmarkComparison struct {
+	Code             string           `json:"code"`              // KIS index code (e.g. "0001")
+	Name             string           `json:"name"`              // Index name (e.g. "Kospi")
+	BenchmarkReturn  float64          `json:"benchmark_return"`  // Index return over the backtest, in percent
+	ExcessReturn     float64          `json:"excess_return"`     // Strategy total return minus benchmark return, in percent
+	Alpha            float64          `json:"alpha"`             // Annualized Jensen's alpha, in percent
+	Beta             float64          `json:"beta"`              // Sensitivity of daily strategy returns to the index
+	Correlation      float64          `json:"correlation"`       // Correlation of daily returns
+	TrackingError    float64          `json:"tracking_error"`    // Annualized stddev of daily excess returns, in percent
+	InformationRatio float64          `json:"information_ratio"` // Annualized mean excess return over tracking error
+	Curve            []BenchmarkPoint `json:"curve"`             // Cumulative returns aligned with PortfolioHistory
+}
+
+// BenchmarkPoint is one day of the excess-return curve
+type BenchmarkPoint struct {
+	Date            string  `json:"date"`             // YYYY-MM-DD, same as the portfolio snapshot
+	IndexValue      float64 `json:"index_value"`      // Index close, carried forward on days the index did not print
+	StrategyReturn  float64 `json:"strategy_return"`  // Cumulative strategy return, in percent
+	BenchmarkReturn float64 `json:"benchmark_return"` // Cumulative index return, in percent
+	ExcessReturn    float64 `json:"excess_return"`    // StrategyReturn - BenchmarkReturn
+}
+
+// EquityCurve is the daily portfolio in columns: element i of every array belongs to Dates[i].
+// Amounts are in KRW and the drawdown from the running peak is in percent.
+type EquityCurve struct {
+	Dates    []string  `json:"dates"` // YYYY-MM-DD
+	Total    []float64 `json:"total"`
+	Cash     []float64 `json:"cash"`
+	Invested []float64 `json:"invested"` // Market value of positions
+	Drawdown []float64 `json:"drawdown"`
 }
 
 // PortfolioSnapshot represents portfolio state at a specific date
@@ -53,8 +176,40 @@ type BacktestMetrics struct {
 	SharpeRatio    float64 `json:"sharpe_ratio"`    // Sharpe ratio
 	MaxDrawdown    float64 `json:"max_drawdown"`    // Maximum drawdown
 	TotalTrades    int     `json:"total_trades"`    // Total number of trades
-	WinRate        float64 `json:"win_rate"`        // Percentage of profitable trades
-	AvgTradeReturn float64 `json:"avg_trade_return"` // Average return per trade
+	WinRate        float64 `json:"win_rate"`        // Percentage of profitable round trips
+	AvgTradeReturn float64 `json:"avg_trade_return"` // Average return per round trip, in percent
+
+	GrossReturn     float64 `json:"gross_return"`     // Total return percentage before costs
+	TotalCommission float64 `json:"total_commission"` // Sum of commissions in KRW
+	TotalTax        float64 `json:"total_tax"`        // Sum of transaction taxes in KRW
+	TotalSlippage   float64 `json:"total_slippage"`   // Sum of slippage in KRW
+	TotalCosts      float64 `json:"total_costs"`      // Commission + tax + slippage in KRW
+
+	InterestIncome float64 `json:"interest_income"` // Interest earned on settled cash in KRW
+	MarginInterest float64 `json:"margin_interest"` // Interest paid on margin loans in KRW
+
+	RoundTripCount int     `json:"round_trip_count"` // Number of closed round trips
+	ProfitFactor   float64 `json:"profit_factor"`    // Gross profit / gross loss of round trips; 0 when no round trip lost
+	AvgWin         float64 `json:"avg_win"`          // Average P&L of winning round trips in KRW
+	AvgLoss        float64 `json:"avg_loss"`         // Average P&L of losing round trips in KRW (negative)
+	Expectancy     float64 `json:"expectancy"`       // Average P&L per round trip in KRW
+	AvgHoldingDays float64 `json:"avg_holding_days"` // Average calendar days between entry and exit
+
+	Risk RiskMetrics `json:"risk"` // CAGR, volatility, Sortino, Calmar, VaR/CVaR, drawdown durations and period returns
+}
+
+// RoundTrip is a closed position matched FIFO from an entry fill to an exit fill.
+// P&L and return are net of commission and tax on both legs.
+type RoundTrip struct {
+	Symbol      string  `json:"symbol"`
+	EntryDate   string  `json:"entry_date"`   // YYYY-MM-DD
+	ExitDate    string  `json:"exit_date"`    // YYYY-MM-DD
+	EntryPrice  float64 `json:"entry_price"`  // Fill price of the entry
+	ExitPrice   float64 `json:"exit_price"`   // Fill price of the exit
+	Quantity    int     `json:"quantity"`     // Shares matched between the two fills
+	HoldingDays int     `json:"holding_days"` // Calendar days held
+	PnL         float64 `json:"pnl"`          // Net profit/loss in KRW
+	Return      float64 `json:"return"`       // Net return on the entry cost, in percent
 }
 
 // StockData represents historical stock data for backtesting
@@ -81,3 +236,250 @@ type SMACalculation struct {
 	LongSMA  []float64 `json:"long_sma"`
 	Dates    []string  `json:"dates"`
 }
+
+// MarketDay holds the bars of every universe symbol that traded on a single day. In intraday
+// runs it holds one bar interval instead, and Date carries the bar's start time.
+type MarketDay struct {
+	Date       time.Time   `json:"date"`
+	Bars       []StockData `json:"bars"`        // In universe order
+	SessionEnd bool        `json:"session_end"` // Last step of its trading session; always true for daily bars
+	Rebalance  bool        `json:"rebalance"`   // First step of a scheduled rebalance day, see BacktestParams.Rebalance
+
+	index map[string]int // symbol -> position in Bars, see IndexBars
+}
+
+// IndexBars lets Bar find symbols in constant time. Call it once Bars is complete; copies of
+// the day share the index.
+func (d *MarketDay) IndexBars() {
+	d.index = make(map[string]int, len(d.Bars))
+	for i, bar := range d.Bars {
+		if _, exists := d.index[bar.Symbol]; !exists {
+			d.index[bar.Symbol] = i
+		}
+	}
+}
+
+// Bar returns the bar of the given symbol for this day. Days without an index are scanned.
+func (d MarketDay) Bar(symbol string) (StockData, bool) {
+	if d.index != nil {
+		i, exists := d.index[symbol]
+		if !exists {
+			return StockData{}, false
+		}
+		return d.Bars[i], true
+	}
+	for _, bar := range d.Bars {
+		if bar.Symbol == symbol {
+			return bar, true
+		}
+	}
+	return StockData{}, false
+}
+
+// StrategyOrder is an order emitted by a strategy. The simulated broker fills it on later bars;
+// unless Quantity is set, the sizing rule decides how much to buy and a sell closes the position.
+type StrategyOrder struct {
+	Symbol      string  `json:"symbol"`
+	Side        string  `json:"side"`                    // "BUY" or "SELL"
+	Type        string  `json:"type,omitempty"`          // "market" (default), "limit", "stop" or "stop_limit"
+	LimitPrice  float64 `json:"limit_price,omitempty"`   // limit and stop_limit: worst acceptable price
+	StopPrice   float64 `json:"stop_price,omitempty"`    // stop and stop_limit: price that triggers the order
+	Quantity    int     `json:"quantity,omitempty"`      // Shares; 0 lets the engine decide
+	TimeInForce string  `json:"time_in_force,omitempty"` // "day" (default) expires after the session it first works in; "gtc" works until the run ends
+}
+
+// Order statuses of OrderRecord
+const (
+	OrderFilled          = "FILLED"
+	OrderPartiallyFilled = "PARTIALLY_FILLED" // Some shares filled before it expired or the run ended
+	OrderExpired         = "EXPIRED"
+	OrderRejected        = "REJECTED"
+	OrderOpen            = "OPEN" // Still working when the run ended
+)
+
+// OrderRecord is the outcome of one order submitted to the simulated broker
+type OrderRecord struct {
+	ID            int    `json:"id"`
+	SubmittedDate string `json:"submitted_date"`           // YYYY-MM-DD of the bar that produced the order
+	SubmittedTime string `json:"submitted_time,omitempty"` // HH:MM, intraday runs only
+	StrategyOrder
+	FilledQuantity int     `json:"filled_quantity"`
+	AvgFillPrice   float64 `json:"avg_fill_price,omitempty"`
+	Status         string  `json:"status"`
+	Reason         string  `json:"reason,omitempty"` // Why it was rejected, or why it last failed to fill
+}
+
+// StrategyParamSpec describes one tunable parameter of a strategy
+type StrategyParamSpec struct {
+	Name        string  `json:"name"`
+	Type        string  `json:"type"` // "int" or "float"
+	Default     float64 `json:"default"`
+	Min         float64 `json:"min"`
+	Max         float64 `json:"max,omitempty"` // 0 means unbounded
+	Description string  `json:"description"`
+}
+
+// StrategyInfo describes a registered strategy and its parameter schema
+type StrategyInfo struct {
+	Name        string              `json:"name"`
+	Description string              `json:"description"`
+	Params      []StrategyParamSpec `json:"params"`
+	Rebalances  bool                `json:"rebalances"` // Target-weight strategy traded on the rebalance schedule
+}
+
+// OptimizeParams describes a grid search: the base backtest plus the strategy parameters to sweep.
+// Every combination of the grid values is run with the other fields of BacktestParams unchanged.
+type OptimizeParams struct {
+	BacktestParams
+	Grid    []ParamRange `json:"grid"`              // Strategy parameters to sweep
+	RankBy  string       `json:"rank_by,omitempty"` // Metric to rank by: "sharpe" (default), "cagr", "total_return", "sortino", "calmar", "max_drawdown", "win_rate", "profit_factor"
+	Workers int          `json:"workers,omitempty"` // Parallel runs, defaults to the number of CPUs
+}
+
+// ParamRange lists the values of one strategy parameter, either explicitly or as min..max by step
+type ParamRange struct {
+	Name   string    `json:"name"`
+	Values []float64 `json:"values,omitempty"`
+	Min    float64   `json:"min,omitempty"`
+	Max    float64   `json:"max,omitempty"`
+	Step   float64   `json:"step,omitempty"`
+}
+
+// OptimizeResult is the ranked outcome of a grid search
+type OptimizeResult struct {
+	Params   OptimizeParams `json:"params"`
+	Universe []string       `json:"universe"`
+	RankBy   string         `json:"rank_by"`
+	Runs     []OptimizeRun  `json:"runs"`              // Best first; failed combinations last
+	Heatmap  *Heatmap       `json:"heatmap,omitempty"` // Set when exactly two parameters are swept
+}
+
+// OptimizeRun is one row of the ranked table
+type OptimizeRun struct {
+	Rank           int                `json:"rank"`            // 1 is best; 0 for failed combinations
+	StrategyParams map[string]float64 `json:"strategy_params"` // Resolved parameters of this run
+	Score          float64            `json:"score"`           // Value of the ranking metric
+	Metrics        BacktestMetrics    `json:"metrics"`         // Period return tables are omitted
+	Error          string             `json:"error,omitempty"` // Why the combination could not run
+}
+
+// Heatmap arranges the ranking metric of a two-parameter sweep as Values[y][x].
+// Cells of failed combinations are null.
+type Heatmap struct {
+	XParam string       `json:"x_param"`
+	YParam string       `json:"y_param"`
+	X      []float64    `json:"x"`
+	Y      []float64    `json:"y"`
+	Values [][]*float64 `json:"values"`
+}
+
+// CompareParams runs several strategies over the same universe, dates and settings. The
+// strategy fields of the embedded BacktestParams are ignored.
+type CompareParams struct {
+	BacktestParams
+	Strategies []CompareStrategy `json:"strategies"`
+}
+
+// CompareStrategy is one strategy configuration of a comparison
+type CompareStrategy struct {
+	Label          string             `json:"label,omitempty"` // Defaults to the strategy name with its parameters, e.g. "sma_crossover(sma_long=50,sma_short=20)"
+	Strategy       string             `json:"strategy"`
+	StrategyParams map[string]float64 `json:"strategy_params,omitempty"`
+	Rules          string             `json:"rules,omitempty"` // Rule set run in place of strategy
+}
+
+// CompareResult lines the strategies up over the same trading days
+type CompareResult struct {
+	Params      CompareParams `json:"params"`
+	Universe    []string      `json:"universe"`
+	Dates       []string      `json:"dates"`       // YYYY-MM-DD, shared by the equity curve of every run
+	Runs        []CompareRun  `json:"runs"`        // In request order
+	Correlation [][]*float64  `json:"correlation"` // Correlation of daily returns between runs, in run order; null where a run failed or is flat
+}
+
+// CompareRun is one strategy's equity curve and metrics
+type CompareRun struct {
+	Label          string             `json:"label"`
+	Strategy       string             `json:"strategy"`
+	StrategyParams map[string]float64 `json:"strategy_params"`  // Resolved parameters
+	Equity         []float64          `json:"equity,omitempty"` // Portfolio total on each of CompareResult.Dates
+	Metrics        BacktestMetrics    `json:"metrics"`          // Period return tables are omitted
+	Error          string             `json:"error,omitempty"`  // Why the strategy could not run
+}
+
+// WalkForwardParams splits [From, To] into in-sample windows, where the grid is optimized,
+// each followed by an out-of-sample window that trades the winning parameters
+type WalkForwardParams struct {
+	OptimizeParams
+	Mode          string `json:"mode"`            // "rolling" (fixed-length in-sample) or "anchored" (in-sample grows from From)
+	InSampleDays  int    `json:"in_sample_days"`  // Trading days per in-sample window
+	OutSampleDays int    `json:"out_sample_days"` // Trading days per out-of-sample window
+}
+
+// WalkForwardResult stitches the out-of-sample windows into one equity curve
+type WalkForwardResult struct {
+	Params           WalkForwardParams    `json:"params"`
+	Universe         []string             `json:"universe"`
+	Folds            []WalkForwardFold    `json:"folds"`
+	EquityCurve      EquityCurve          `json:"equity_curve"`                // Out-of-sample days only
+	PortfolioHistory []PortfolioSnapshot  `json:"portfolio_history,omitempty"` // Out-of-sample position snapshots on the days params.Snapshots selects
+	Trades           []Trade              `json:"trades"`            // Out-of-sample trades only
+	RoundTrips       []RoundTrip          `json:"round_trips"`
+	Metrics          BacktestMetrics      `json:"metrics"`
+	Benchmark        *BenchmarkComparison `json:"benchmark,omitempty"`
+}
+
+// WalkForwardFold is one in-sample/out-of-sample pair. Dates are YYYYMMDD and inclusive.
+type WalkForwardFold struct {
+	Fold             int                `json:"fold"`
+	InSampleFrom     string             `json:"in_sample_from"`
+	InSampleTo       string             `json:"in_sample_to"`
+	OutSampleFrom    string             `json:"out_sample_from"`
+	OutSampleTo      string             `json:"out_sample_to"`
+	StrategyParams   map[string]float64 `json:"strategy_params"`   // Best in-sample parameters
+	InSampleScore    float64            `json:"in_sample_score"`   // Ranking metric of the best in-sample run
+	InSampleMetrics  BacktestMetrics    `json:"in_sample_metrics"` // Period return tables are omitted
+	OutSampleMetrics BacktestMetrics    `json:"out_sample_metrics"`
+	Error            string             `json:"error,omitempty"` // Set when no grid combination could run in-sample
+}
+
+// RobustnessParams configures a Monte Carlo analysis of a finished backtest
+type RobustnessParams struct {
+	Method      string `json:"method"`               // "bootstrap" resamples daily returns (default), "trade_shuffle" reorders round trips
+	Simulations int    `json:"simulations"`          // Number of resampled paths, default 1000
+	Seed        int64  `json:"seed"`                 // Random seed; the same seed always gives the same result
+	BlockSize   int    `json:"block_size,omitempty"` // bootstrap: days per resampled block, 1 (default) draws days independently
+}
+
+// RobustnessResult holds the distributions of the simulated paths
+type RobustnessResult struct {
+	Params            RobustnessParams `json:"params"`              // With defaults applied
+	Samples           int              `json:"samples"`             // Daily returns or round trips in each path
+	FinalReturn       Distribution     `json:"final_return"`        // Total return in percent
+	MaxDrawdown       Distribution     `json:"max_drawdown"`        // Deepest decline in percent
+	Sharpe            Distribution     `json:"sharpe"`              // Annualized Sharpe ratio
+	ProbabilityOfLoss float64          `json:"probability_of_loss"` // Share of paths ending below where they started
+}
+
+// Distribution summarizes one statistic over the simulated paths, next to the backtest's own value
+type Distribution struct {
+	Observed     float64 `json:"observed"`      // Value of the actual backtest
+	ObservedRank float64 `json:"observed_rank"` // Share of paths below the observed value
+	Mean         float64 `json:"mean"`
+	StdDev       float64 `json:"std_dev"`
+	Min          float64 `json:"min"`
+	P5           float64 `json:"p5"`
+	P25          float64 `json:"p25"`
+	P50          float64 `json:"p50"`
+	P75          float64 `json:"p75"`
+	P95          float64 `json:"p95"`
+	Max          float64 `json:"max"`
+}
+
+// RobustnessAnalysis is a robustness result stored with its backtest job in backtest_robustness
+type RobustnessAnalysis struct {
+	ID        int64     `json:"id"`
+	JobID     int64     `json:"job_id"`
+	CreatedAt time.Time `json:"created_at"`
+	RobustnessResult
+}
@@ -2,8 +2,10 @@ package data
 
 import (
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"os"
+	"time"
 
 	"github.com/lib/pq"
 	_ "github.com/lib/pq"
@@ -93,6 +95,57 @@ func MigrateDB(db *sql.DB) error {
 		kis_order_id VARCHAR(64),
 		created_at TIMESTAMP DEFAULT NOW()
 	);
+
+	CREATE TABLE IF NOT EXISTS backtest_jobs (
+		id BIGSERIAL PRIMARY KEY,
+		user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		status VARCHAR(12) NOT NULL DEFAULT 'QUEUED' CHECK (status IN ('QUEUED','RUNNING','DONE','FAILED','CANCELLED')),
+		progress DOUBLE PRECISION NOT NULL DEFAULT 0,
+		params JSONB NOT NULL,
+		metrics JSONB,
+		universe JSONB,
+		benchmark JSONB,
+		error TEXT,
+		created_at TIMESTAMP DEFAULT NOW(),
+		started_at TIMESTAMP,
+		finished_at TIMESTAMP
+	);
+	CREATE INDEX IF NOT EXISTS backtest_jobs_user_id_idx ON backtest_jobs (user_id, created_at DESC);
+
+	CREATE TABLE IF NOT EXISTS backtest_trades (
+		id BIGSERIAL PRIMARY KEY,
+		job_id BIGINT NOT NULL REFERENCES backtest_jobs(id) ON DELETE CASCADE,
+		trade_date DATE NOT NULL,
+		symbol VARCHAR(12) NOT NULL,
+		side VARCHAR(4) CHECK (side IN ('BUY','SELL')),
+		quantity BIGINT NOT NULL,
+		price NUMERIC(18,4) NOT NULL,
+		value NUMERIC(20,2) NOT NULL,
+		portfolio NUMERIC(20,2) NOT NULL,
+		commission NUMERIC(18,2) NOT NULL DEFAULT 0,
+		tax NUMERIC(18,2) NOT NULL DEFAULT 0,
+		slippage NUMERIC(18,2) NOT NULL DEFAULT 0
+	);
+	CREATE INDEX IF NOT EXISTS backtest_trades_job_id_idx ON backtest_trades (job_id);
+	ALTER TABLE backtest_trades ADD COLUMN IF NOT EXISTS trade_time VARCHAR(5) NOT NULL DEFAULT '';
+
+	CREATE TABLE IF NOT EXISTS backtest_equity (
+		job_id BIGINT NOT NULL REFERENCES backtest_jobs(id) ON DELETE CASCADE,
+		date DATE NOT NULL,
+		cash NUMERIC(20,2) NOT NULL,
+		total NUMERIC(20,2) NOT NULL,
+		positions JSONB NOT NULL,
+		PRIMARY KEY (job_id, date)
+	);
+
+	CREATE TABLE IF NOT EXISTS backtest_robustness (
+		id BIGSERIAL PRIMARY KEY,
+		job_id BIGINT NOT NULL REFERENCES backtest_jobs(id) ON DELETE CASCADE,
+		params JSONB NOT NULL,
+		result JSONB NOT NULL,
+		created_at TIMESTAMP DEFAULT NOW()
+	);
+	CREATE INDEX IF NOT EXISTS backtest_robustness_job_id_idx ON backtest_robustness (job_id, created_at DESC);
 	`)
 	return err
 }
@@ -193,4 +246,298 @@ func ListOrdersByAccountID(db *sql.DB, userID, userAccountID int64) ([]Order, er
 		orders = append(orders, o)
 	}
 	return orders, nil
-} 
\ No newline at end of file
+}
+
+// Backtest Jobs
+const backtestJobColumns = `id, user_id, status, progress, params, metrics, universe, benchmark, COALESCE(error, ''), created_at, started_at, finished_at`
+
+func CreateBacktestJob(db *sql.DB, job *BacktestJob) error {
+	params, err := json.Marshal(job.Params)
+	if err != nil {
+		return err
+	}
+	job.Status = BacktestJobQueued
+	query := `INSERT INTO backtest_jobs (user_id, status, params) VALUES ($1, $2, $3) RETURNING id, created_at`
+	return db.QueryRow(query, job.UserID, job.Status, string(params)).Scan(&job.ID, &job.CreatedAt)
+}
+
+// ClaimBacktestJob moves a queued job to RUNNING. It returns false if the job is no longer queued.
+func ClaimBacktestJob(db *sql.DB, jobID int64) (bool, error) {
+	res, err := db.Exec(`UPDATE backtest_jobs SET status = $2, started_at = NOW() WHERE id = $1 AND status = $3`, jobID, BacktestJobRunning, BacktestJobQueued)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+func UpdateBacktestJobProgress(db *sql.DB, jobID int64, progress float64) error {
+	_, err := db.Exec(`UPDATE backtest_jobs SET progress = $2 WHERE id = $1 AND status = $3`, jobID, progress, BacktestJobRunning)
+	return err
+}
+
+// SetBacktestJobStatus finishes a job without a result (FAILED or CANCELLED)
+func SetBacktestJobStatus(db *sql.DB, jobID int64, status, message string) error {
+	_, err := db.Exec(`UPDATE backtest_jobs SET status = $2, error = NULLIF($3, ''), finished_at = NOW() WHERE id = $1`, jobID, status, message)
+	return err
+}
+
+// CancelQueuedBacktestJob cancels a job that has not started. It returns false if the job is not queued.
+func CancelQueuedBacktestJob(db *sql.DB, userID, jobID int64) (bool, error) {
+	res, err := db.Exec(`UPDATE backtest_jobs SET status = $3, finished_at = NOW() WHERE id = $1 AND user_id = $2 AND status = $4`, jobID, userID, BacktestJobCancelled, BacktestJobQueued)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+// SaveBacktestResult stores the metrics, trades and equity curve of a job and marks it DONE.
+// The job params are replaced by those of the result, with the run's defaults filled in.
+func SaveBacktestResult(db *sql.DB, jobID int64, result *BacktestResult) error {
+	params, err := json.Marshal(result.Params)
+	if err != nil {
+		return err
+	}
+	metrics, err := json.Marshal(result.Metrics)
+	if err != nil {
+		return err
+	}
+	universe, err := json.Marshal(result.Universe)
+	if err != nil {
+		return err
+	}
+	// JSONB values are passed as strings; lib/pq would send []byte as bytea
+	var benchmark interface{}
+	if result.Benchmark != nil {
+		raw, err := json.Marshal(result.Benchmark)
+		if err != nil {
+			return err
+		}
+		benchmark = string(raw)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	tradeStmt, err := tx.Prepare(pq.CopyIn("backtest_trades", "job_id", "trade_date", "trade_time", "symbol", "side", "quantity", "price", "value", "portfolio", "commission", "tax", "slippage"))
+	if err != nil {
+		return err
+	}
+	for _, t := range result.Trades {
+		if _, err := tradeStmt.Exec(jobID, t.Date, t.Time, t.Symbol, t.Side, t.Quantity, t.Price, t.Value, t.Portfolio, t.Commission, t.Tax, t.Slippage); err != nil {
+			return err
+		}
+	}
+	if _, err := tradeStmt.Exec(); err != nil {
+		return err
+	}
+	if err := tradeStmt.Close(); err != nil {
+		return err
+	}
+
+	equityStmt, err := tx.Prepare(pq.CopyIn("backtest_equity", "job_id", "date", "cash", "total", "positions"))
+	if err != nil {
+		return err
+	}
+	for _, snapshot := range result.PortfolioHistory {
+		positions, err := json.Marshal(snapshot.Portfolio.Positions)
+		if err != nil {
+			return err
+		}
+		if _, err := equityStmt.Exec(jobID, snapshot.Date, snapshot.Portfolio.Cash, snapshot.Portfolio.Total, string(positions)); err != nil {
+			return err
+		}
+	}
+	if _, err := equityStmt.Exec(); err != nil {
+		return err
+	}
+	if err := equityStmt.Close(); err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`UPDATE backtest_jobs SET status = $2, progress = 1, params = $3, metrics = $4, universe = $5, benchmark = $6, finished_at = NOW() WHERE id = $1`,
+		jobID, BacktestJobDone, string(params), string(metrics), string(universe), benchmark)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetBacktestJob returns a job of the user with its trades and equity curve, or nil if it does not exist
+func GetBacktestJob(db *sql.DB, userID, jobID int64) (*BacktestJob, error) {
+	row := db.QueryRow(`SELECT `+backtestJobColumns+` FROM backtest_jobs WHERE id = $1 AND user_id = $2`, jobID, userID)
+	job, err := scanBacktestJob(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if job.Status != BacktestJobDone {
+		return job, nil
+	}
+
+	rows, err := db.Query(`SELECT trade_date, trade_time, symbol, side, quantity, price, value, portfolio, commission, tax, slippage FROM backtest_trades WHERE job_id = $1 ORDER BY id`, jobID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var t Trade
+		var date time.Time
+		if err := rows.Scan(&date, &t.Time, &t.Symbol, &t.Side, &t.Quantity, &t.Price, &t.Value, &t.Portfolio, &t.Commission, &t.Tax, &t.Slippage); err != nil {
+			return nil, err
+		}
+		t.Date = date.Format("2006-01-02")
+		job.Trades = append(job.Trades, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	equity, err := db.Query(`SELECT date, cash, total, positions FROM backtest_equity WHERE job_id = $1 ORDER BY date`, jobID)
+	if err != nil {
+		return nil, err
+	}
+	defer equity.Close()
+	for equity.Next() {
+		var snapshot PortfolioSnapshot
+		var date time.Time
+		var positions []byte
+		if err := equity.Scan(&date, &snapshot.Portfolio.Cash, &snapshot.Portfolio.Total, &positions); err != nil {
+			return nil, err
+		}
+		snapshot.Date = date.Format("2006-01-02")
+		if err := json.Unmarshal(positions, &snapshot.Portfolio.Positions); err != nil {
+			return nil, err
+		}
+		job.PortfolioHistory = append(job.PortfolioHistory, snapshot)
+	}
+	return job, equity.Err()
+}
+
+// ListBacktestJobsByUserID returns the user's most recent jobs without trades or equity curves
+func ListBacktestJobsByUserID(db *sql.DB, userID int64, limit int) ([]BacktestJob, error) {
+	rows, err := db.Query(`SELECT `+backtestJobColumns+` FROM backtest_jobs WHERE user_id = $1 ORDER BY created_at DESC, id DESC LIMIT $2`, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var jobs []BacktestJob
+	for rows.Next() {
+		job, err := scanBacktestJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, *job)
+	}
+	return jobs, rows.Err()
+}
+
+// ListBacktestJobIDsByStatus returns the IDs of all jobs in the given status, oldest first
+func ListBacktestJobIDsByStatus(db *sql.DB, status string) ([]int64, error) {
+	rows, err := db.Query(`SELECT id FROM backtest_jobs WHERE status = $1 ORDER BY id`, status)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// GetBacktestJobParams loads the parameters of a job for the worker that runs it
+func GetBacktestJobParams(db *sql.DB, jobID int64) (*BacktestParams, error) {
+	var raw []byte
+	if err := db.QueryRow(`SELECT params FROM backtest_jobs WHERE id = $1`, jobID).Scan(&raw); err != nil {
+		return nil, err
+	}
+	var params BacktestParams
+	if err := json.Unmarshal(raw, &params); err != nil {
+		return nil, err
+	}
+	return &params, nil
+}
+
+// CreateBacktestRobustness stores a robustness analysis of a job. The params are kept in their
+// own column as well so analyses can be told apart without decoding the result.
+func CreateBacktestRobustness(db *sql.DB, analysis *RobustnessAnalysis) error {
+	params, err := json.Marshal(analysis.Params)
+	if err != nil {
+		return err
+	}
+	result, err := json.Marshal(analysis.RobustnessResult)
+	if err != nil {
+		return err
+	}
+	query := `INSERT INTO backtest_robustness (job_id, params, result) VALUES ($1, $2, $3) RETURNING id, created_at`
+	return db.QueryRow(query, analysis.JobID, string(params), string(result)).Scan(&analysis.ID, &analysis.CreatedAt)
+}
+
+// ListBacktestRobustness returns the robustness analyses of a job, newest first
+func ListBacktestRobustness(db *sql.DB, jobID int64) ([]RobustnessAnalysis, error) {
+	rows, err := db.Query(`SELECT id, job_id, result, created_at FROM backtest_robustness WHERE job_id = $1 ORDER BY created_at DESC, id DESC`, jobID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var analyses []RobustnessAnalysis
+	for rows.Next() {
+		var analysis RobustnessAnalysis
+		var result []byte
+		if err := rows.Scan(&analysis.ID, &analysis.JobID, &result, &analysis.CreatedAt); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(result, &analysis.RobustnessResult); err != nil {
+			return nil, err
+		}
+		analyses = append(analyses, analysis)
+	}
+	return analyses, rows.Err()
+}
+
+func scanBacktestJob(row interface{ Scan(...interface{}) error }) (*BacktestJob, error) {
+	var job BacktestJob
+	var params, metrics, universe, benchmark []byte
+	var startedAt, finishedAt sql.NullTime
+	if err := row.Scan(&job.ID, &job.UserID, &job.Status, &job.Progress, &params, &metrics, &universe, &benchmark, &job.Error, &job.CreatedAt, &startedAt, &finishedAt); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(params, &job.Params); err != nil {
+		return nil, err
+	}
+	if metrics != nil {
+		job.Metrics = &BacktestMetrics{}
+		if err := json.Unmarshal(metrics, job.Metrics); err != nil {
+			return nil, err
+		}
+	}
+	if universe != nil {
+		if err := json.Unmarshal(universe, &job.Universe); err != nil {
+			return nil, err
+		}
+	}
+	if benchmark != nil {
+		job.Benchmark = &BenchmarkComparison{}
+		if err := json.Unmarshal(benchmark, job.Benchmark); err != nil {
+			return nil, err
+		}
+	}
+	if startedAt.Valid {
+		job.StartedAt = &startedAt.Time
+	}
+	if finishedAt.Valid {
+		job.FinishedAt = &finishedAt.Time
+	}
+	return &job, nil
+}
@@ -0,0 +1,27 @@
+package data
+
+// IndicatorResult holds indicator series for one symbol, aligned with Dates. Values that
+// are still warming up at the start of the range are null.
+type IndicatorResult struct {
+	Symbol     string            `json:"symbol"`
+	From       string            `json:"from"`  // YYYYMMDD
+	To         string            `json:"to"`    // YYYYMMDD
+	Dates      []string          `json:"dates"` // YYYYMMDD of each bar, oldest first
+	Close      []float64         `json:"close"`
+	Indicators []IndicatorSeries `json:"indicators"`
+}
+
+// IndicatorSeries is the output of one requested indicator spec
+type IndicatorSeries struct {
+	Spec     string                `json:"spec"`     // As requested, e.g. "bbands:20:2"
+	Key      string                `json:"key"`      // Canonical name with defaults filled in, e.g. "bbands_20_2"
+	Lookback int                   `json:"lookback"` // Bars needed before every output is defined
+	Outputs  map[string][]*float64 `json:"outputs"`  // Output name (e.g. "upper") to values aligned with Dates
+}
+
+// LiveIndicators is the latest value of the indicators a WebSocket client streams for one stock
+type LiveIndicators struct {
+	Code   string                         `json:"code"`
+	Price  float64                        `json:"price"`
+	Values map[string]map[string]*float64 `json:"values"` // Spec key (e.g. "rsi_14") to output name to value, null while warming up
+}
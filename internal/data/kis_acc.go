@@ -5,7 +5,6 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/url"
-	"os"
 	"strings"
 )
 
@@ -70,12 +69,8 @@ func (c *KISClient) GetAccountPortfolio(accNo string, mock bool) (SlicePortfolio
 	}
 
 	//-----------------------------------------------------------------
-	// 3.  Ensure we have an access-token (same pattern as kis_stock.go)
-	//-----------------------------------------------------------------
-	c.AccessToken = os.Getenv(KIS_ACCESS_TOKEN)
-
-	//-----------------------------------------------------------------
-	// 4.  Pagination loop until CTX_AREA_NK100 == ""
+	// 3.  Pagination loop until CTX_AREA_NK100 == ""
+	//     (c.get fetches and refreshes the access-token for the host)
 	//-----------------------------------------------------------------
 	var (
 		allPositions SlicePortfolioPosition
@@ -83,22 +78,10 @@ func (c *KISClient) GetAccountPortfolio(accNo string, mock bool) (SlicePortfolio
 		pageCount    int
 	)
 
-	var didRetry bool
-
 	// Cap at 3 pages to avoid exceeding API limits, even if tr_cont indicates more data.
 	for pageCount = 0; pageCount < 1; pageCount++ {
 		respBody, err := c.get(endpoint, trID, params)
 		if err != nil {
-			// If token expired, try to refresh and retry ONCE
-			if !didRetry && strings.Contains(err.Error(), "기간이 만료된 token 입니다.") {
-				newToken, refreshErr := RefreshKISToken(c.AppKey, c.AppSecret)
-				if refreshErr == nil {
-					c.AccessToken = newToken
-					didRetry = true
-					pageCount-- // retry this page
-					continue
-				}
-			}
 			return nil, nil, err
 		}
 		defer respBody.Close()
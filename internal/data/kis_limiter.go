@@ -0,0 +1,154 @@
+package data
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// KIS allows 20 calls a second per app key on the real host and 2 on the mock host
+const (
+	defaultKISRateLimit     = 20.0
+	defaultKISMockRateLimit = 2.0
+)
+
+// KISPriority is the lane a KIS call waits in. A call only takes a free slot when no call of a
+// higher priority is waiting for the same limiter.
+type KISPriority int
+
+const (
+	PriorityInteractive KISPriority = iota // a user is waiting on the response
+	PriorityStreaming                      // polling that feeds live subscribers
+	PriorityBulk                           // background fetches of history
+	kisPriorities
+)
+
+// kisLimiter is a token bucket shared by every call made with one app key to one host
+type kisLimiter struct {
+	mu      sync.Mutex
+	rate    float64 // tokens per second
+	burst   float64 // most tokens that can build up while idle
+	tokens  float64
+	last    time.Time
+	waiting [kisPriorities]int
+}
+
+func newKISLimiter(rate float64) *kisLimiter {
+	return &kisLimiter{rate: rate, burst: 1, tokens: 1, last: time.Now()}
+}
+
+// wait blocks until the call may go out, or returns the context error once ctx is done
+func (l *kisLimiter) wait(ctx context.Context, priority KISPriority) error {
+	if priority < 0 || priority >= kisPriorities {
+		priority = PriorityBulk
+	}
+	l.mu.Lock()
+	l.waiting[priority]++
+	l.mu.Unlock()
+	defer func() {
+		l.mu.Lock()
+		l.waiting[priority]--
+		l.mu.Unlock()
+	}()
+
+	for {
+		l.mu.Lock()
+		now := time.Now()
+		l.tokens = min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+		l.last = now
+		delay := time.Duration((1 - l.tokens) / l.rate * float64(time.Second))
+		if l.tokens >= 1 {
+			if !l.higherWaiting(priority) {
+				l.tokens--
+				l.mu.Unlock()
+				return nil
+			}
+			// Let the higher lane take this slot and look again at the next one
+			delay = time.Duration(float64(time.Second) / l.rate)
+		}
+		l.mu.Unlock()
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+func (l *kisLimiter) higherWaiting(priority KISPriority) bool {
+	for p := PriorityInteractive; p < priority; p++ {
+		if l.waiting[p] > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	kisLimitersMu sync.Mutex
+	kisLimiters   = make(map[string]*kisLimiter) // app key + host -> limiter
+)
+
+// kisLimiterFor returns the limiter of appKey on host, creating it at the host's rate
+func kisLimiterFor(appKey, host string) *kisLimiter {
+	kisLimitersMu.Lock()
+	defer kisLimitersMu.Unlock()
+	key := appKey + "@" + host
+	limiter, exists := kisLimiters[key]
+	if !exists {
+		limiter = newKISLimiter(kisRateLimit(host))
+		kisLimiters[key] = limiter
+	}
+	return limiter
+}
+
+// kisRateLimit is the calls per second allowed on host: KIS_MOCK_RATE_LIMIT for the mock host
+// and KIS_RATE_LIMIT for any other, falling back to the KIS defaults
+func kisRateLimit(host string) float64 {
+	name, rate := "KIS_RATE_LIMIT", defaultKISRateLimit
+	if mock, err := url.Parse(KISBaseURLMock); err == nil && mock.Host == host {
+		name, rate = "KIS_MOCK_RATE_LIMIT", defaultKISMockRateLimit
+	}
+	if value, err := strconv.ParseFloat(os.Getenv(name), 64); err == nil && value > 0 {
+		rate = value
+	}
+	return rate
+}
+
+// WithContext returns a copy of the client whose calls wait for the rate limit within ctx
+// and are cancelled with it
+func (c *KISClient) WithContext(ctx context.Context) *KISClient {
+	copied := *c
+	copied.ctx = ctx
+	return &copied
+}
+
+// WithPriority returns a copy of the client whose calls wait in the lane of priority.
+// Clients start in PriorityInteractive.
+func (c *KISClient) WithPriority(priority KISPriority) *KISClient {
+	copied := *c
+	copied.priority = priority
+	return &copied
+}
+
+func (c *KISClient) context() context.Context {
+	if c.ctx != nil {
+		return c.ctx
+	}
+	return context.Background()
+}
+
+// doKIS waits for the limiter of appKey on the request's host, then sends req with ctx
+func doKIS(ctx context.Context, priority KISPriority, appKey string, req *http.Request) (*http.Response, error) {
+	if err := kisLimiterFor(appKey, req.URL.Host).wait(ctx, priority); err != nil {
+		return nil, err
+	}
+	return http.DefaultClient.Do(req.WithContext(ctx))
+}
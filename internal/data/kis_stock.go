@@ -2,6 +2,7 @@ package data
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -16,8 +17,16 @@ const (
     // Real URL should be "https://openapi.koreainvestment.com:9443"
     KISBaseURL = "https://openapi.koreainvestment.com:9443"
     KISBaseURLMock = "https://openapivts.koreainvestment.com:29443"
-    KIS_ACCESS_TOKEN = "KIS_ACCESS_TOKEN"
 )
+
+// priceAdjustment is the FID_ORG_ADJ_PRC value of the period price APIs: "0" returns prices
+// adjusted for every capital change up to today, "1" the prices that actually traded
+func priceAdjustment(adjusted bool) string {
+    if adjusted {
+        return "0"
+    }
+    return "1"
+}
 var indexCodeToName = map[string]string{
     "0001": "Kospi",
     "1001": "Kosdaq",
@@ -25,6 +34,27 @@ var indexCodeToName = map[string]string{
     "4001": "KRX100",
 }
 
+// ResolveIndexCode accepts an index code ("0001") or name ("KOSPI", "kosdaq") and returns its code
+func ResolveIndexCode(nameOrCode string) (string, bool) {
+    if _, ok := indexCodeToName[nameOrCode]; ok {
+        return nameOrCode, true
+    }
+    for code, name := range indexCodeToName {
+        if strings.EqualFold(name, nameOrCode) {
+            return code, true
+        }
+    }
+    return "", false
+}
+
+// IndexName returns the display name of an index code, or the code itself if unknown
+func IndexName(code string) string {
+    if name, ok := indexCodeToName[code]; ok {
+        return name
+    }
+    return code
+}
+
 func NewKISClient() *KISClient {
     return &KISClient{
         AppKey: os.Getenv("KIS_APP_KEY"),
@@ -38,8 +68,6 @@ func NewKISClient() *KISClient {
 func (c *KISClient) GetRecentDailyPrice(symbol string) (SlicePriceStruct, error) {
     endpoint := fmt.Sprintf("%s/uapi/domestic-stock/v1/quotations/inquire-daily-price", KISBaseURL)
 
-    c.AccessToken = os.Getenv(KIS_ACCESS_TOKEN)
-
     params := url.Values{}
     params.Add("FID_COND_MRKT_DIV_CODE", "J")
     params.Add("FID_INPUT_ISCD", symbol)
@@ -76,22 +104,21 @@ func (c *KISClient) GetRecentDailyPrice(symbol string) (SlicePriceStruct, error)
 //   - from: the start date in "YYYYMMDD" format (e.g., "20240101")
 //   - to: the end date in "YYYYMMDD" format (e.g., "20240601")
 //   - duration: one of "D" (daily), "W" (weekly), "M" (monthly), or "Y" (yearly)
+//   - adjusted: true for prices adjusted to today's share basis, false for the traded prices
 //
 // Returns:
 //   - A slice of PriceStruct containing date, open, high, low, close, volume, and duration fields
 //   - An error if the API call fails or the response cannot be parsed
-func (c *KISClient) GetDailyPrice(symbol, from, to, duration string) (SlicePriceStruct, error) {
+func (c *KISClient) GetDailyPrice(symbol, from, to, duration string, adjusted bool) (SlicePriceStruct, error) {
     endpoint := fmt.Sprintf("%s/uapi/domestic-stock/v1/quotations/inquire-daily-itemchartprice", KISBaseURL)
 
-    c.AccessToken = os.Getenv(KIS_ACCESS_TOKEN)
-
     params := url.Values{}
 	params.Add("FID_COND_MRKT_DIV_CODE", "J")
 	params.Add("FID_INPUT_ISCD", symbol)
 	params.Add("FID_INPUT_DATE_1", from)
 	params.Add("FID_INPUT_DATE_2", to)
 	params.Add("FID_PERIOD_DIV_CODE", duration)
-	params.Add("FID_ORG_ADJ_PRC", "0")
+	params.Add("FID_ORG_ADJ_PRC", priceAdjustment(adjusted))
 
     resp_body, err := c.get(endpoint, "FHKST03010100", params)
     if err != nil {
@@ -119,8 +146,6 @@ func (c *KISClient) GetDailyPrice(symbol, from, to, duration string) (SlicePrice
 func (c *KISClient) GetTopFluctuationStocks() (SliceRankingStock, error) {
 	endpoint := fmt.Sprintf("%s/uapi/domestic-stock/v1/ranking/fluctuation", KISBaseURL)
 
-    c.AccessToken = os.Getenv(KIS_ACCESS_TOKEN)
-
 	params := url.Values{}
     params.Add("fid_rsfl_rate2", "")
     params.Add("fid_cond_mrkt_div_code", "J")
@@ -159,8 +184,6 @@ func (c *KISClient) GetTopFluctuationStocks() (SliceRankingStock, error) {
 func (c *KISClient) GetMostTradedStocks() (SliceRankingStock, error) {
 	endpoint := fmt.Sprintf("%s/uapi/domestic-stock/v1/quotations/volume-rank", KISBaseURL)
 
-    c.AccessToken = os.Getenv(KIS_ACCESS_TOKEN)
-
 	params := url.Values{}
     params.Add("FID_COND_MRKT_DIV_CODE", "J")
     params.Add("FID_COND_SCR_DIV_CODE", "20171")
@@ -198,8 +221,6 @@ func (c *KISClient) GetMostTradedStocks() (SliceRankingStock, error) {
 func (c *KISClient) GetTopMarketCapStocks() (SliceRankingStock, error) {
 	endpoint := fmt.Sprintf("%s/uapi/domestic-stock/v1/ranking/market-cap", KISBaseURL)
 
-    c.AccessToken = os.Getenv(KIS_ACCESS_TOKEN)
-
 	params := url.Values{}
     params.Add("fid_input_price_2", "")
     params.Add("fid_cond_mrkt_div_code", "J")
@@ -233,8 +254,6 @@ func (c *KISClient) GetTopMarketCapStocks() (SliceRankingStock, error) {
 func (c *KISClient) GetMultipleStockSnapshot(targetCode []string) (SliceStockSnapshot, error) {
 	endpoint := fmt.Sprintf("%s/uapi/domestic-stock/v1/quotations/intstock-multprice", KISBaseURL)
 
-    c.AccessToken = os.Getenv(KIS_ACCESS_TOKEN)
-
 	params := url.Values{}
     marketDivCode := "FID_COND_MRKT_DIV_CODE_"
     inputIscd := "FID_INPUT_ISCD_"
@@ -268,8 +287,6 @@ func (c *KISClient) GetMultipleStockSnapshot(targetCode []string) (SliceStockSna
 func (c *KISClient) GetIndexPrice(targetIndex string) (*IndexStruct, error) {
 	endpoint := fmt.Sprintf("%s/uapi/domestic-stock/v1/quotations/inquire-index-price", KISBaseURL)
 
-    c.AccessToken = os.Getenv(KIS_ACCESS_TOKEN)
-
 	params := url.Values{}
     params.Add("FID_COND_MRKT_DIV_CODE", "U")
     params.Add("FID_INPUT_ISCD", targetIndex)
@@ -302,6 +319,43 @@ func (c *KISClient) GetIndexPrice(targetIndex string) (*IndexStruct, error) {
 	return &result.Output, nil
 }
 
+// GetDailyIndexPrice: 국내주식업종기간별시세(일/주/월/년)
+// Retrieves daily index values (0001: Kospi, 1001: Kosdaq, 2001: Kospi200, ...) between two dates.
+// The API returns at most 50 bars per call, newest first; callers chunk longer ranges.
+func (c *KISClient) GetDailyIndexPrice(targetIndex, from, to string) (SliceIndexPriceStruct, error) {
+	endpoint := fmt.Sprintf("%s/uapi/domestic-stock/v1/quotations/inquire-daily-indexchartprice", KISBaseURL)
+
+	params := url.Values{}
+	params.Add("FID_COND_MRKT_DIV_CODE", "U")
+	params.Add("FID_INPUT_ISCD", targetIndex)
+	params.Add("FID_INPUT_DATE_1", from)
+	params.Add("FID_INPUT_DATE_2", to)
+	params.Add("FID_PERIOD_DIV_CODE", "D")
+
+	respBody, err := c.get(endpoint, "FHKUP03500100", params)
+	if err != nil {
+		return nil, err
+	}
+	defer respBody.Close()
+
+	var raw struct {
+		RtCd   string                `json:"rt_cd"`
+		MsgCd  string                `json:"msg_cd"`
+		Msg1   string                `json:"msg1"`
+		Output SliceIndexPriceStruct `json:"output2"`
+	}
+
+	if err := json.NewDecoder(respBody).Decode(&raw); err != nil {
+		return nil, fmt.Errorf("decode error: %w", err)
+	}
+
+	if raw.RtCd != "0" {
+		return nil, fmt.Errorf("KIS API error %s: %s", raw.MsgCd, raw.Msg1)
+	}
+
+	return raw.Output, nil
+}
+
 // PlaceOrder places a buy or sell order using the KIS API.
 func (c *KISClient) PlaceOrder(accNo string, req OrderRequest) (*OrderResponse, error) {
 	baseURL := KISBaseURL
@@ -345,8 +399,6 @@ func (c *KISClient) PlaceOrder(accNo string, req OrderRequest) (*OrderResponse,
 		return nil, fmt.Errorf("marshal order body: %w", err)
 	}
 
-	c.AccessToken = os.Getenv(KIS_ACCESS_TOKEN)
-
 	httpReq, err := http.NewRequest("POST", endpoint, bytes.NewBuffer(jsonBody))
 	if err != nil {
 		return nil, fmt.Errorf("create order request: %w", err)
@@ -354,9 +406,7 @@ func (c *KISClient) PlaceOrder(accNo string, req OrderRequest) (*OrderResponse,
 	c.prepareRequestHeader(httpReq, trID)
 	httpReq.Header.Set("content-type", "application/json; charset=utf-8")
 
-	retry := false
-RETRY:
-	resp, err := http.DefaultClient.Do(httpReq)
+	resp, err := c.do(httpReq)
 	if err != nil {
 		return nil, fmt.Errorf("order request failed: %w", err)
 	}
@@ -375,15 +425,6 @@ RETRY:
 		return nil, fmt.Errorf("decode order response: %w", err)
 	}
 	if raw.RtCd != "0" {
-		// If token expired, try to refresh and retry ONCE
-		if !retry && strings.Contains(raw.Msg1, "기간이 만료된 token 입니다.") {
-			newToken, refreshErr := RefreshKISToken(c.AppKey, c.AppSecret)
-			if refreshErr == nil {
-				c.AccessToken = newToken
-				retry = true
-				goto RETRY
-			}
-		}
 		return &OrderResponse{
 			OrderNo:   "",
 			Timestamp: "",
@@ -401,15 +442,14 @@ RETRY:
 
 // prepareRequestHeaders sets the standard headers required for KIS API requests.
 //
-// It adds headers for content type, authorization, app key, app secret, and transaction ID (tr_id).
-// This helps avoid duplication across different API calls that require similar headers.
+// It adds headers for content type, app key, app secret, and transaction ID (tr_id); c.do adds
+// the authorization once it has a token for the request's host. This helps avoid duplication across different API calls that require similar headers.
 //
 // Parameters:
 //   - req: the HTTP request to which the headers will be applied
 //   - trID: the transaction ID specific to the API endpoint being called (e.g., "FHKST03010100")
 func (c *KISClient) prepareRequestHeader(req *http.Request, trID string) {
     req.Header.Set("content-type", "application/json; charset=utf-8")
-	req.Header.Set("authorization", "Bearer "+c.AccessToken)
 	req.Header.Set("appkey", c.AppKey)
 	req.Header.Set("appsecret", c.AppSecret)
 	req.Header.Set("tr_id", trID)
@@ -427,7 +467,7 @@ func (c *KISClient) get(endpoint, trID string, params url.Values) (io.ReadCloser
 
 	c.prepareRequestHeader(req, trID)
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := c.do(req)
 	if err != nil {
 		return nil, fmt.Errorf("do request: %w", err)
 	}
@@ -444,97 +484,36 @@ func (c *KISClient) get(endpoint, trID string, params url.Values) (io.ReadCloser
 	return resp.Body, nil
 }
 
+// GetKISAccessToken returns the client's token on the real host, from the token manager:
+// cached until shortly before it expires and refreshed through /oauth2/tokenP after that.
 func (c *KISClient) GetKISAccessToken() (string, error) {
-    payload := map[string]string{
-        "grant_type": "client_credentials",
-        "appkey":     c.AppKey,
-        "appsecret":  c.AppSecret,
-    }
-
-    body, err := json.Marshal(payload)
-    if err != nil {
-        return "", fmt.Errorf("failed to encode JSON: %w", err)
-    }
-
-    req, err := http.NewRequest("POST", KISBaseURL+"/oauth2/tokenP", bytes.NewBuffer(body))
-    if err != nil {
-        return "", fmt.Errorf("failed to create request: %w", err)
-    }
-
-    req.Header.Set("Content-Type", "application/json; charset=UTF-8")
-
-    resp, err := http.DefaultClient.Do(req)
-    if err != nil {
-        return "", fmt.Errorf("request error: %w", err)
-    }
-    defer resp.Body.Close()
-
-    if resp.StatusCode != http.StatusOK {
-        responseBody, _ := io.ReadAll(resp.Body)
-        return "", fmt.Errorf("unexpected status %s: %s", resp.Status, responseBody)
-    }
-
-    var authResp struct {
-        AccessToken string `json:"access_token"`
-    }
-    if err := json.NewDecoder(resp.Body).Decode(&authResp); err != nil {
-        return "", fmt.Errorf("failed to parse response: %w", err)
-    }
-
-    c.AccessToken = authResp.AccessToken
-    return authResp.AccessToken, nil
+	return kisTokens.Token(c.context(), KISBaseURL, c.AppKey, c.AppSecret, c.tokenStore)
 }
 
-// RefreshKISToken fetches a new KIS access token for the given appKey/appSecret.
+// RefreshKISToken fetches a new KIS access token for the given appKey/appSecret, bypassing
+// the token manager's cache.
 func RefreshKISToken(appKey, appSecret string) (string, error) {
-	payload := map[string]string{
-		"grant_type": "client_credentials",
-		"appkey":     appKey,
-		"appsecret":  appSecret,
-	}
-	body, err := json.Marshal(payload)
-	if err != nil {
-		return "", fmt.Errorf("failed to encode JSON: %w", err)
-	}
-	url := KISBaseURL + "/oauth2/tokenP"
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(body))
-	if err != nil {
-		return "", fmt.Errorf("failed to create request: %w", err)
-	}
-	req.Header.Set("Content-Type", "application/json; charset=UTF-8")
-	resp, err := http.DefaultClient.Do(req)
+	token, err := requestKISToken(context.Background(), KISBaseURL, appKey, appSecret)
 	if err != nil {
-		return "", fmt.Errorf("request error: %w", err)
-	}
-	defer resp.Body.Close()
-	if resp.StatusCode != http.StatusOK {
-		responseBody, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("unexpected status %s: %s", resp.Status, responseBody)
-	}
-	var authResp struct {
-		AccessToken string `json:"access_token"`
-		ExpiresIn   int    `json:"expires_in"`
+		return "", err
 	}
-	if err := json.NewDecoder(resp.Body).Decode(&authResp); err != nil {
-		return "", fmt.Errorf("failed to parse response: %w", err)
-	}
-    return authResp.AccessToken, nil
+	return token.AccessToken, nil
 }
 
 // GetDailyStockData: 국내주식기간별시세(일/주/월/년) - Enhanced version for historical data
-// Retrieves daily stock prices for a given symbol between two dates with better error handling
-func (c *KISClient) GetDailyStockData(symbol, from, to string) (SlicePriceStruct, error) {
+// Retrieves daily stock prices for a given symbol between two dates with better error handling.
+// Adjusted prices are only consistent within one response: every capital change after the
+// request date shifts them again, so stored history should use the traded prices.
+func (c *KISClient) GetDailyStockData(symbol, from, to string, adjusted bool) (SlicePriceStruct, error) {
 	endpoint := fmt.Sprintf("%s/uapi/domestic-stock/v1/quotations/inquire-daily-itemchartprice", KISBaseURL)
 
-	c.AccessToken = os.Getenv(KIS_ACCESS_TOKEN)
-
 	params := url.Values{}
 	params.Add("FID_COND_MRKT_DIV_CODE", "J")
 	params.Add("FID_INPUT_ISCD", symbol)
 	params.Add("FID_INPUT_DATE_1", from)
 	params.Add("FID_INPUT_DATE_2", to)
 	params.Add("FID_PERIOD_DIV_CODE", "D")
-	params.Add("FID_ORG_ADJ_PRC", "0")
+	params.Add("FID_ORG_ADJ_PRC", priceAdjustment(adjusted))
 
 	respBody, err := c.get(endpoint, "FHKST03010100", params)
 	if err != nil {
@@ -578,8 +557,6 @@ func (c *KISClient) GetDailyStockData(symbol, from, to string) (SlicePriceStruct
 func (c *KISClient) GetMinuteStockData(symbol, from, to string) (SliceMinutePriceStruct, error) {
 	endpoint := fmt.Sprintf("%s/uapi/domestic-stock/v1/quotations/inquire-time-itemchartprice", KISBaseURL)
 
-	c.AccessToken = os.Getenv(KIS_ACCESS_TOKEN)
-
 	params := url.Values{}
 	params.Add("FID_COND_MRKT_DIV_CODE", "J")
 	params.Add("FID_INPUT_ISCD", symbol)
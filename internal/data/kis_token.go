@@ -0,0 +1,273 @@
+package data
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// kisTokenRefreshAhead is how long before expiry a token is replaced. KIS tokens last a day and
+// tokenP only issues one a minute per app key, so a failed early refresh can be retried.
+const kisTokenRefreshAhead = time.Hour
+
+// KIS error codes of a token that has expired or is not valid
+var kisTokenErrors = []string{"EGW00123", "EGW00121"}
+
+// KISToken is an access token issued by /oauth2/tokenP
+type KISToken struct {
+	AccessToken string
+	ExpiresAt   time.Time
+}
+
+// usable reports whether the token can still be used at now without refreshing it
+func (t KISToken) usable(now time.Time) bool {
+	return t.AccessToken != "" && now.Before(t.ExpiresAt.Add(-kisTokenRefreshAhead))
+}
+
+// KISTokenStore persists the token of one set of KIS credentials across restarts
+type KISTokenStore interface {
+	// LoadToken returns the stored token, or nil when there is none
+	LoadToken(ctx context.Context) (*KISToken, error)
+	SaveToken(ctx context.Context, token KISToken) error
+}
+
+// AccountTokenStore keeps the token of a linked user account in kis_access_tokens
+type AccountTokenStore struct {
+	DB            *sql.DB
+	UserAccountID int64
+}
+
+func (s *AccountTokenStore) LoadToken(ctx context.Context) (*KISToken, error) {
+	stored, err := GetKISToken(s.DB, s.UserAccountID)
+	if err != nil || stored == nil {
+		return nil, err
+	}
+	expiresAt, err := time.Parse(time.RFC3339Nano, stored.ExpiresAt)
+	if err != nil {
+		return nil, fmt.Errorf("stored token expiry %q: %w", stored.ExpiresAt, err)
+	}
+	return &KISToken{AccessToken: stored.Token, ExpiresAt: expiresAt}, nil
+}
+
+// SaveToken stores times in UTC since the columns have no time zone
+func (s *AccountTokenStore) SaveToken(ctx context.Context, token KISToken) error {
+	return UpsertKISToken(s.DB, &KISAccessToken{
+		UserAccountID: s.UserAccountID,
+		Token:         token.AccessToken,
+		ExpiresAt:     token.ExpiresAt.UTC().Format(time.RFC3339Nano),
+		RefreshedAt:   time.Now().UTC().Format(time.RFC3339Nano),
+	})
+}
+
+// kisTokenEntry is the cached token of one app key on one host
+type kisTokenEntry struct {
+	token      KISToken
+	refreshing chan struct{} // closed when the refresh in flight finishes; nil when idle
+	err        error         // outcome of the last refresh, for the callers that waited on it
+}
+
+// KISTokenManager issues KIS access tokens and caches them per app key and host until shortly
+// before they expire. Concurrent callers share one refresh.
+type KISTokenManager struct {
+	mu      sync.Mutex
+	entries map[string]*kisTokenEntry
+}
+
+func NewKISTokenManager() *KISTokenManager {
+	return &KISTokenManager{entries: make(map[string]*kisTokenEntry)}
+}
+
+// kisTokens is the manager every KISClient uses
+var kisTokens = NewKISTokenManager()
+
+// Token returns a token for appKey on baseURL, refreshing it when it is about to expire. store,
+// if not nil, is checked before a new token is requested and keeps every token issued.
+func (m *KISTokenManager) Token(ctx context.Context, baseURL, appKey, appSecret string, store KISTokenStore) (string, error) {
+	key := appKey + "@" + baseURL
+	m.mu.Lock()
+	entry, exists := m.entries[key]
+	if !exists {
+		entry = &kisTokenEntry{}
+		m.entries[key] = entry
+	}
+	if entry.token.usable(time.Now()) {
+		m.mu.Unlock()
+		return entry.token.AccessToken, nil
+	}
+	if refreshing := entry.refreshing; refreshing != nil {
+		m.mu.Unlock()
+		select {
+		case <-refreshing:
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+		m.mu.Lock()
+		token, err := entry.token, entry.err
+		m.mu.Unlock()
+		if err != nil {
+			return "", err
+		}
+		return token.AccessToken, nil
+	}
+	entry.refreshing = make(chan struct{})
+	m.mu.Unlock()
+
+	token, err := m.refresh(ctx, baseURL, appKey, appSecret, store)
+
+	m.mu.Lock()
+	if err == nil {
+		entry.token = token
+	} else if entry.token.AccessToken != "" && time.Now().Before(entry.token.ExpiresAt) {
+		// Keep using a token that has not expired yet; the next call tries again
+		log.Printf("kis token: refresh failed, using the current token until %s: %v", entry.token.ExpiresAt.Format(time.RFC3339), err)
+		token, err = entry.token, nil
+	}
+	entry.err = err
+	close(entry.refreshing)
+	entry.refreshing = nil
+	m.mu.Unlock()
+	return token.AccessToken, err
+}
+
+// Invalidate drops the cached token of appKey on baseURL after KIS rejected it
+func (m *KISTokenManager) Invalidate(baseURL, appKey, accessToken string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if entry, exists := m.entries[appKey+"@"+baseURL]; exists && entry.token.AccessToken == accessToken {
+		entry.token = KISToken{}
+	}
+}
+
+// refresh takes the stored token when it is still usable and requests a new one otherwise
+func (m *KISTokenManager) refresh(ctx context.Context, baseURL, appKey, appSecret string, store KISTokenStore) (KISToken, error) {
+	if store != nil {
+		stored, err := store.LoadToken(ctx)
+		if err != nil {
+			log.Printf("kis token: load stored token: %v", err)
+		} else if stored != nil && stored.usable(time.Now()) {
+			return *stored, nil
+		}
+	}
+
+	token, err := requestKISToken(ctx, baseURL, appKey, appSecret)
+	if err != nil {
+		return KISToken{}, err
+	}
+	if store != nil {
+		if err := store.SaveToken(ctx, token); err != nil {
+			log.Printf("kis token: save token: %v", err)
+		}
+	}
+	return token, nil
+}
+
+// requestKISToken asks baseURL's /oauth2/tokenP for a new token
+func requestKISToken(ctx context.Context, baseURL, appKey, appSecret string) (KISToken, error) {
+	body, err := json.Marshal(map[string]string{
+		"grant_type": "client_credentials",
+		"appkey":     appKey,
+		"appsecret":  appSecret,
+	})
+	if err != nil {
+		return KISToken{}, fmt.Errorf("failed to encode JSON: %w", err)
+	}
+	req, err := http.NewRequest("POST", baseURL+"/oauth2/tokenP", bytes.NewBuffer(body))
+	if err != nil {
+		return KISToken{}, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json; charset=UTF-8")
+
+	requested := time.Now()
+	resp, err := doKIS(ctx, PriorityInteractive, appKey, req)
+	if err != nil {
+		return KISToken{}, fmt.Errorf("request error: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		responseBody, _ := io.ReadAll(resp.Body)
+		return KISToken{}, fmt.Errorf("unexpected status %s: %s", resp.Status, responseBody)
+	}
+
+	var authResp struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`                 // seconds
+		ExpiresAt   string `json:"access_token_token_expired"` // "2006-01-02 15:04:05" KST
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&authResp); err != nil {
+		return KISToken{}, fmt.Errorf("failed to parse response: %w", err)
+	}
+	if authResp.AccessToken == "" {
+		return KISToken{}, fmt.Errorf("no access token in the response")
+	}
+
+	token := KISToken{AccessToken: authResp.AccessToken, ExpiresAt: requested.Add(time.Duration(authResp.ExpiresIn) * time.Second)}
+	if authResp.ExpiresIn <= 0 {
+		expiresAt, err := time.ParseInLocation("2006-01-02 15:04:05", authResp.ExpiresAt, time.FixedZone("KST", 9*60*60))
+		if err != nil {
+			return KISToken{}, fmt.Errorf("no expiry in the response")
+		}
+		token.ExpiresAt = expiresAt
+	}
+	return token, nil
+}
+
+// isKISTokenError reports whether a KIS error body rejects the access token
+func isKISTokenError(body []byte) bool {
+	for _, code := range kisTokenErrors {
+		if bytes.Contains(body, []byte(code)) {
+			return true
+		}
+	}
+	return strings.Contains(string(body), "만료된 token")
+}
+
+// do authorizes req with the token of its app key and host, sends it once the rate limit
+// allows, and retries once with a new token when KIS rejects the one it had. A client with a
+// fixed AccessToken always sends that.
+func (c *KISClient) do(req *http.Request) (*http.Response, error) {
+	ctx := c.context()
+	appKey := req.Header.Get("appkey")
+	baseURL := req.URL.Scheme + "://" + req.URL.Host
+	for retried := false; ; retried = true {
+		token := c.AccessToken
+		if token == "" {
+			var err error
+			if token, err = kisTokens.Token(ctx, baseURL, appKey, req.Header.Get("appsecret"), c.tokenStore); err != nil {
+				return nil, fmt.Errorf("KIS access token: %w", err)
+			}
+		}
+		req.Header.Set("authorization", "Bearer "+token)
+
+		resp, err := doKIS(ctx, c.priority, appKey, req)
+		if err != nil || resp.StatusCode == http.StatusOK || retried || c.AccessToken != "" {
+			return resp, err
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		resp.Body = io.NopCloser(bytes.NewReader(body))
+		if !isKISTokenError(body) || (req.Body != nil && req.GetBody == nil) {
+			return resp, nil
+		}
+		kisTokens.Invalidate(baseURL, appKey, token)
+		if req.GetBody != nil {
+			if req.Body, err = req.GetBody(); err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+// WithTokenStore returns a copy of the client that keeps its tokens in store
+func (c *KISClient) WithTokenStore(store KISTokenStore) *KISClient {
+	copied := *c
+	copied.tokenStore = store
+	return &copied
+}
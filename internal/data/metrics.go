@@ -0,0 +1,47 @@
+package data
+
+// RiskMetrics summarizes an equity curve. Returns, volatility, drawdowns and VaR are in
+// percent; VaR and CVaR are one-day losses reported as positive numbers.
+type RiskMetrics struct {
+	RiskFreeRate float64 `json:"risk_free_rate"` // Annual risk-free rate used for Sharpe and Sortino (e.g. 0.035)
+	TotalReturn  float64 `json:"total_return"`   // Return from the first to the last point
+	CAGR         float64 `json:"cagr"`           // Compound annual growth rate over the calendar span
+	Volatility   float64 `json:"volatility"`     // Annualized stddev of daily returns
+	SharpeRatio  float64 `json:"sharpe_ratio"`   // Annualized excess return over volatility
+	SortinoRatio float64 `json:"sortino_ratio"`  // Annualized excess return over downside deviation
+	CalmarRatio  float64 `json:"calmar_ratio"`   // CAGR over max drawdown
+
+	MaxDrawdown         float64 `json:"max_drawdown"`          // Deepest peak-to-trough decline
+	MaxDrawdownPeak     string  `json:"max_drawdown_peak"`     // YYYY-MM-DD of the peak before the deepest decline
+	MaxDrawdownTrough   string  `json:"max_drawdown_trough"`   // YYYY-MM-DD of the bottom of the deepest decline
+	MaxDrawdownRecovery string  `json:"max_drawdown_recovery"` // YYYY-MM-DD the peak was regained, empty if never
+	RecoveryDays        int     `json:"recovery_days"`         // Calendar days from trough to recovery, -1 if not recovered
+	LongestDrawdownDays int     `json:"longest_drawdown_days"` // Calendar days of the longest time spent below a peak
+	LongestDrawdownFrom string  `json:"longest_drawdown_from"` // YYYY-MM-DD the longest drawdown started
+	LongestDrawdownTo   string  `json:"longest_drawdown_to"`   // YYYY-MM-DD it recovered, or the last date if it has not
+
+	VaRConfidence  float64 `json:"var_confidence"`  // Confidence level of VaR and CVaR (e.g. 0.95)
+	HistoricalVaR  float64 `json:"historical_var"`  // Empirical quantile of daily losses
+	HistoricalCVaR float64 `json:"historical_cvar"` // Mean daily loss beyond the historical VaR
+	ParametricVaR  float64 `json:"parametric_var"`  // Normal-distribution VaR from mean and stddev
+	ParametricCVaR float64 `json:"parametric_cvar"` // Normal-distribution expected shortfall
+
+	MonthlyReturns []PeriodReturn `json:"monthly_returns"` // Compounded return of each calendar month
+	YearlyReturns  []PeriodReturn `json:"yearly_returns"`  // Compounded return of each calendar year
+}
+
+// PeriodReturn is one row of a monthly or yearly return table
+type PeriodReturn struct {
+	Period string  `json:"period"` // "2024-03" for months, "2024" for years
+	Return float64 `json:"return"` // Return in percent, measured from the previous period's last value
+}
+
+// PortfolioRisk is the risk report of an account's current holdings replayed over past prices
+type PortfolioRisk struct {
+	AccountID string         `json:"account_id"`
+	From      string         `json:"from"`     // YYYYMMDD
+	To        string         `json:"to"`       // YYYYMMDD
+	Cash      float64        `json:"cash"`     // Cash held constant over the replay
+	Holdings  map[string]int `json:"holdings"` // Stock code -> quantity held today
+	Risk      RiskMetrics    `json:"risk"`
+}
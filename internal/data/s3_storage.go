@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"io"
 	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/aws/aws-sdk-go/aws"
@@ -42,7 +43,8 @@ func NewS3Storage(config S3Config) (*S3Storage, error) {
 	}, nil
 }
 
-// StoreDailyData stores daily stock data to S3 as CSV
+// StoreDailyData stores daily stock data to S3 as CSV. The file holds traded (unadjusted)
+// prices; split and dividend adjustments come from the corporate action log.
 func (s *S3Storage) StoreDailyData(symbol string, data SlicePriceStruct) error {
 	// Sort data by date
 	sort.Slice(data, func(i, j int) bool {
@@ -234,6 +236,83 @@ func (s *S3Storage) LoadMinuteData(symbol, yearMonth string) (SliceMinutePriceSt
 	return data, nil
 }
 
+// LoadCorporateActions loads the corporate action log of a symbol, oldest first.
+// A symbol without a log has had no recorded actions and gets an empty slice.
+func (s *S3Storage) LoadCorporateActions(symbol string) ([]CorporateAction, error) {
+	key := fmt.Sprintf("actions/%s.csv", symbol)
+
+	result, err := s.s3Client.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(s.bucketName),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		if strings.Contains(err.Error(), "NoSuchKey") {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to download corporate actions for %s: %w", symbol, err)
+	}
+	defer result.Body.Close()
+
+	records, err := csv.NewReader(result.Body).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse corporate actions for %s: %w", symbol, err)
+	}
+
+	var actions []CorporateAction
+	// Skip header row
+	for i := 1; i < len(records); i++ {
+		record := records[i]
+		if len(record) < 4 {
+			continue
+		}
+		factor, err := strconv.ParseFloat(record[2], 64)
+		if err != nil || factor <= 0 {
+			return nil, fmt.Errorf("invalid factor %q in corporate actions for %s", record[2], symbol)
+		}
+		actions = append(actions, CorporateAction{
+			Date:   record[0],
+			Type:   record[1],
+			Factor: factor,
+			Source: record[3],
+		})
+	}
+	sort.Slice(actions, func(i, j int) bool {
+		return actions[i].Date < actions[j].Date
+	})
+	return actions, nil
+}
+
+// StoreCorporateActions replaces the corporate action log of a symbol
+func (s *S3Storage) StoreCorporateActions(symbol string, actions []CorporateAction) error {
+	sort.Slice(actions, func(i, j int) bool {
+		return actions[i].Date < actions[j].Date
+	})
+
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+	writer.Write([]string{"Date", "Type", "Factor", "Source"})
+	for _, action := range actions {
+		writer.Write([]string{
+			action.Date,
+			action.Type,
+			strconv.FormatFloat(action.Factor, 'g', -1, 64),
+			action.Source,
+		})
+	}
+	writer.Flush()
+
+	key := fmt.Sprintf("actions/%s.csv", symbol)
+	_, err := s.uploader.Upload(&s3manager.UploadInput{
+		Bucket: aws.String(s.bucketName),
+		Key:    aws.String(key),
+		Body:   bytes.NewReader(buf.Bytes()),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to upload corporate actions for %s: %w", symbol, err)
+	}
+	return nil
+}
+
 // MergeAndStoreData merges new data with existing data, removes overlaps, and stores back to S3
 func (s *S3Storage) MergeAndStoreData(symbol string, newData interface{}, dataType string) error {
 	switch dataType {
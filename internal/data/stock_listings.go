@@ -5,12 +5,18 @@ import (
 	"encoding/csv"
 	"fmt"
 	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 
 	"golang.org/x/text/encoding/korean"
 )
 
 // ParseStockListingFile reads the fixed-width master file and returns meta rows.
+//
+// Field offsets are byte offsets in the EUC-KR encoded line, so the line is sliced
+// before decoding; only the name contains non-ASCII text.
 func ParseStockListingFile(path string) ([]StockMeta, error) {
 	f, err := os.Open(path)
 	if err != nil {
@@ -19,24 +25,33 @@ func ParseStockListingFile(path string) ([]StockMeta, error) {
 	defer f.Close()
 
 	var out []StockMeta
-	decoder := korean.EUCKR.NewDecoder().Reader(f)
-	sc := bufio.NewScanner(decoder)
+	decoder := korean.EUCKR.NewDecoder()
+	sc := bufio.NewScanner(f)
 
 	for sc.Scan() {
-		line := sc.Text()
+		line := sc.Bytes()
 		if len(line) < 76 { // need at least up to smal_div_code
 			continue
 		}
-		out = append(out, StockMeta{
-			Code:         strings.TrimSpace(line[0:9]),
-			ISIN:         strings.TrimSpace(line[9:21]),
-			Name:         strings.TrimSpace(line[21:61]),
-			SecurityType: strings.TrimSpace(line[61:63]),
-			CapSize:      strings.TrimSpace(line[63:64]),
-			IndLarge:     strings.TrimSpace(line[64:68]),
-			IndMedium:    strings.TrimSpace(line[68:72]),
-			IndSmall:     strings.TrimSpace(line[72:76]),
-		})
+		name, err := decoder.Bytes(line[21:61])
+		if err != nil {
+			return nil, fmt.Errorf("decode name of %s: %w", strings.TrimSpace(string(line[0:9])), err)
+		}
+		meta := StockMeta{
+			Code:         strings.TrimSpace(string(line[0:9])),
+			ISIN:         strings.TrimSpace(string(line[9:21])),
+			Name:         strings.TrimSpace(string(name)),
+			SecurityType: strings.TrimSpace(string(line[61:63])),
+			CapSize:      strings.TrimSpace(string(line[63:64])),
+			IndLarge:     strings.TrimSpace(string(line[64:68])),
+			IndMedium:    strings.TrimSpace(string(line[68:72])),
+			IndSmall:     strings.TrimSpace(string(line[72:76])),
+		}
+		// Both KOSPI and KOSDAQ masters end with 시가총액(9) 그룹사코드(3) and three 1-byte flags
+		if len(line) >= 91 {
+			meta.MarketCap, _ = strconv.ParseInt(strings.TrimSpace(string(line[len(line)-15:len(line)-6])), 10, 64)
+		}
+		out = append(out, meta)
 	}
 	if err := sc.Err(); err != nil {
 		return nil, fmt.Errorf("scan: %w", err)
@@ -44,6 +59,80 @@ func ParseStockListingFile(path string) ([]StockMeta, error) {
 	return out, nil
 }
 
+// LoadStockListings reads a listings CSV written by convert_stock_listings.
+// Columns are matched by header name, so older files without Market or MarketCap still load.
+func LoadStockListings(path string) ([]StockMeta, error) {
+	records, field, err := readListingCSV(path)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]StockMeta, 0, len(records))
+	for _, record := range records {
+		if meta := parseListingRecord(record, field); meta.Code != "" {
+			out = append(out, meta)
+		}
+	}
+	return out, nil
+}
+
+// readListingCSV reads a listings CSV and returns its data rows with a lookup of fields by header name
+func readListingCSV(path string) ([][]string, func(record []string, names ...string) string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("open %s: %w", path, err)
+	}
+	defer f.Close()
+
+	reader := csv.NewReader(f)
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, nil, fmt.Errorf("read %s: %w", path, err)
+	}
+	if len(records) < 1 {
+		return nil, nil, fmt.Errorf("%s has no header", path)
+	}
+
+	columns := make(map[string]int)
+	for i, name := range records[0] {
+		columns[strings.TrimPrefix(strings.TrimSpace(name), "\ufeff")] = i
+	}
+	field := func(record []string, names ...string) string {
+		for _, name := range names {
+			if i, ok := columns[name]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+		}
+		return ""
+	}
+	return records[1:], field, nil
+}
+
+// parseListingRecord reads the StockMeta columns of one row
+func parseListingRecord(record []string, field func(record []string, names ...string) string) StockMeta {
+	meta := StockMeta{
+		Code:         field(record, "Code"),
+		ISIN:         field(record, "ISIN"),
+		Name:         field(record, "Name"),
+		SecurityType: field(record, "SecurityType", "GroupCode"),
+		CapSize:      field(record, "CapSize"),
+		IndLarge:     field(record, "IndLarge"),
+		IndMedium:    field(record, "IndMedium"),
+		IndSmall:     field(record, "IndSmall"),
+		Market:       field(record, "Market"),
+	}
+	meta.MarketCap, _ = strconv.ParseInt(field(record, "MarketCap"), 10, 64)
+	return meta
+}
+
+// StockListingsPath returns the listings CSV path from STOCK_LISTINGS_CSV or the converter default.
+func StockListingsPath() string {
+	if path := os.Getenv("STOCK_LISTINGS_CSV"); path != "" {
+		return path
+	}
+	return filepath.Join(".kis_data", "stock_listings.csv")
+}
 
 // WriteToCSV saves the parsed meta list.
 func WriteToCSV(rows []StockMeta, outPath string) error {
@@ -59,16 +148,139 @@ func WriteToCSV(rows []StockMeta, outPath string) error {
 	_ = w.Write([]string{
 		"Code", "ISIN", "Name", "SecurityType",
 		"CapSize", "IndLarge", "IndMedium", "IndSmall",
+		"Market", "MarketCap",
 	})
 	for _, r := range rows {
 		_ = w.Write([]string{
 			r.Code, r.ISIN, r.Name, r.SecurityType,
 			r.CapSize, r.IndLarge, r.IndMedium, r.IndSmall,
+			r.Market, strconv.FormatInt(r.MarketCap, 10),
 		})
 	}
 	return nil
 }
 
+// ListingSnapshotDir returns the directory of dated listing snapshots, one YYYYMMDD.csv per
+// run of convert_stock_listings, from LISTING_SNAPSHOT_DIR or the converter default.
+func ListingSnapshotDir() string {
+	if dir := os.Getenv("LISTING_SNAPSHOT_DIR"); dir != "" {
+		return dir
+	}
+	return filepath.Join(".kis_data", "listings")
+}
+
+// ListingHistoryPath returns the listing history CSV path from LISTING_HISTORY_CSV or the converter default.
+func ListingHistoryPath() string {
+	if path := os.Getenv("LISTING_HISTORY_CSV"); path != "" {
+		return path
+	}
+	return filepath.Join(".kis_data", "listing_history.csv")
+}
+
+// MergeListingSnapshot records the listings of one snapshot date in history. Snapshots may be
+// merged in any order; a code keeps the attributes of its latest snapshot.
+func MergeListingSnapshot(history []ListingRecord, date string, rows []StockMeta) []ListingRecord {
+	index := make(map[string]int, len(history))
+	for i, record := range history {
+		index[record.Code] = i
+	}
+	for _, row := range rows {
+		i, exists := index[row.Code]
+		if !exists {
+			index[row.Code] = len(history)
+			history = append(history, ListingRecord{StockMeta: row, FirstSeen: date, LastSeen: date})
+			continue
+		}
+		if date < history[i].FirstSeen {
+			history[i].FirstSeen = date
+		}
+		if date >= history[i].LastSeen {
+			history[i].LastSeen = date
+			history[i].StockMeta = row
+		}
+	}
+	sort.Slice(history, func(i, j int) bool {
+		return history[i].Code < history[j].Code
+	})
+	return history
+}
+
+// ListedBetween returns the records listed at any time from from to to (YYYYMMDD, inclusive).
+//
+// Snapshots only bound listing dates: a code counts from its first snapshot to its last. Codes in
+// the earliest snapshot are assumed listed before it and codes in the latest one still listed,
+// so ranges before the first snapshot keep the survivorship bias of that snapshot.
+func ListedBetween(history []ListingRecord, from, to string) []ListingRecord {
+	earliest, latest := "", ""
+	for _, record := range history {
+		if earliest == "" || record.FirstSeen < earliest {
+			earliest = record.FirstSeen
+		}
+		if record.LastSeen > latest {
+			latest = record.LastSeen
+		}
+	}
+
+	var listed []ListingRecord
+	for _, record := range history {
+		listedFrom := record.FirstSeen <= to || record.FirstSeen == earliest
+		listedTo := record.LastSeen >= from || record.LastSeen == latest
+		if listedFrom && listedTo {
+			listed = append(listed, record)
+		}
+	}
+	return listed
+}
+
+// LoadListingHistory reads a listing history CSV written by WriteListingHistory
+func LoadListingHistory(path string) ([]ListingRecord, error) {
+	records, field, err := readListingCSV(path)
+	if err != nil {
+		return nil, err
+	}
+
+	history := make([]ListingRecord, 0, len(records))
+	for _, record := range records {
+		entry := ListingRecord{
+			StockMeta: parseListingRecord(record, field),
+			FirstSeen: field(record, "FirstSeen"),
+			LastSeen:  field(record, "LastSeen"),
+		}
+		if entry.Code == "" {
+			continue
+		}
+		if entry.FirstSeen == "" || entry.LastSeen == "" {
+			return nil, fmt.Errorf("%s: %s has no FirstSeen/LastSeen", path, entry.Code)
+		}
+		history = append(history, entry)
+	}
+	return history, nil
+}
+
+// WriteListingHistory saves history with the listing CSV columns followed by FirstSeen and LastSeen
+func WriteListingHistory(history []ListingRecord, outPath string) error {
+	f, err := os.Create(outPath)
+	if err != nil {
+		return fmt.Errorf("create csv: %w", err)
+	}
+	defer f.Close()
+
+	w := csv.NewWriter(f)
+	_ = w.Write([]string{
+		"Code", "ISIN", "Name", "SecurityType",
+		"CapSize", "IndLarge", "IndMedium", "IndSmall",
+		"Market", "MarketCap", "FirstSeen", "LastSeen",
+	})
+	for _, r := range history {
+		_ = w.Write([]string{
+			r.Code, r.ISIN, r.Name, r.SecurityType,
+			r.CapSize, r.IndLarge, r.IndMedium, r.IndSmall,
+			r.Market, strconv.FormatInt(r.MarketCap, 10), r.FirstSeen, r.LastSeen,
+		})
+	}
+	w.Flush()
+	return w.Error()
+}
 
 // SearchStocks returns all stocks that *contain* the query in code or name
 // func (s *StockStore) SearchStocks(query string) StockStore {
@@ -1,5 +1,10 @@
 package data
 
+import (
+	"context"
+	"time"
+)
+
 type StockMeta struct {
 	Code         string // 단축코드
 	ISIN         string // 표준코드
@@ -9,6 +14,16 @@ type StockMeta struct {
 	IndLarge     string // 업종 대분류
 	IndMedium    string // 업종 중분류
 	IndSmall     string // 업종 소분류
+	Market       string // "1" = KOSPI, "2" = KOSDAQ
+	MarketCap    int64  // 시가총액 (억원)
+}
+
+// ListingRecord is a stock code across the dated listing snapshots. Attributes are taken from
+// the latest snapshot that lists the code.
+type ListingRecord struct {
+	StockMeta
+	FirstSeen string // YYYYMMDD of the first snapshot listing the code
+	LastSeen  string // YYYYMMDD of the last snapshot listing the code
 }
 
 type StockStore struct {
@@ -20,8 +35,12 @@ type KISClient struct {
 	AppSecret     string
 	MockAppKey    string
 	MockAppSecret string
-	AccessToken   string
+	AccessToken   string // fixed token to send; empty takes managed tokens, see GetKISAccessToken
 	TrID          string
+
+	ctx        context.Context // nil waits and sends without a deadline
+	priority   KISPriority     // rate limit lane, see WithPriority
+	tokenStore KISTokenStore   // nil keeps tokens in memory only
 }
 
 type RankingStock struct {
@@ -51,6 +70,15 @@ type PriceStruct struct {
 
 type SlicePriceStruct []PriceStruct
 
+// CorporateAction is one entry of a symbol's corporate action log. Prices before Date are
+// multiplied by Factor to put them on the share basis that starts on Date.
+type CorporateAction struct {
+	Date   string  `json:"date"`   // YYYYMMDD, first trading day on the new basis
+	Type   string  `json:"type"`   // "split", "reverse_split", "capital_change" or "dividend"
+	Factor float64 `json:"factor"` // e.g. 0.02 for a 50-for-1 split
+	Source string  `json:"source"` // "kis" when derived from KIS adjusted prices, "manual" when entered by hand
+}
+
 type IndexStruct struct {
 	IndexCode string
 	IndexName string
@@ -74,6 +102,18 @@ type IndexStruct struct {
 	LowerLimitCnt string `json:"lslm_issu_cnt"`
 }
 
+// IndexPriceStruct is one daily bar of a sector/market index
+type IndexPriceStruct struct {
+	Date   string `json:"stck_bsop_date"`
+	Close  string `json:"bstp_nmix_prpr"`
+	Open   string `json:"bstp_nmix_oprc"`
+	High   string `json:"bstp_nmix_hgpr"`
+	Low    string `json:"bstp_nmix_lwpr"`
+	Volume string `json:"acml_vol"`
+}
+
+type SliceIndexPriceStruct []IndexPriceStruct
+
 type StockSnapshot struct {
 	Code       string `json:"inter_shrn_iscd"`
 	Name       string `json:"inter_kor_isnm"`
@@ -182,6 +222,36 @@ type Order struct {
 	CreatedAt     string  `json:"created_at"`
 }
 
+// Backtest job statuses
+const (
+	BacktestJobQueued    = "QUEUED"
+	BacktestJobRunning   = "RUNNING"
+	BacktestJobDone      = "DONE"
+	BacktestJobFailed    = "FAILED"
+	BacktestJobCancelled = "CANCELLED"
+)
+
+// BacktestJob is an asynchronous backtest persisted in backtest_jobs. Trades and the equity
+// curve live in their own tables and are only loaded for a single job.
+type BacktestJob struct {
+	ID         int64                `json:"id"`
+	UserID     int64                `json:"user_id"`
+	Status     string               `json:"status"`
+	Progress   float64              `json:"progress"` // 0 to 1
+	Params     BacktestParams       `json:"params"`
+	Metrics    *BacktestMetrics     `json:"metrics,omitempty"`
+	Universe   []string             `json:"universe,omitempty"`
+	Benchmark  *BenchmarkComparison `json:"benchmark,omitempty"`
+	Error      string               `json:"error,omitempty"`
+	CreatedAt  time.Time            `json:"created_at"`
+	StartedAt  *time.Time           `json:"started_at,omitempty"`
+	FinishedAt *time.Time           `json:"finished_at,omitempty"`
+
+	Trades           []Trade             `json:"trades,omitempty"`
+	EquityCurve      *EquityCurve        `json:"equity_curve,omitempty"`
+	PortfolioHistory []PortfolioSnapshot `json:"portfolio_history,omitempty"`
+}
+
 // MinutePriceStruct for minute-by-minute stock data
 type MinutePriceStruct struct {
 	DateTime string `json:"stck_cntg_hour"` // YYYYMMDDHHMMSS format
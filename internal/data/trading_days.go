@@ -128,6 +128,35 @@ func AddTradingDays(date string, n int) (string, error) {
 	return instance.AddTradingDays(date, n)
 }
 
+// DaysInRange returns the trading days between from and to, inclusive, in order.
+func (tc *TradingCalendar) DaysInRange(from, to string) []string {
+    start := sort.SearchStrings(tc.days, from)
+    end := sort.SearchStrings(tc.days, to)
+
+    if end < len(tc.days) && tc.days[end] == to {
+        end++
+    }
+    if start >= end {
+        return nil
+    }
+
+    return append([]string(nil), tc.days[start:end]...)
+}
+
+// TradingDaysInRange returns the trading days between from and to, inclusive, in order.
+func TradingDaysInRange(from, to string) ([]string, error) {
+	path := os.Getenv("TRADING_DAYS_CSV")
+	if path == "" {
+		path = "weekdays.csv"
+	}
+	_, err := LoadTradingCalendar(path)
+	if err != nil {
+        return nil, fmt.Errorf("failed to load trading calendar: %w", err)
+    }
+
+	return instance.DaysInRange(from, to), nil
+}
+
 // NextTradingDay returns the next trading day after or equal the given date.
 func NextTradingDay(date string) (string, error) {
 	day, err := time.Parse("20060102", date)
@@ -8,10 +8,11 @@ import (
 )
 
 type WSMessage struct {
-	Type    string      `json:"type"`
-	Tickers []string    `json:"tickers,omitempty"`
-	Data    interface{} `json:"data,omitempty"`
-	Error   string      `json:"error,omitempty"`
+	Type       string      `json:"type"`
+	Tickers    []string    `json:"tickers,omitempty"`
+	Indicators string      `json:"indicators,omitempty"` // Specs to stream on subscribe, e.g. "rsi:14,ema:20"
+	Data       interface{} `json:"data,omitempty"`
+	Error      string      `json:"error,omitempty"`
 }
 
 type WSClient struct {
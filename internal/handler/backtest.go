@@ -2,10 +2,13 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/Paaaark/hanquant/internal/data"
+	"github.com/Paaaark/hanquant/internal/rules"
 	"github.com/Paaaark/hanquant/internal/service"
 )
 
@@ -27,11 +30,44 @@ func (h *BacktestHandler) RunSMABacktest(w http.ResponseWriter, r *http.Request)
 	}
 
 	// Parse query parameters
+	query := r.URL.Query()
 	params := data.BacktestParams{
-		From:      r.URL.Query().Get("from"),
-		To:        r.URL.Query().Get("to"),
-		SMA_short: h.parseIntParam(r.URL.Query().Get("sma_short"), 20),
-		SMA_long:  h.parseIntParam(r.URL.Query().Get("sma_long"), 50),
+		From:      query.Get("from"),
+		To:        query.Get("to"),
+		SMA_short: h.parseIntParam(query.Get("sma_short"), 20),
+		SMA_long:  h.parseIntParam(query.Get("sma_long"), 50),
+		Universe: data.UniverseSpec{
+			Sector: query.Get("sector"),
+			TopN:   h.parseIntParam(query.Get("top_n"), 0),
+		},
+		InitialCash: h.parseFloatParam(query.Get("initial_cash"), 0),
+		Sizing: data.SizingRule{
+			Method:    query.Get("sizing"),
+			Fraction:  h.parseFloatParam(query.Get("fraction"), 0),
+			Amount:    h.parseFloatParam(query.Get("amount"), 0),
+			TargetVol: h.parseFloatParam(query.Get("target_vol"), 0),
+			VolWindow: h.parseIntParam(query.Get("vol_window"), 0),
+		},
+		Benchmark:    query.Get("benchmark"),
+		RiskFreeRate: h.parseFloatParam(query.Get("risk_free_rate"), 0),
+		Interval:     h.parseIntParam(query.Get("interval"), 0),
+		FlatAtClose:  query.Get("flat_at_close") == "true",
+		Adjusted:     query.Get("adjusted") == "true",
+		Snapshots:    query.Get("snapshots"),
+	}
+	if tickers := query.Get("tickers"); tickers != "" {
+		params.Universe.Tickers = strings.Split(tickers, ",")
+	}
+	params.Costs = data.CostModel{
+		CommissionBps: h.parseOptionalFloatParam(query.Get("commission_bps")),
+		KOSPITaxBps:   h.parseOptionalFloatParam(query.Get("kospi_tax_bps")),
+		KOSDAQTaxBps:  h.parseOptionalFloatParam(query.Get("kosdaq_tax_bps")),
+		Slippage:      query.Get("slippage"),
+		SlippageBps:   h.parseOptionalFloatParam(query.Get("slippage_bps")),
+		ImpactBps:     h.parseOptionalFloatParam(query.Get("impact_bps")),
+	}
+	params.Execution = data.ExecutionModel{
+		MaxVolumeShare: h.parseOptionalFloatParam(query.Get("max_volume_share")),
 	}
 
 	// Run backtest
@@ -49,6 +85,216 @@ func (h *BacktestHandler) RunSMABacktest(w http.ResponseWriter, r *http.Request)
 	}
 }
 
+// RunBacktest handles the /backtest/run endpoint
+//
+// It accepts a JSON body naming a registered strategy and its parameters, e.g.
+// {"strategy":"sma_crossover","strategy_params":{"sma_short":10,"sma_long":30},"from":"20200101","to":"20241231"}
+// or a rule set in place of the strategy, e.g.
+// {"rules":"entry: sma(close,20) crosses_above sma(close,50); exit: close < entry_price*0.93","from":"20200101"}
+func (h *BacktestHandler) RunBacktest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var params data.BacktestParams
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		http.Error(w, "invalid JSON format", http.StatusBadRequest)
+		return
+	}
+	if params.Strategy == "" && params.Rules == "" {
+		http.Error(w, "strategy or rules is required", http.StatusBadRequest)
+		return
+	}
+	if params.Rules != "" {
+		if _, err := rules.Parse(params.Rules); err != nil {
+			writeRulesError(w, err)
+			return
+		}
+	}
+
+	// Run backtest
+	result, err := h.backtestService.RunBacktest(params)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return results as JSON
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		http.Error(w, "failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
+
+// Optimize handles the /backtest/optimize endpoint
+//
+// It accepts a JSON body with the base backtest and the parameter grid, e.g.
+// {"strategy":"sma_crossover","from":"20200101","to":"20241231","rank_by":"sharpe",
+//  "grid":[{"name":"sma_short","min":5,"max":30,"step":5},{"name":"sma_long","values":[40,60,90,120]}]}
+func (h *BacktestHandler) Optimize(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var params data.OptimizeParams
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		http.Error(w, "invalid JSON format", http.StatusBadRequest)
+		return
+	}
+	if len(params.Grid) == 0 {
+		http.Error(w, "grid is required", http.StatusBadRequest)
+		return
+	}
+	if params.Rules != "" {
+		http.Error(w, "rules cannot be optimized", http.StatusBadRequest)
+		return
+	}
+
+	result, err := h.backtestService.Optimize(params)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		http.Error(w, "failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
+
+// Compare handles the /backtest/compare endpoint
+//
+// It accepts the shared backtest settings and the strategies to run on them, e.g.
+// {"from":"20200101","to":"20241231","universe":{"tickers":["005930","000660"]},
+//  "strategies":[{"strategy":"sma_crossover","strategy_params":{"sma_short":20,"sma_long":50}},
+//  {"strategy":"sma_crossover","strategy_params":{"sma_short":10,"sma_long":30}},{"strategy":"buy_and_hold"}]}
+func (h *BacktestHandler) Compare(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var params data.CompareParams
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		http.Error(w, "invalid JSON format", http.StatusBadRequest)
+		return
+	}
+	if len(params.Strategies) == 0 {
+		http.Error(w, "strategies is required", http.StatusBadRequest)
+		return
+	}
+
+	result, err := h.backtestService.Compare(params)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		http.Error(w, "failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
+
+// WalkForward handles the /backtest/walkforward endpoint
+//
+// It accepts the same body as /backtest/optimize plus the fold layout, e.g.
+// {"strategy":"sma_crossover","from":"20180101","to":"20241231","mode":"rolling",
+//  "in_sample_days":252,"out_sample_days":63,"grid":[{"name":"sma_short","values":[5,10,20]},{"name":"sma_long","values":[50,100]}]}
+func (h *BacktestHandler) WalkForward(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var params data.WalkForwardParams
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		http.Error(w, "invalid JSON format", http.StatusBadRequest)
+		return
+	}
+	if len(params.Grid) == 0 {
+		http.Error(w, "grid is required", http.StatusBadRequest)
+		return
+	}
+	if params.Rules != "" {
+		http.Error(w, "rules cannot be optimized", http.StatusBadRequest)
+		return
+	}
+
+	result, err := h.backtestService.WalkForward(params)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		http.Error(w, "failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
+
+// CheckRules handles the /backtest/rules/check endpoint
+//
+// It parses {"rules":"..."} without running it and answers with the entry and exit conditions
+// in canonical form, or 400 with {"error":"...","line":1,"column":12} pointing at the problem.
+func (h *BacktestHandler) CheckRules(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var body struct {
+		Rules string `json:"rules"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "invalid JSON format", http.StatusBadRequest)
+		return
+	}
+
+	program, err := rules.Parse(body.Rules)
+	if err != nil {
+		writeRulesError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if err := json.NewEncoder(w).Encode(map[string]string{"entry": program.Entry(), "exit": program.Exit()}); err != nil {
+		http.Error(w, "failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
+
+// writeRulesError answers 400 with a rule parse error and its position as JSON
+func writeRulesError(w http.ResponseWriter, err error) {
+	var ruleError *rules.Error
+	if !errors.As(err, &ruleError) {
+		ruleError = &rules.Error{Message: err.Error()}
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(ruleError)
+}
+
+// ListStrategies handles the /backtest/strategies endpoint
+func (h *BacktestHandler) ListStrategies(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if err := json.NewEncoder(w).Encode(service.ListStrategies()); err != nil {
+		http.Error(w, "failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
+
 // parseParam parses an integer parameter with a default value
 func (h *BacktestHandler) parseIntParam(value string, defaultValue int) int {
 	if value == "" {
@@ -61,3 +307,29 @@ func (h *BacktestHandler) parseIntParam(value string, defaultValue int) int {
 	
 	return defaultValue
 }
+
+// parseFloatParam parses a float parameter with a default value
+func (h *BacktestHandler) parseFloatParam(value string, defaultValue float64) float64 {
+	if value == "" {
+		return defaultValue
+	}
+
+	if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+		return parsed
+	}
+
+	return defaultValue
+}
+
+// parseOptionalFloatParam parses a float parameter, returning nil when it is absent or invalid
+func (h *BacktestHandler) parseOptionalFloatParam(value string) *float64 {
+	if value == "" {
+		return nil
+	}
+
+	if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+		return &parsed
+	}
+
+	return nil
+}
@@ -0,0 +1,197 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Paaaark/hanquant/internal/data"
+	"github.com/Paaaark/hanquant/internal/service"
+)
+
+type BacktestJobHandler struct {
+	jobs *service.BacktestJobService
+}
+
+func NewBacktestJobHandler(jobs *service.BacktestJobService) *BacktestJobHandler {
+	return &BacktestJobHandler{jobs: jobs}
+}
+
+// Jobs handles /backtests
+//
+// POST enqueues a backtest with the same JSON body as /backtest/run and answers 202 with the job.
+// GET lists the caller's jobs, newest first; ?limit= caps the list (default 50).
+func (h *BacktestJobHandler) Jobs(w http.ResponseWriter, r *http.Request) {
+	userID, _, ok := requireJWT(w, r)
+	if !ok {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPost:
+		var params data.BacktestParams
+		if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+			http.Error(w, `{"error":{"code":"VALIDATION","message":"invalid JSON format"}}`, http.StatusBadRequest)
+			return
+		}
+		job, err := h.jobs.Submit(userID, params)
+		if err != nil {
+			writeJobError(w, "VALIDATION", err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(job)
+	case http.MethodGet:
+		limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+		jobs, err := h.jobs.List(userID, limit)
+		if err != nil {
+			writeJobError(w, "DB", err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if jobs == nil {
+			jobs = []data.BacktestJob{}
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		json.NewEncoder(w).Encode(jobs)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// Job handles /backtests/{id} (GET: status, metrics, trades and equity curve),
+// /backtests/{id}/cancel (POST: stop a queued or running job),
+// /backtests/{id}/robustness (POST: run a Monte Carlo analysis, GET: list stored ones)
+// and /backtests/{id}/{trades.csv|equity.csv|snapshots.jsonl|tearsheet.html} (GET: export a finished job)
+func (h *BacktestJobHandler) Job(w http.ResponseWriter, r *http.Request) {
+	userID, _, ok := requireJWT(w, r)
+	if !ok {
+		return
+	}
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	_, isExport := service.ExportContentTypes[parts[len(parts)-1]]
+	if len(parts) < 2 || len(parts) > 3 || (len(parts) == 3 && parts[2] != "cancel" && parts[2] != "robustness" && !isExport) {
+		http.Error(w, "invalid path", http.StatusNotFound)
+		return
+	}
+	jobID, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		writeJobError(w, "VALIDATION", "invalid backtest id", http.StatusBadRequest)
+		return
+	}
+	if len(parts) == 3 && parts[2] == "robustness" {
+		h.robustness(w, r, userID, jobID)
+		return
+	}
+	if len(parts) == 3 && isExport {
+		h.export(w, r, userID, jobID, parts[2])
+		return
+	}
+
+	var job *data.BacktestJob
+	switch {
+	case len(parts) == 2 && r.Method == http.MethodGet:
+		job, err = h.jobs.Get(userID, jobID)
+	case len(parts) == 3 && r.Method == http.MethodPost:
+		job, err = h.jobs.Cancel(userID, jobID)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if errors.Is(err, service.ErrJobNotFound) {
+		writeJobError(w, "NOT_FOUND", err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		writeJobError(w, "DB", err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(job)
+}
+
+// robustness runs or lists the robustness analyses of a job. The POST body is optional;
+// an empty one runs a 1000-path daily-return bootstrap with seed 0.
+func (h *BacktestJobHandler) robustness(w http.ResponseWriter, r *http.Request, userID, jobID int64) {
+	var result interface{}
+	var err error
+	switch r.Method {
+	case http.MethodPost:
+		var params data.RobustnessParams
+		if err := json.NewDecoder(r.Body).Decode(&params); err != nil && !errors.Is(err, io.EOF) {
+			writeJobError(w, "VALIDATION", "invalid JSON format", http.StatusBadRequest)
+			return
+		}
+		result, err = h.jobs.AnalyzeRobustness(userID, jobID, params)
+	case http.MethodGet:
+		var analyses []data.RobustnessAnalysis
+		analyses, err = h.jobs.ListRobustness(userID, jobID)
+		if analyses == nil {
+			analyses = []data.RobustnessAnalysis{}
+		}
+		result = analyses
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	switch {
+	case errors.Is(err, service.ErrJobNotFound):
+		writeJobError(w, "NOT_FOUND", err.Error(), http.StatusNotFound)
+		return
+	case errors.Is(err, service.ErrJobNotDone):
+		writeJobError(w, "NOT_DONE", err.Error(), http.StatusConflict)
+		return
+	case err != nil && r.Method == http.MethodPost:
+		writeJobError(w, "VALIDATION", err.Error(), http.StatusBadRequest)
+		return
+	case err != nil:
+		writeJobError(w, "DB", err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(result)
+}
+
+// export streams a finished job as a file. The tearsheet is served inline so it opens in the
+// browser; the other formats download under backtest-{id}-{format}.
+func (h *BacktestJobHandler) export(w http.ResponseWriter, r *http.Request, userID, jobID int64, format string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	job, err := h.jobs.Export(userID, jobID)
+	switch {
+	case errors.Is(err, service.ErrJobNotFound):
+		writeJobError(w, "NOT_FOUND", err.Error(), http.StatusNotFound)
+		return
+	case errors.Is(err, service.ErrJobNotDone):
+		writeJobError(w, "NOT_DONE", err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		writeJobError(w, "DB", err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", service.ExportContentTypes[format])
+	if format != service.ExportTearsheet {
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="backtest-%d-%s"`, jobID, format))
+	}
+	if err := service.WriteExport(w, job, format); err != nil {
+		log.Printf("backtest job %d: failed to export %s: %v", jobID, format, err)
+	}
+}
+
+// writeJobError writes the {"error":{"code":...,"message":...}} body used by the authenticated endpoints
+func writeJobError(w http.ResponseWriter, code, message string, status int) {
+	body, _ := json.Marshal(map[string]map[string]string{"error": {"code": code, "message": message}})
+	http.Error(w, string(body), status)
+}
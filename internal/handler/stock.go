@@ -5,11 +5,13 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/Paaaark/hanquant/internal/auth"
 	"github.com/Paaaark/hanquant/internal/data"
+	"github.com/Paaaark/hanquant/internal/indicators"
 	"github.com/Paaaark/hanquant/internal/service"
 	"github.com/Paaaark/hanquant/pkg/utils"
 )
@@ -72,6 +74,7 @@ func (h *StockHandler) GetHistoricalPrice(w http.ResponseWriter, r *http.Request
     from := r.URL.Query().Get("from")
     to := r.URL.Query().Get("to")
     duration := r.URL.Query().Get("duration")
+    adjusted := r.URL.Query().Get("adjusted") == "true"
 
 	fmt.Println("from: ", from)
 	fmt.Println("to: ", to)
@@ -82,7 +85,7 @@ func (h *StockHandler) GetHistoricalPrice(w http.ResponseWriter, r *http.Request
         return
     }
 
-    result, err := h.svc.GetHistoricalPrice(symbol, from, to, duration)
+    result, err := h.svc.GetHistoricalPrice(symbol, from, to, duration, adjusted)
     if err != nil {
         http.Error(w, err.Error(), http.StatusInternalServerError)
         return
@@ -180,6 +183,102 @@ func (h *StockHandler) GetIndexPrice(w http.ResponseWriter, r *http.Request) {
     w.Write(result.EncodeJSON())
 }
 
+// GetIndicators handles:
+//   GET /indicators/{symbol}?specs=rsi:14,ema:20,bbands:20:2&from=YYYYMMDD&to=YYYYMMDD
+func (h *StockHandler) GetIndicators(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	parts := strings.Split(r.URL.Path, "/")
+	if len(parts) < 3 || parts[2] == "" {
+		http.Error(w, "missing stock symbol in path", http.StatusBadRequest)
+		return
+	}
+	symbol := parts[2]
+
+	query := r.URL.Query()
+	specs, err := indicators.ParseSpecs(query.Get("specs"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	result, err := h.svc.GetIndicators(symbol, query.Get("from"), query.Get("to"), specs, query.Get("adjusted") == "true")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		http.Error(w, "failed to encode response", http.StatusInternalServerError)
+	}
+}
+
+// GetCorporateActions handles GET /corporate-actions/{symbol}: the splits, dividends and other
+// capital changes used to adjust the symbol's prices
+func (h *StockHandler) GetCorporateActions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	parts := strings.Split(r.URL.Path, "/")
+	if len(parts) < 3 || parts[2] == "" {
+		http.Error(w, "missing stock symbol in path", http.StatusBadRequest)
+		return
+	}
+
+	actions, err := h.svc.GetCorporateActions(parts[2])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if actions == nil {
+		actions = []data.CorporateAction{}
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if err := json.NewEncoder(w).Encode(actions); err != nil {
+		http.Error(w, "failed to encode response", http.StatusInternalServerError)
+	}
+}
+
+// GetListings handles /listings?date=YYYYMMDD&market=KOSDAQ: the common stocks listed on date,
+// including ones delisted since, from the listing history
+func (h *StockHandler) GetListings(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	query := r.URL.Query()
+	if query.Get("date") == "" {
+		http.Error(w, "missing date query parameter", http.StatusBadRequest)
+		return
+	}
+
+	stocks, err := service.ListedStocks(query.Get("market"), query.Get("date"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if stocks == nil {
+		stocks = []data.ListingRecord{}
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if err := json.NewEncoder(w).Encode(stocks); err != nil {
+		http.Error(w, "failed to encode response", http.StatusInternalServerError)
+	}
+}
+
+// accountClient is a KIS client for a linked account. Its calls end with the request and its
+// access tokens are kept in kis_access_tokens, so they outlive the request.
+func (h *StockHandler) accountClient(r *http.Request, ua *data.UserAccount, appKey, appSecret string) *data.KISClient {
+	kis := &data.KISClient{AppKey: appKey, AppSecret: appSecret}
+	return kis.WithContext(r.Context()).WithTokenStore(&data.AccountTokenStore{DB: h.DB, UserAccountID: ua.ID})
+}
+
 // GetAccountPortfolio handles:
 //   GET /accounts/{accNo}/portfolio
 func (h *StockHandler) GetAccountPortfolio(w http.ResponseWriter, r *http.Request) {
@@ -216,7 +315,7 @@ func (h *StockHandler) GetAccountPortfolio(w http.ResponseWriter, r *http.Reques
 	cano, _ := utils.Decrypt(string(ua.EncCANO))
 	appKey, _ := utils.Decrypt(string(ua.EncAppKey))
 	appSecret, _ := utils.Decrypt(string(ua.EncAppSecret))
-	kis := &data.KISClient{AppKey: appKey, AppSecret: appSecret}
+	kis := h.accountClient(r, ua, appKey, appSecret)
 	isMock := ua.IsMock
 	positions, summary, err := h.svc.GetAccountPortfolio(kis, cano, isMock)
 	if err != nil {
@@ -274,7 +373,7 @@ func (h *StockHandler) GetAccountPortfolioMock(w http.ResponseWriter, r *http.Re
 	cano, _ := utils.Decrypt(string(ua.EncCANO))
 	appKey, _ := utils.Decrypt(string(ua.EncAppKey))
 	appSecret, _ := utils.Decrypt(string(ua.EncAppSecret))
-	kis := &data.KISClient{AppKey: appKey, AppSecret: appSecret}
+	kis := h.accountClient(r, ua, appKey, appSecret)
 	isMock := ua.IsMock
 	positions, summary, err := h.svc.GetAccountPortfolio(kis, cano, isMock)
 	if err != nil {
@@ -327,7 +426,7 @@ func (h *StockHandler) GetPortfolio(w http.ResponseWriter, r *http.Request) {
 	cano, _ := utils.Decrypt(string(ua.EncCANO))
 	appKey, _ := utils.Decrypt(string(ua.EncAppKey))
 	appSecret, _ := utils.Decrypt(string(ua.EncAppSecret))
-	kis := &data.KISClient{AppKey: appKey, AppSecret: appSecret}
+	kis := h.accountClient(r, ua, appKey, appSecret)
 	isMock := ua.IsMock
 	positions, summary, err := h.svc.GetAccountPortfolio(kis, cano, isMock)
 	if err != nil {
@@ -359,6 +458,66 @@ func (h *StockHandler) GetPortfolio(w http.ResponseWriter, r *http.Request) {
 	w.Write(buf)
 }
 
+// Handler for GET /portfolio/risk
+//
+// Replays the account's current holdings over past closes and returns CAGR, volatility,
+// Sharpe/Sortino/Calmar, VaR/CVaR, drawdowns and period returns. Optional query params:
+// from, to (YYYYMMDD, default the last year) and risk_free_rate (annual fraction).
+func (h *StockHandler) GetPortfolioRisk(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	userID, _, ok := requireJWT(w, r)
+	if !ok {
+		return
+	}
+	query := r.URL.Query()
+	accountID := query.Get("account_id")
+	if accountID == "" {
+		http.Error(w, `{"error":{"code":"VALIDATION","message":"account_id required"}}`, http.StatusBadRequest)
+		return
+	}
+	riskFreeRate := 0.0
+	if value := query.Get("risk_free_rate"); value != "" {
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			http.Error(w, `{"error":{"code":"VALIDATION","message":"invalid risk_free_rate"}}`, http.StatusBadRequest)
+			return
+		}
+		riskFreeRate = parsed
+	}
+	// Find user account
+	accounts, err := data.GetUserAccountsByUserID(h.DB, userID)
+	if err != nil {
+		http.Error(w, `{"error":{"code":"DB","message":"`+err.Error()+`"}}`, http.StatusInternalServerError)
+		return
+	}
+	var ua *data.UserAccount
+	for i := range accounts {
+		if accounts[i].AccountID == accountID {
+			ua = &accounts[i]
+			break
+		}
+	}
+	if ua == nil {
+		http.Error(w, `{"error":{"code":"ACCOUNT_NOT_FOUND","message":"No linked account for user"}}`, http.StatusNotFound)
+		return
+	}
+	cano, _ := utils.Decrypt(string(ua.EncCANO))
+	appKey, _ := utils.Decrypt(string(ua.EncAppKey))
+	appSecret, _ := utils.Decrypt(string(ua.EncAppSecret))
+	kis := h.accountClient(r, ua, appKey, appSecret)
+	report, err := h.svc.GetPortfolioRisk(kis, cano, ua.IsMock, query.Get("from"), query.Get("to"), riskFreeRate)
+	if err != nil {
+		http.Error(w, `{"error":{"code":"KIS","message":"`+err.Error()+`"}}`, http.StatusInternalServerError)
+		return
+	}
+	report.AccountID = accountID
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(report)
+}
+
 // Handler for POST /orders
 func (h *StockHandler) PlaceOrder(w http.ResponseWriter, r *http.Request) {
 	userID, _, ok := requireJWT(w, r)
@@ -400,7 +559,7 @@ func (h *StockHandler) PlaceOrder(w http.ResponseWriter, r *http.Request) {
 	cano, _ := utils.Decrypt(string(ua.EncCANO))
 	appKey, _ := utils.Decrypt(string(ua.EncAppKey))
 	appSecret, _ := utils.Decrypt(string(ua.EncAppSecret))
-	kis := &data.KISClient{AppKey: appKey, AppSecret: appSecret}
+	kis := h.accountClient(r, ua, appKey, appSecret)
 	isMock := ua.IsMock
 	orderReq := data.OrderRequest{
 		Symbol:    req.Symbol,
@@ -518,7 +677,7 @@ func (h *StockHandler) BuyStock(w http.ResponseWriter, r *http.Request) {
 	cano, _ := utils.Decrypt(string(ua.EncCANO))
 	appKey, _ := utils.Decrypt(string(ua.EncAppKey))
 	appSecret, _ := utils.Decrypt(string(ua.EncAppSecret))
-	kis := &data.KISClient{AppKey: appKey, AppSecret: appSecret}
+	kis := h.accountClient(r, ua, appKey, appSecret)
 	resp, err := h.svc.PlaceOrder(kis, cano, req)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -567,7 +726,7 @@ func (h *StockHandler) SellStock(w http.ResponseWriter, r *http.Request) {
 	cano, _ := utils.Decrypt(string(ua.EncCANO))
 	appKey, _ := utils.Decrypt(string(ua.EncAppKey))
 	appSecret, _ := utils.Decrypt(string(ua.EncAppSecret))
-	kis := &data.KISClient{AppKey: appKey, AppSecret: appSecret}
+	kis := h.accountClient(r, ua, appKey, appSecret)
 	resp, err := h.svc.PlaceOrder(kis, cano, req)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
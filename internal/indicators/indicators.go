@@ -0,0 +1,152 @@
+// Package indicators implements technical indicators over data.StockData.
+//
+// Every indicator comes in two forms that produce identical numbers:
+//
+//   - a batch function (SMA, RSI, MACD, ...) that takes a whole oldest-first series and
+//     returns outputs aligned with the input bars, and
+//   - a stream type (SMAStream, RSIStream, ...) that is fed one bar at a time with Update,
+//     for live data such as the WebSocket feed.
+//
+// Outputs are math.NaN() until the indicator has seen enough bars; Lookback reports how
+// many bars that is. All streams satisfy the Indicator interface so callers can handle
+// them generically.
+package indicators
+
+import (
+	"math"
+
+	"github.com/Paaaark/hanquant/internal/data"
+)
+
+// Indicator is the common interface of all streams
+type Indicator interface {
+	// Update feeds the next bar, which must be newer than the previous one
+	Update(bar data.StockData)
+	// Values returns the current outputs in the order of Outputs, NaN while warming up
+	Values() []float64
+	// Outputs names the values, e.g. ["macd", "signal", "histogram"]
+	Outputs() []string
+	// Lookback is the number of bars consumed before every output is defined
+	Lookback() int
+}
+
+// rolling keeps the last n values of a series and their running sums
+type rolling struct {
+	buf   []float64
+	pos   int
+	count int
+	sum   float64
+	sumSq float64
+}
+
+func newRolling(n int) *rolling {
+	return &rolling{buf: make([]float64, n)}
+}
+
+// push appends v, evicting the oldest value once the window is full
+func (r *rolling) push(v float64) {
+	if r.count == len(r.buf) {
+		old := r.buf[r.pos]
+		r.sum -= old
+		r.sumSq -= old * old
+	} else {
+		r.count++
+	}
+	r.buf[r.pos] = v
+	r.pos = (r.pos + 1) % len(r.buf)
+	r.sum += v
+	r.sumSq += v * v
+}
+
+func (r *rolling) full() bool {
+	return r.count == len(r.buf)
+}
+
+func (r *rolling) mean() float64 {
+	return r.sum / float64(r.count)
+}
+
+// stdDev is the population standard deviation of the window
+func (r *rolling) stdDev() float64 {
+	mean := r.mean()
+	return math.Sqrt(math.Max(r.sumSq/float64(r.count)-mean*mean, 0))
+}
+
+// minMax scans the window for its lowest and highest value
+func (r *rolling) minMax() (float64, float64) {
+	lo, hi := math.Inf(1), math.Inf(-1)
+	for i := 0; i < r.count; i++ {
+		lo = math.Min(lo, r.buf[i])
+		hi = math.Max(hi, r.buf[i])
+	}
+	return lo, hi
+}
+
+// smaCore is a simple moving average over plain values
+type smaCore struct {
+	window *rolling
+}
+
+func newSMACore(period int) *smaCore {
+	return &smaCore{window: newRolling(period)}
+}
+
+func (s *smaCore) add(v float64) float64 {
+	s.window.push(v)
+	if !s.window.full() {
+		return math.NaN()
+	}
+	return s.window.mean()
+}
+
+// emaCore is an exponential moving average seeded with the simple average of the first period values
+type emaCore struct {
+	period int
+	alpha  float64
+	count  int
+	sum    float64
+	value  float64
+}
+
+func newEMACore(period int, alpha float64) *emaCore {
+	return &emaCore{period: period, alpha: alpha}
+}
+
+func (e *emaCore) add(v float64) float64 {
+	e.count++
+	if e.count < e.period {
+		e.sum += v
+		return math.NaN()
+	}
+	if e.count == e.period {
+		e.value = (e.sum + v) / float64(e.period)
+		return e.value
+	}
+	e.value += e.alpha * (v - e.value)
+	return e.value
+}
+
+// wilderCore is Wilder's smoothing (an EMA with alpha 1/period) seeded with the simple average
+func newWilderCore(period int) *emaCore {
+	return newEMACore(period, 1/float64(period))
+}
+
+// trueRange of bar given the previous close
+func trueRange(bar data.StockData, prevClose float64) float64 {
+	return math.Max(bar.High-bar.Low, math.Max(math.Abs(bar.High-prevClose), math.Abs(bar.Low-prevClose)))
+}
+
+// batch feeds bars through a fresh stream and collects Values after every bar, one slice per output
+func batch(stream Indicator, bars []data.StockData) [][]float64 {
+	outputs := make([][]float64, len(stream.Outputs()))
+	for i := range outputs {
+		outputs[i] = make([]float64, len(bars))
+	}
+	for i, bar := range bars {
+		stream.Update(bar)
+		for j, v := range stream.Values() {
+			outputs[j][i] = v
+		}
+	}
+	return outputs
+}
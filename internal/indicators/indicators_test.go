@@ -0,0 +1,189 @@
+package indicators
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/Paaaark/hanquant/internal/data"
+)
+
+var nan = math.NaN()
+
+// referenceBars is a short OHLCV series small enough to work every indicator out by hand
+func referenceBars() []data.StockData {
+	highs := []float64{12, 13, 14, 13, 15, 16, 15, 17}
+	lows := []float64{9, 10, 11, 10, 11, 13, 12, 13}
+	closes := []float64{10, 12, 13, 11, 14, 15, 13, 16}
+	volumes := []int64{100, 200, 150, 300, 250, 100, 200, 400}
+
+	bars := make([]data.StockData, len(closes))
+	for i := range closes {
+		bars[i] = data.StockData{
+			Date:   time.Date(2024, 1, 2+i, 0, 0, 0, 0, time.UTC),
+			Open:   closes[i],
+			High:   highs[i],
+			Low:    lows[i],
+			Close:  closes[i],
+			Volume: volumes[i],
+		}
+	}
+	return bars
+}
+
+// closeBars wraps closes in bars whose high, low and open equal the close
+func closeBars(closes []float64) []data.StockData {
+	bars := make([]data.StockData, len(closes))
+	for i, c := range closes {
+		bars[i] = data.StockData{Date: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC).AddDate(0, 0, i), Open: c, High: c, Low: c, Close: c}
+	}
+	return bars
+}
+
+// syntheticBars is a longer oscillating series with a drift, gaps and varying volume
+func syntheticBars(n int) []data.StockData {
+	bars := make([]data.StockData, n)
+	for i := range bars {
+		x := float64(i)
+		c := 100 + 0.3*x + 8*math.Sin(x/5) + 3*math.Cos(x/2.3)
+		bars[i] = data.StockData{
+			Date:   time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC).AddDate(0, 0, i),
+			Open:   c - math.Sin(x),
+			High:   c + 1.5 + math.Abs(math.Sin(x*1.7)),
+			Low:    c - 1.5 - math.Abs(math.Cos(x*1.3)),
+			Close:  c,
+			Volume: int64(1000 + 400*math.Sin(x/3) + 100*float64(i%7)),
+		}
+	}
+	return bars
+}
+
+func assertSeries(t *testing.T, name string, got, want []float64, tolerance float64) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("%s: got %d values, want %d", name, len(got), len(want))
+	}
+	for i := range want {
+		switch {
+		case math.IsNaN(want[i]) && math.IsNaN(got[i]):
+		case math.IsNaN(want[i]) || math.IsNaN(got[i]) || math.Abs(got[i]-want[i]) > tolerance:
+			t.Errorf("%s[%d] = %v, want %v", name, i, got[i], want[i])
+		}
+	}
+}
+
+func TestIndicatorsReferenceValues(t *testing.T) {
+	bars := referenceBars()
+	macd := MACD(bars, 2, 4, 2)
+	bands := BollingerBands(bars, 3, 2)
+	stoch := Stochastic(bars, 3, 2)
+	adx := ADX(bars, 3)
+
+	tests := []struct {
+		name string
+		got  []float64
+		want []float64
+	}{
+		{"SMA(3)", SMA(bars, 3), []float64{nan, nan, 11.6666666667, 12, 12.6666666667, 13.3333333333, 14, 14.6666666667}},
+		{"EMA(3)", EMA(bars, 3), []float64{nan, nan, 11.6666666667, 11.3333333333, 12.6666666667, 13.8333333333, 13.4166666667, 14.7083333333}},
+		{"WMA(3)", WMA(bars, 3), []float64{nan, nan, 12.1666666667, 11.8333333333, 12.8333333333, 14, 13.8333333333, 14.8333333333}},
+		{"RSI(3)", RSI(bars, 3), []float64{nan, nan, nan, 60, 78.9473684211, 82.9787234043, 52.7027027027, 74.025974026}},
+		{"MACD(2,4,2).MACD", macd.MACD, []float64{nan, nan, nan, -0.0555555556, 0.6481481481, 0.8827160494, 0.1609053498, 0.7736351166}},
+		{"MACD(2,4,2).Signal", macd.Signal, []float64{nan, nan, nan, nan, 0.2962962963, 0.6872427984, 0.336351166, 0.6278737997}},
+		{"MACD(2,4,2).Histogram", macd.Histogram, []float64{nan, nan, nan, nan, 0.3518518519, 0.195473251, -0.1754458162, 0.1457613169}},
+		{"BollingerBands(3,2).Upper", bands.Upper, []float64{nan, nan, 14.1611049245, 13.6329931619, 15.1611049245, 16.7326796757, 15.6329931619, 17.1611049245}},
+		{"BollingerBands(3,2).Middle", bands.Middle, []float64{nan, nan, 11.6666666667, 12, 12.6666666667, 13.3333333333, 14, 14.6666666667}},
+		{"BollingerBands(3,2).Lower", bands.Lower, []float64{nan, nan, 9.1722284088, 10.3670068381, 10.1722284088, 9.9339869909, 12.3670068381, 12.1722284088}},
+		{"ATR(3)", ATR(bars, 3), []float64{nan, nan, nan, 3, 3.3333333333, 3.2222222222, 3.1481481481, 3.4320987654}},
+		{"Stochastic(3,2).K", stoch.K, []float64{nan, nan, 80, 25, 80, 83.3333333333, 40, 80}},
+		{"Stochastic(3,2).D", stoch.D, []float64{nan, nan, nan, 52.5, 52.5, 81.6666666667, 61.6666666667, 60}},
+		{"OBV", OBV(bars), []float64{0, 200, 350, 50, 300, 400, 200, 600}},
+		{"VWAP(0)", VWAP(bars, 0), []float64{10.3333333333, 11.2222222222, 11.7037037037, 11.5555555556, 12, 12.2424242424, 12.4102564103, 13.0980392157}},
+		{"VWAP(3)", VWAP(bars, 3), []float64{nan, nan, 11.7037037037, 11.7435897436, 12.3333333333, 12.6153846154, 13.5757575758, 14.6666666667}},
+		{"ADX(3).ADX", adx.ADX, []float64{nan, nan, nan, nan, nan, 58.5858585859, 47.3009666558, 51.457349418}},
+		{"ADX(3).PlusDI", adx.PlusDI, []float64{nan, nan, nan, 22.2222222222, 33.3333333333, 33.3333333333, 22.7450980392, 33.3333333333}},
+		{"ADX(3).MinusDI", adx.MinusDI, []float64{nan, nan, nan, 11.1111111111, 6.6666666667, 4.5977011494, 13.7254901961, 8.3932853717}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assertSeries(t, tt.name, tt.got, tt.want, 1e-9)
+		})
+	}
+}
+
+// The 14-day RSI example of Wilder's method published by StockCharts. Their table rounds the
+// average gain and loss to two decimals, which moves its RSI (70.53, 66.32, ...) by under 0.1.
+func TestRSIWilderExample(t *testing.T) {
+	bars := closeBars([]float64{
+		44.34, 44.09, 44.15, 43.61, 44.33, 44.83, 45.10, 45.42, 45.84, 46.08,
+		45.89, 46.03, 45.61, 46.28, 46.28, 46.00, 46.03, 46.41, 46.22, 45.64,
+	})
+	want := make([]float64, len(bars))
+	for i := 0; i < 14; i++ {
+		want[i] = nan
+	}
+	copy(want[14:], []float64{70.4641, 66.2496, 66.4809, 69.3469, 66.2947, 57.9150})
+	assertSeries(t, "RSI(14)", RSI(bars, 14), want, 1e-4)
+}
+
+func TestIndicatorsFlatSeries(t *testing.T) {
+	bars := closeBars([]float64{50, 50, 50, 50, 50, 50})
+
+	assertSeries(t, "RSI(3)", RSI(bars, 3), []float64{nan, nan, nan, 50, 50, 50}, 0)
+	assertSeries(t, "Stochastic(3,1).K", Stochastic(bars, 3, 1).K, []float64{nan, nan, 50, 50, 50, 50}, 0)
+	assertSeries(t, "BollingerBands(3,2).Upper", BollingerBands(bars, 3, 2).Upper, []float64{nan, nan, 50, 50, 50, 50}, 0)
+	assertSeries(t, "ATR(3)", ATR(bars, 3), []float64{nan, nan, nan, 0, 0, 0}, 0)
+	// Without volume there is no price to average
+	assertSeries(t, "VWAP(0)", VWAP(bars, 0), []float64{nan, nan, nan, nan, nan, nan}, 0)
+}
+
+// Streams fed bar by bar must reproduce the batch series exactly and warm up in Lookback bars
+func TestStreamingMatchesBatch(t *testing.T) {
+	bars := syntheticBars(120)
+	tests := []struct {
+		name   string
+		stream Indicator
+		batch  [][]float64
+	}{
+		{"SMA(10)", NewSMAStream(10), [][]float64{SMA(bars, 10)}},
+		{"EMA(12)", NewEMAStream(12), [][]float64{EMA(bars, 12)}},
+		{"WMA(9)", NewWMAStream(9), [][]float64{WMA(bars, 9)}},
+		{"RSI(14)", NewRSIStream(14), [][]float64{RSI(bars, 14)}},
+		{"MACD(12,26,9)", NewMACDStream(12, 26, 9), [][]float64{MACD(bars, 12, 26, 9).MACD, MACD(bars, 12, 26, 9).Signal, MACD(bars, 12, 26, 9).Histogram}},
+		{"BollingerBands(20,2)", NewBollingerStream(20, 2), [][]float64{BollingerBands(bars, 20, 2).Upper, BollingerBands(bars, 20, 2).Middle, BollingerBands(bars, 20, 2).Lower}},
+		{"ATR(14)", NewATRStream(14), [][]float64{ATR(bars, 14)}},
+		{"Stochastic(14,3)", NewStochasticStream(14, 3), [][]float64{Stochastic(bars, 14, 3).K, Stochastic(bars, 14, 3).D}},
+		{"OBV", NewOBVStream(), [][]float64{OBV(bars)}},
+		{"VWAP(0)", NewVWAPStream(0), [][]float64{VWAP(bars, 0)}},
+		{"VWAP(20)", NewVWAPStream(20), [][]float64{VWAP(bars, 20)}},
+		{"ADX(14)", NewADXStream(14), [][]float64{ADX(bars, 14).ADX, ADX(bars, 14).PlusDI, ADX(bars, 14).MinusDI}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stream := tt.stream
+			if len(stream.Outputs()) != len(tt.batch) {
+				t.Fatalf("%d outputs, want %d", len(stream.Outputs()), len(tt.batch))
+			}
+
+			firstDefined := -1
+			for i, bar := range bars {
+				stream.Update(bar)
+				defined := true
+				for j, v := range stream.Values() {
+					w := tt.batch[j][i]
+					if math.IsNaN(v) != math.IsNaN(w) || (!math.IsNaN(v) && v != w) {
+						t.Fatalf("%s at bar %d: stream %v, batch %v", stream.Outputs()[j], i, v, w)
+					}
+					defined = defined && !math.IsNaN(v)
+				}
+				if defined && firstDefined < 0 {
+					firstDefined = i
+				}
+			}
+			if firstDefined != stream.Lookback() {
+				t.Errorf("first complete output at bar %d, Lookback is %d", firstDefined, stream.Lookback())
+			}
+		})
+	}
+}
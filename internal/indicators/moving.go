@@ -0,0 +1,94 @@
+package indicators
+
+import (
+	"math"
+
+	"github.com/Paaaark/hanquant/internal/data"
+)
+
+// SMAStream is the simple moving average of closes
+type SMAStream struct {
+	period int
+	core   *smaCore
+	value  float64
+}
+
+// NewSMAStream creates an SMA over period bars
+func NewSMAStream(period int) *SMAStream {
+	return &SMAStream{period: period, core: newSMACore(period), value: math.NaN()}
+}
+
+func (s *SMAStream) Update(bar data.StockData) { s.value = s.core.add(bar.Close) }
+func (s *SMAStream) Value() float64            { return s.value }
+func (s *SMAStream) Values() []float64         { return []float64{s.value} }
+func (s *SMAStream) Outputs() []string         { return []string{"sma"} }
+func (s *SMAStream) Lookback() int             { return s.period - 1 }
+
+// SMA returns the simple moving average of closes, aligned with bars
+func SMA(bars []data.StockData, period int) []float64 {
+	return batch(NewSMAStream(period), bars)[0]
+}
+
+// EMAStream is the exponential moving average of closes with alpha 2/(period+1),
+// seeded with the SMA of the first period closes
+type EMAStream struct {
+	period int
+	core   *emaCore
+	value  float64
+}
+
+// NewEMAStream creates an EMA over period bars
+func NewEMAStream(period int) *EMAStream {
+	return &EMAStream{period: period, core: newEMACore(period, 2/float64(period+1)), value: math.NaN()}
+}
+
+func (e *EMAStream) Update(bar data.StockData) { e.value = e.core.add(bar.Close) }
+func (e *EMAStream) Value() float64            { return e.value }
+func (e *EMAStream) Values() []float64         { return []float64{e.value} }
+func (e *EMAStream) Outputs() []string         { return []string{"ema"} }
+func (e *EMAStream) Lookback() int             { return e.period - 1 }
+
+// EMA returns the exponential moving average of closes, aligned with bars
+func EMA(bars []data.StockData, period int) []float64 {
+	return batch(NewEMAStream(period), bars)[0]
+}
+
+// WMAStream is the linearly weighted moving average of closes; the newest close weighs period,
+// the oldest 1. The weighted sum is updated in O(1) per bar.
+type WMAStream struct {
+	period   int
+	window   *rolling
+	weighted float64 // sum of weight * close over the window
+	value    float64
+}
+
+// NewWMAStream creates a WMA over period bars
+func NewWMAStream(period int) *WMAStream {
+	return &WMAStream{period: period, window: newRolling(period), value: math.NaN()}
+}
+
+func (w *WMAStream) Update(bar data.StockData) {
+	if w.window.full() {
+		// Every weight drops by one, which removes the plain sum; the oldest value had weight 1
+		w.weighted -= w.window.sum
+		w.window.push(bar.Close)
+		w.weighted += float64(w.period) * bar.Close
+	} else {
+		w.window.push(bar.Close)
+		w.weighted += float64(w.window.count) * bar.Close
+	}
+
+	if w.window.full() {
+		w.value = w.weighted / float64(w.period*(w.period+1)/2)
+	}
+}
+
+func (w *WMAStream) Value() float64    { return w.value }
+func (w *WMAStream) Values() []float64 { return []float64{w.value} }
+func (w *WMAStream) Outputs() []string { return []string{"wma"} }
+func (w *WMAStream) Lookback() int     { return w.period - 1 }
+
+// WMA returns the weighted moving average of closes, aligned with bars
+func WMA(bars []data.StockData, period int) []float64 {
+	return batch(NewWMAStream(period), bars)[0]
+}
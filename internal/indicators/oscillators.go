@@ -0,0 +1,175 @@
+package indicators
+
+import (
+	"math"
+
+	"github.com/Paaaark/hanquant/internal/data"
+)
+
+// RSIStream is Wilder's relative strength index of closes
+type RSIStream struct {
+	period    int
+	gain      *emaCore
+	loss      *emaCore
+	prevClose float64
+	started   bool
+	value     float64
+}
+
+// NewRSIStream creates an RSI over period close-to-close changes
+func NewRSIStream(period int) *RSIStream {
+	return &RSIStream{period: period, gain: newWilderCore(period), loss: newWilderCore(period), value: math.NaN()}
+}
+
+func (r *RSIStream) Update(bar data.StockData) {
+	if !r.started {
+		r.started = true
+		r.prevClose = bar.Close
+		return
+	}
+	change := bar.Close - r.prevClose
+	r.prevClose = bar.Close
+
+	avgGain := r.gain.add(math.Max(change, 0))
+	avgLoss := r.loss.add(math.Max(-change, 0))
+	switch {
+	case math.IsNaN(avgGain):
+		r.value = math.NaN()
+	case avgLoss == 0 && avgGain == 0:
+		r.value = 50
+	case avgLoss == 0:
+		r.value = 100
+	default:
+		r.value = 100 - 100/(1+avgGain/avgLoss)
+	}
+}
+
+func (r *RSIStream) Value() float64    { return r.value }
+func (r *RSIStream) Values() []float64 { return []float64{r.value} }
+func (r *RSIStream) Outputs() []string { return []string{"rsi"} }
+func (r *RSIStream) Lookback() int     { return r.period }
+
+// RSI returns the relative strength index of closes, aligned with bars
+func RSI(bars []data.StockData, period int) []float64 {
+	return batch(NewRSIStream(period), bars)[0]
+}
+
+// MACDValue is one output of MACD
+type MACDValue struct {
+	MACD      float64 // fast EMA - slow EMA
+	Signal    float64 // EMA of MACD
+	Histogram float64 // MACD - Signal
+}
+
+// MACDStream is the moving average convergence/divergence of closes
+type MACDStream struct {
+	fastPeriod, slowPeriod, signalPeriod int
+	fast, slow, signal                   *emaCore
+	value                                MACDValue
+}
+
+// NewMACDStream creates a MACD; the usual periods are 12, 26 and 9
+func NewMACDStream(fast, slow, signal int) *MACDStream {
+	return &MACDStream{
+		fastPeriod:   fast,
+		slowPeriod:   slow,
+		signalPeriod: signal,
+		fast:         newEMACore(fast, 2/float64(fast+1)),
+		slow:         newEMACore(slow, 2/float64(slow+1)),
+		signal:       newEMACore(signal, 2/float64(signal+1)),
+		value:        MACDValue{math.NaN(), math.NaN(), math.NaN()},
+	}
+}
+
+func (m *MACDStream) Update(bar data.StockData) {
+	fast := m.fast.add(bar.Close)
+	slow := m.slow.add(bar.Close)
+	if math.IsNaN(fast) || math.IsNaN(slow) {
+		return
+	}
+	// The signal line starts with the first defined MACD value
+	m.value.MACD = fast - slow
+	m.value.Signal = m.signal.add(m.value.MACD)
+	m.value.Histogram = m.value.MACD - m.value.Signal
+}
+
+func (m *MACDStream) Value() MACDValue { return m.value }
+func (m *MACDStream) Values() []float64 {
+	return []float64{m.value.MACD, m.value.Signal, m.value.Histogram}
+}
+func (m *MACDStream) Outputs() []string { return []string{"macd", "signal", "histogram"} }
+func (m *MACDStream) Lookback() int {
+	return max(m.fastPeriod, m.slowPeriod) - 1 + m.signalPeriod - 1
+}
+
+// MACDSeries holds the batch MACD outputs aligned with the input bars
+type MACDSeries struct {
+	MACD      []float64
+	Signal    []float64
+	Histogram []float64
+}
+
+// MACD returns the MACD line, signal line and histogram of closes
+func MACD(bars []data.StockData, fast, slow, signal int) MACDSeries {
+	outputs := batch(NewMACDStream(fast, slow, signal), bars)
+	return MACDSeries{MACD: outputs[0], Signal: outputs[1], Histogram: outputs[2]}
+}
+
+// StochasticValue is one output of the stochastic oscillator
+type StochasticValue struct {
+	K float64 // Where the close sits in the high-low range of the last kPeriod bars, 0-100
+	D float64 // SMA of K over dPeriod bars
+}
+
+// StochasticStream is the fast stochastic oscillator. When the range is flat K is 50.
+type StochasticStream struct {
+	kPeriod, dPeriod int
+	highs, lows      *rolling
+	d                *smaCore
+	value            StochasticValue
+}
+
+// NewStochasticStream creates a stochastic oscillator; the usual periods are 14 and 3
+func NewStochasticStream(kPeriod, dPeriod int) *StochasticStream {
+	return &StochasticStream{
+		kPeriod: kPeriod,
+		dPeriod: dPeriod,
+		highs:   newRolling(kPeriod),
+		lows:    newRolling(kPeriod),
+		d:       newSMACore(dPeriod),
+		value:   StochasticValue{math.NaN(), math.NaN()},
+	}
+}
+
+func (s *StochasticStream) Update(bar data.StockData) {
+	s.highs.push(bar.High)
+	s.lows.push(bar.Low)
+	if !s.highs.full() {
+		return
+	}
+	lowest, _ := s.lows.minMax()
+	_, highest := s.highs.minMax()
+	if highest == lowest {
+		s.value.K = 50
+	} else {
+		s.value.K = (bar.Close - lowest) / (highest - lowest) * 100
+	}
+	s.value.D = s.d.add(s.value.K)
+}
+
+func (s *StochasticStream) Value() StochasticValue { return s.value }
+func (s *StochasticStream) Values() []float64      { return []float64{s.value.K, s.value.D} }
+func (s *StochasticStream) Outputs() []string      { return []string{"k", "d"} }
+func (s *StochasticStream) Lookback() int          { return s.kPeriod - 1 + s.dPeriod - 1 }
+
+// StochasticSeries holds the batch stochastic outputs aligned with the input bars
+type StochasticSeries struct {
+	K []float64
+	D []float64
+}
+
+// Stochastic returns %K and %D, aligned with bars
+func Stochastic(bars []data.StockData, kPeriod, dPeriod int) StochasticSeries {
+	outputs := batch(NewStochasticStream(kPeriod, dPeriod), bars)
+	return StochasticSeries{K: outputs[0], D: outputs[1]}
+}
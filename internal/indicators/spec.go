@@ -0,0 +1,112 @@
+package indicators
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Spec is a parsed indicator request such as "rsi:14" or "bbands:20:2"
+type Spec struct {
+	Raw    string
+	Name   string
+	Params []float64
+}
+
+// specDefinition describes one indicator name accepted by ParseSpecs
+type specDefinition struct {
+	defaults []float64 // also fixes the maximum number of params
+	integer  []bool    // whether each param must be a whole number
+	build    func(p []float64) Indicator
+}
+
+var specDefinitions = map[string]specDefinition{
+	"sma":    {[]float64{20}, []bool{true}, func(p []float64) Indicator { return NewSMAStream(int(p[0])) }},
+	"ema":    {[]float64{20}, []bool{true}, func(p []float64) Indicator { return NewEMAStream(int(p[0])) }},
+	"wma":    {[]float64{20}, []bool{true}, func(p []float64) Indicator { return NewWMAStream(int(p[0])) }},
+	"rsi":    {[]float64{14}, []bool{true}, func(p []float64) Indicator { return NewRSIStream(int(p[0])) }},
+	"atr":    {[]float64{14}, []bool{true}, func(p []float64) Indicator { return NewATRStream(int(p[0])) }},
+	"adx":    {[]float64{14}, []bool{true}, func(p []float64) Indicator { return NewADXStream(int(p[0])) }},
+	"obv":    {nil, nil, func(p []float64) Indicator { return NewOBVStream() }},
+	"bbands": {[]float64{20, 2}, []bool{true, false}, func(p []float64) Indicator { return NewBollingerStream(int(p[0]), p[1]) }},
+	"stoch":  {[]float64{14, 3}, []bool{true, true}, func(p []float64) Indicator { return NewStochasticStream(int(p[0]), int(p[1])) }},
+	"macd": {[]float64{12, 26, 9}, []bool{true, true, true}, func(p []float64) Indicator {
+		return NewMACDStream(int(p[0]), int(p[1]), int(p[2]))
+	}},
+	// A VWAP period of 0 accumulates over the whole series
+	"vwap": {[]float64{0}, []bool{true}, func(p []float64) Indicator { return NewVWAPStream(int(p[0])) }},
+}
+
+// ParseSpecs parses a comma-separated list of specs like "rsi:14,ema:20,bbands:20:2".
+// Omitted params take the usual defaults, e.g. "macd" is "macd:12:26:9".
+func ParseSpecs(list string) ([]Spec, error) {
+	var specs []Spec
+	for _, raw := range strings.Split(list, ",") {
+		raw = strings.TrimSpace(raw)
+		if raw == "" {
+			continue
+		}
+		spec, err := ParseSpec(raw)
+		if err != nil {
+			return nil, err
+		}
+		specs = append(specs, spec)
+	}
+	if len(specs) == 0 {
+		return nil, fmt.Errorf("no indicators requested")
+	}
+	return specs, nil
+}
+
+// ParseSpec parses a single spec like "bbands:20:2"
+func ParseSpec(raw string) (Spec, error) {
+	parts := strings.Split(raw, ":")
+	name := strings.ToLower(strings.TrimSpace(parts[0]))
+	definition, ok := specDefinitions[name]
+	if !ok {
+		return Spec{}, fmt.Errorf("unknown indicator %q", parts[0])
+	}
+	if len(parts)-1 > len(definition.defaults) {
+		return Spec{}, fmt.Errorf("%s takes at most %d params", name, len(definition.defaults))
+	}
+
+	params := append([]float64(nil), definition.defaults...)
+	for i, part := range parts[1:] {
+		value, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil || math.IsNaN(value) || math.IsInf(value, 0) || value < 0 {
+			return Spec{}, fmt.Errorf("%s: invalid param %q", name, part)
+		}
+		// vwap:0 is the cumulative VWAP, every other period starts at 1
+		minimum := 1.0
+		if name == "vwap" {
+			minimum = 0
+		}
+		if definition.integer[i] && (value != math.Trunc(value) || value < minimum) {
+			return Spec{}, fmt.Errorf("%s: param %q must be an integer of at least %v", name, part, minimum)
+		}
+		if value > 1000 {
+			return Spec{}, fmt.Errorf("%s: param %q is too large", name, part)
+		}
+		params[i] = value
+	}
+	if name == "macd" && params[0] >= params[1] {
+		return Spec{}, fmt.Errorf("macd: fast period must be shorter than slow period")
+	}
+
+	return Spec{Raw: raw, Name: name, Params: params}, nil
+}
+
+// New creates a fresh stream for the spec
+func (s Spec) New() Indicator {
+	return specDefinitions[s.Name].build(s.Params)
+}
+
+// Key is a canonical name for the spec with defaults filled in, e.g. "bbands_20_2"
+func (s Spec) Key() string {
+	parts := []string{s.Name}
+	for _, p := range s.Params {
+		parts = append(parts, strconv.FormatFloat(p, 'f', -1, 64))
+	}
+	return strings.Join(parts, "_")
+}
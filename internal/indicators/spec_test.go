@@ -0,0 +1,42 @@
+package indicators
+
+import "testing"
+
+func TestParseSpec(t *testing.T) {
+	tests := []struct {
+		raw     string
+		key     string
+		wantErr bool
+	}{
+		{raw: "rsi", key: "rsi_14"},
+		{raw: "MACD", key: "macd_12_26_9"},
+		{raw: "bbands:10", key: "bbands_10_2"},
+		{raw: "bbands:20:2.5", key: "bbands_20_2.5"},
+		{raw: "vwap:0", key: "vwap_0"},
+		{raw: "obv", key: "obv"},
+		{raw: "sma:0", wantErr: true},
+		{raw: "sma:2.5", wantErr: true},
+		{raw: "sma:5:5", wantErr: true},
+		{raw: "rsi:-3", wantErr: true},
+		{raw: "ema:5000", wantErr: true},
+		{raw: "macd:26:12", wantErr: true},
+		{raw: "obv:3", wantErr: true},
+		{raw: "kama:10", wantErr: true},
+	}
+	for _, tt := range tests {
+		spec, err := ParseSpec(tt.raw)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParseSpec(%q) = %v, want an error", tt.raw, spec)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseSpec(%q): %v", tt.raw, err)
+			continue
+		}
+		if spec.Key() != tt.key {
+			t.Errorf("ParseSpec(%q).Key() = %q, want %q", tt.raw, spec.Key(), tt.key)
+		}
+	}
+}
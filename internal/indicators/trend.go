@@ -0,0 +1,103 @@
+package indicators
+
+import (
+	"math"
+
+	"github.com/Paaaark/hanquant/internal/data"
+)
+
+// ADXValue is one output of ADX
+type ADXValue struct {
+	ADX     float64 // Trend strength, 0-100
+	PlusDI  float64 // +DI, defined from bar period on
+	MinusDI float64 // -DI, defined from bar period on
+}
+
+// ADXStream is Wilder's average directional index. +DM, -DM and TR are smoothed with
+// Wilder's running sums; ADX is the Wilder average of DX, so it needs 2*period-1 bars.
+type ADXStream struct {
+	period  int
+	count   int // bars seen after the first
+	started bool
+	prev    data.StockData
+
+	sumTR, sumPlus, sumMinus float64
+	dx                       *emaCore
+	value                    ADXValue
+}
+
+// NewADXStream creates an ADX over period bars; the usual period is 14
+func NewADXStream(period int) *ADXStream {
+	return &ADXStream{
+		period: period,
+		dx:     newWilderCore(period),
+		value:  ADXValue{math.NaN(), math.NaN(), math.NaN()},
+	}
+}
+
+func (a *ADXStream) Update(bar data.StockData) {
+	if !a.started {
+		a.started = true
+		a.prev = bar
+		return
+	}
+	a.count++
+
+	upMove := bar.High - a.prev.High
+	downMove := a.prev.Low - bar.Low
+	plusDM, minusDM := 0.0, 0.0
+	if upMove > downMove && upMove > 0 {
+		plusDM = upMove
+	}
+	if downMove > upMove && downMove > 0 {
+		minusDM = downMove
+	}
+	tr := trueRange(bar, a.prev.Close)
+	a.prev = bar
+
+	n := float64(a.period)
+	if a.count <= a.period {
+		a.sumTR += tr
+		a.sumPlus += plusDM
+		a.sumMinus += minusDM
+		if a.count < a.period {
+			return
+		}
+	} else {
+		a.sumTR = a.sumTR - a.sumTR/n + tr
+		a.sumPlus = a.sumPlus - a.sumPlus/n + plusDM
+		a.sumMinus = a.sumMinus - a.sumMinus/n + minusDM
+	}
+
+	if a.sumTR == 0 {
+		a.value.PlusDI, a.value.MinusDI = 0, 0
+	} else {
+		a.value.PlusDI = a.sumPlus / a.sumTR * 100
+		a.value.MinusDI = a.sumMinus / a.sumTR * 100
+	}
+	dx := 0.0
+	if total := a.value.PlusDI + a.value.MinusDI; total > 0 {
+		dx = math.Abs(a.value.PlusDI-a.value.MinusDI) / total * 100
+	}
+	a.value.ADX = a.dx.add(dx)
+}
+
+func (a *ADXStream) Value() ADXValue { return a.value }
+func (a *ADXStream) Values() []float64 {
+	return []float64{a.value.ADX, a.value.PlusDI, a.value.MinusDI}
+}
+func (a *ADXStream) Outputs() []string { return []string{"adx", "plus_di", "minus_di"} }
+func (a *ADXStream) Lookback() int     { return 2*a.period - 1 }
+
+// ADXSeries holds the batch ADX outputs aligned with the input bars
+type ADXSeries struct {
+	ADX     []float64
+	PlusDI  []float64
+	MinusDI []float64
+}
+
+// ADX returns ADX, +DI and -DI, aligned with bars
+func ADX(bars []data.StockData, period int) ADXSeries {
+	outputs := batch(NewADXStream(period), bars)
+	return ADXSeries{ADX: outputs[0], PlusDI: outputs[1], MinusDI: outputs[2]}
+}
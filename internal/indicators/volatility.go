@@ -0,0 +1,98 @@
+package indicators
+
+import (
+	"math"
+
+	"github.com/Paaaark/hanquant/internal/data"
+)
+
+// BandsValue is one output of Bollinger Bands
+type BandsValue struct {
+	Upper  float64
+	Middle float64 // SMA of closes
+	Lower  float64
+}
+
+// BollingerStream is Bollinger Bands: an SMA of closes plus and minus k population
+// standard deviations over the same window
+type BollingerStream struct {
+	period int
+	k      float64
+	window *rolling
+	value  BandsValue
+}
+
+// NewBollingerStream creates Bollinger Bands; the usual parameters are 20 and 2
+func NewBollingerStream(period int, k float64) *BollingerStream {
+	return &BollingerStream{
+		period: period,
+		k:      k,
+		window: newRolling(period),
+		value:  BandsValue{math.NaN(), math.NaN(), math.NaN()},
+	}
+}
+
+func (b *BollingerStream) Update(bar data.StockData) {
+	b.window.push(bar.Close)
+	if !b.window.full() {
+		return
+	}
+	mean := b.window.mean()
+	width := b.k * b.window.stdDev()
+	b.value = BandsValue{Upper: mean + width, Middle: mean, Lower: mean - width}
+}
+
+func (b *BollingerStream) Value() BandsValue { return b.value }
+func (b *BollingerStream) Values() []float64 {
+	return []float64{b.value.Upper, b.value.Middle, b.value.Lower}
+}
+func (b *BollingerStream) Outputs() []string { return []string{"upper", "middle", "lower"} }
+func (b *BollingerStream) Lookback() int     { return b.period - 1 }
+
+// BandsSeries holds the batch Bollinger Bands aligned with the input bars
+type BandsSeries struct {
+	Upper  []float64
+	Middle []float64
+	Lower  []float64
+}
+
+// BollingerBands returns the upper, middle and lower bands, aligned with bars
+func BollingerBands(bars []data.StockData, period int, k float64) BandsSeries {
+	outputs := batch(NewBollingerStream(period, k), bars)
+	return BandsSeries{Upper: outputs[0], Middle: outputs[1], Lower: outputs[2]}
+}
+
+// ATRStream is Wilder's average true range. The first bar only provides the previous
+// close, so the first value is the mean true range of bars 1..period.
+type ATRStream struct {
+	period    int
+	core      *emaCore
+	prevClose float64
+	started   bool
+	value     float64
+}
+
+// NewATRStream creates an ATR over period bars
+func NewATRStream(period int) *ATRStream {
+	return &ATRStream{period: period, core: newWilderCore(period), value: math.NaN()}
+}
+
+func (a *ATRStream) Update(bar data.StockData) {
+	if !a.started {
+		a.started = true
+		a.prevClose = bar.Close
+		return
+	}
+	a.value = a.core.add(trueRange(bar, a.prevClose))
+	a.prevClose = bar.Close
+}
+
+func (a *ATRStream) Value() float64    { return a.value }
+func (a *ATRStream) Values() []float64 { return []float64{a.value} }
+func (a *ATRStream) Outputs() []string { return []string{"atr"} }
+func (a *ATRStream) Lookback() int     { return a.period }
+
+// ATR returns the average true range, aligned with bars
+func ATR(bars []data.StockData, period int) []float64 {
+	return batch(NewATRStream(period), bars)[0]
+}
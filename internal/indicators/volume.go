@@ -0,0 +1,109 @@
+package indicators
+
+import (
+	"math"
+
+	"github.com/Paaaark/hanquant/internal/data"
+)
+
+// OBVStream is on-balance volume: a running total that adds the volume of up closes and
+// subtracts the volume of down closes, starting from 0 on the first bar
+type OBVStream struct {
+	prevClose float64
+	started   bool
+	value     float64
+}
+
+// NewOBVStream creates an OBV
+func NewOBVStream() *OBVStream {
+	return &OBVStream{}
+}
+
+func (o *OBVStream) Update(bar data.StockData) {
+	if o.started {
+		switch {
+		case bar.Close > o.prevClose:
+			o.value += float64(bar.Volume)
+		case bar.Close < o.prevClose:
+			o.value -= float64(bar.Volume)
+		}
+	}
+	o.started = true
+	o.prevClose = bar.Close
+}
+
+func (o *OBVStream) Value() float64    { return o.value }
+func (o *OBVStream) Values() []float64 { return []float64{o.value} }
+func (o *OBVStream) Outputs() []string { return []string{"obv"} }
+func (o *OBVStream) Lookback() int     { return 0 }
+
+// OBV returns on-balance volume, aligned with bars
+func OBV(bars []data.StockData) []float64 {
+	return batch(NewOBVStream(), bars)[0]
+}
+
+// VWAPStream is the volume-weighted average of the typical price (high+low+close)/3.
+// With period 0 it accumulates from the first bar; otherwise it covers the last period bars.
+type VWAPStream struct {
+	period    int
+	priceVol  *rolling
+	volume    *rolling
+	cumPV     float64
+	cumVolume float64
+	value     float64
+}
+
+// NewVWAPStream creates a VWAP, cumulative when period is 0
+func NewVWAPStream(period int) *VWAPStream {
+	v := &VWAPStream{period: period, value: math.NaN()}
+	if period > 0 {
+		v.priceVol = newRolling(period)
+		v.volume = newRolling(period)
+	}
+	return v
+}
+
+func (v *VWAPStream) Update(bar data.StockData) {
+	typical := (bar.High + bar.Low + bar.Close) / 3
+	volume := float64(bar.Volume)
+
+	pv, vol := 0.0, 0.0
+	if v.period == 0 {
+		v.cumPV += typical * volume
+		v.cumVolume += volume
+		pv, vol = v.cumPV, v.cumVolume
+	} else {
+		v.priceVol.push(typical * volume)
+		v.volume.push(volume)
+		if !v.volume.full() {
+			return
+		}
+		pv, vol = v.priceVol.sum, v.volume.sum
+	}
+
+	if vol > 0 {
+		v.value = pv / vol
+	} else {
+		v.value = math.NaN()
+	}
+}
+
+// Reset starts a new accumulation, e.g. at the open of an intraday session
+func (v *VWAPStream) Reset() {
+	*v = *NewVWAPStream(v.period)
+}
+
+func (v *VWAPStream) Value() float64    { return v.value }
+func (v *VWAPStream) Values() []float64 { return []float64{v.value} }
+func (v *VWAPStream) Outputs() []string { return []string{"vwap"} }
+func (v *VWAPStream) Lookback() int {
+	if v.period == 0 {
+		return 0
+	}
+	return v.period - 1
+}
+
+// VWAP returns the volume-weighted average price, aligned with bars; cumulative when period is 0
+func VWAP(bars []data.StockData, period int) []float64 {
+	return batch(NewVWAPStream(period), bars)[0]
+}
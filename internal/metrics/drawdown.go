@@ -0,0 +1,107 @@
+package metrics
+
+import (
+	"time"
+
+	"github.com/Paaaark/hanquant/internal/data"
+)
+
+// Drawdown is one episode below a previous peak
+type Drawdown struct {
+	Peak      time.Time // Date of the high-water mark the episode started from
+	Trough    time.Time // Date of the lowest value within the episode
+	Recovery  time.Time // First date back at or above the peak; zero if not recovered
+	Depth     float64   // Peak-to-trough decline as a fraction
+	Recovered bool
+}
+
+// Duration returns the calendar days spent below the peak, up to end if not recovered
+func (d Drawdown) Duration(end time.Time) int {
+	if d.Recovered {
+		end = d.Recovery
+	}
+	return int(end.Sub(d.Peak).Hours() / 24)
+}
+
+// Drawdowns splits a date-ordered equity curve into drawdown episodes
+func Drawdowns(curve []Point) []Drawdown {
+	var episodes []Drawdown
+	if len(curve) == 0 {
+		return episodes
+	}
+
+	peak := curve[0]
+	var current *Drawdown
+	for _, point := range curve[1:] {
+		if point.Value >= peak.Value {
+			if current != nil {
+				current.Recovery = point.Date
+				current.Recovered = true
+				episodes = append(episodes, *current)
+				current = nil
+			}
+			peak = point
+			continue
+		}
+
+		if peak.Value <= 0 {
+			continue
+		}
+		depth := (peak.Value - point.Value) / peak.Value
+		if current == nil {
+			current = &Drawdown{Peak: peak.Date, Trough: point.Date, Depth: depth}
+		} else if depth > current.Depth {
+			current.Trough = point.Date
+			current.Depth = depth
+		}
+	}
+	if current != nil {
+		episodes = append(episodes, *current)
+	}
+	return episodes
+}
+
+// MaxDrawdown returns the deepest peak-to-trough decline of the curve, in percent
+func MaxDrawdown(curve []Point) float64 {
+	maxDepth := 0.0
+	for _, episode := range Drawdowns(curve) {
+		if episode.Depth > maxDepth {
+			maxDepth = episode.Depth
+		}
+	}
+	return maxDepth * 100
+}
+
+// applyDrawdowns fills the drawdown fields of result from the episodes of a curve ending at end
+func applyDrawdowns(result *data.RiskMetrics, episodes []Drawdown, end time.Time) {
+	var deepest, longest *Drawdown
+	longestDays := -1
+	for i := range episodes {
+		episode := &episodes[i]
+		if deepest == nil || episode.Depth > deepest.Depth {
+			deepest = episode
+		}
+		if days := episode.Duration(end); days > longestDays {
+			longest, longestDays = episode, days
+		}
+	}
+
+	if deepest != nil {
+		result.MaxDrawdown = deepest.Depth * 100
+		result.MaxDrawdownPeak = deepest.Peak.Format("2006-01-02")
+		result.MaxDrawdownTrough = deepest.Trough.Format("2006-01-02")
+		if deepest.Recovered {
+			result.MaxDrawdownRecovery = deepest.Recovery.Format("2006-01-02")
+			result.RecoveryDays = int(deepest.Recovery.Sub(deepest.Trough).Hours() / 24)
+		}
+	}
+	if longest != nil {
+		result.LongestDrawdownDays = longestDays
+		result.LongestDrawdownFrom = longest.Peak.Format("2006-01-02")
+		if longest.Recovered {
+			result.LongestDrawdownTo = longest.Recovery.Format("2006-01-02")
+		} else {
+			result.LongestDrawdownTo = end.Format("2006-01-02")
+		}
+	}
+}
@@ -0,0 +1,200 @@
+// Package metrics computes performance and risk statistics from an equity curve.
+// It is shared by the backtester and the live portfolio endpoints.
+package metrics
+
+import (
+	"math"
+	"time"
+
+	"github.com/Paaaark/hanquant/internal/data"
+)
+
+// TradingDaysPerYear is used to annualize daily statistics
+const TradingDaysPerYear = 252
+
+// DefaultConfidence is the VaR confidence level used when Options leaves it unset
+const DefaultConfidence = 0.95
+
+// Point is one value of an equity curve
+type Point struct {
+	Date  time.Time
+	Value float64
+}
+
+// Options configures Compute
+type Options struct {
+	RiskFreeRate float64 // Annual risk-free rate as a fraction (0.035 = 3.5%)
+	Confidence   float64 // VaR/CVaR confidence level, DefaultConfidence if zero
+}
+
+// FromSnapshots converts backtest portfolio snapshots into an equity curve.
+// Snapshots with an unparseable date are skipped.
+func FromSnapshots(history []data.PortfolioSnapshot) []Point {
+	curve := make([]Point, 0, len(history))
+	for _, snapshot := range history {
+		date, err := time.Parse("2006-01-02", snapshot.Date)
+		if err != nil {
+			continue
+		}
+		curve = append(curve, Point{Date: date, Value: snapshot.Portfolio.Total})
+	}
+	return curve
+}
+
+// Compute derives every risk metric of a date-ordered equity curve
+func Compute(curve []Point, opts Options) data.RiskMetrics {
+	if opts.Confidence == 0 {
+		opts.Confidence = DefaultConfidence
+	}
+	result := data.RiskMetrics{
+		RiskFreeRate:  opts.RiskFreeRate,
+		VaRConfidence: opts.Confidence,
+		RecoveryDays:  -1,
+	}
+	if len(curve) < 2 || curve[0].Value <= 0 {
+		return result
+	}
+
+	returns := Returns(curve)
+	result.TotalReturn = (curve[len(curve)-1].Value/curve[0].Value - 1) * 100
+	result.CAGR = CAGR(curve) * 100
+	result.Volatility = AnnualizedVolatility(returns) * 100
+	result.SharpeRatio = Sharpe(returns, opts.RiskFreeRate)
+	result.SortinoRatio = Sortino(returns, opts.RiskFreeRate)
+
+	applyDrawdowns(&result, Drawdowns(curve), curve[len(curve)-1].Date)
+	if result.MaxDrawdown > 0 {
+		result.CalmarRatio = result.CAGR / result.MaxDrawdown
+	}
+
+	varLoss, cvarLoss := HistoricalVaR(returns, opts.Confidence)
+	result.HistoricalVaR, result.HistoricalCVaR = varLoss*100, cvarLoss*100
+	varLoss, cvarLoss = ParametricVaR(returns, opts.Confidence)
+	result.ParametricVaR, result.ParametricCVaR = varLoss*100, cvarLoss*100
+
+	result.MonthlyReturns = PeriodReturns(curve, "2006-01")
+	result.YearlyReturns = PeriodReturns(curve, "2006")
+	return result
+}
+
+// Returns computes simple period-over-period returns, skipping points after a non-positive value
+func Returns(curve []Point) []float64 {
+	var returns []float64
+	for i := 1; i < len(curve); i++ {
+		if curve[i-1].Value > 0 {
+			returns = append(returns, curve[i].Value/curve[i-1].Value-1)
+		}
+	}
+	return returns
+}
+
+// Mean returns the arithmetic mean of values
+func Mean(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sum := 0.0
+	for _, v := range values {
+		sum += v
+	}
+	return sum / float64(len(values))
+}
+
+// StdDev returns the population standard deviation of values around mean
+func StdDev(values []float64, mean float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sum := 0.0
+	for _, v := range values {
+		sum += (v - mean) * (v - mean)
+	}
+	return math.Sqrt(sum / float64(len(values)))
+}
+
+// DailyRiskFree converts an annual risk-free rate into the equivalent daily rate
+func DailyRiskFree(annual float64) float64 {
+	return math.Pow(1+annual, 1.0/TradingDaysPerYear) - 1
+}
+
+// CAGR returns the compound annual growth rate as a fraction, using the calendar span of the curve
+func CAGR(curve []Point) float64 {
+	if len(curve) < 2 || curve[0].Value <= 0 || curve[len(curve)-1].Value <= 0 {
+		return 0
+	}
+	years := curve[len(curve)-1].Date.Sub(curve[0].Date).Hours() / 24 / 365.25
+	if years <= 0 {
+		return 0
+	}
+	return math.Pow(curve[len(curve)-1].Value/curve[0].Value, 1/years) - 1
+}
+
+// AnnualizedVolatility returns the stddev of daily returns scaled to a year, as a fraction
+func AnnualizedVolatility(returns []float64) float64 {
+	return StdDev(returns, Mean(returns)) * math.Sqrt(TradingDaysPerYear)
+}
+
+// Sharpe returns the annualized Sharpe ratio of daily returns against an annual risk-free rate
+func Sharpe(returns []float64, riskFreeRate float64) float64 {
+	if len(returns) == 0 {
+		return 0
+	}
+	excess := Mean(returns) - DailyRiskFree(riskFreeRate)
+	stdDev := StdDev(returns, Mean(returns))
+	if stdDev == 0 {
+		return 0
+	}
+	return excess / stdDev * math.Sqrt(TradingDaysPerYear)
+}
+
+// Sortino returns the annualized Sortino ratio. The downside deviation counts only returns
+// below the daily risk-free rate but averages over all periods.
+func Sortino(returns []float64, riskFreeRate float64) float64 {
+	if len(returns) == 0 {
+		return 0
+	}
+	target := DailyRiskFree(riskFreeRate)
+	downside := 0.0
+	for _, r := range returns {
+		if r < target {
+			downside += (r - target) * (r - target)
+		}
+	}
+	downsideDev := math.Sqrt(downside / float64(len(returns)))
+	if downsideDev == 0 {
+		return 0
+	}
+	return (Mean(returns) - target) / downsideDev * math.Sqrt(TradingDaysPerYear)
+}
+
+// PeriodReturns compounds the curve into calendar periods keyed by layout ("2006-01" for
+// months, "2006" for years). Each period is measured from the last value of the previous
+// period, and the first period from the first point.
+func PeriodReturns(curve []Point, layout string) []data.PeriodReturn {
+	var result []data.PeriodReturn
+	if len(curve) == 0 {
+		return result
+	}
+
+	base := curve[0].Value
+	current := curve[0].Date.Format(layout)
+	last := curve[0].Value
+	for _, point := range curve[1:] {
+		period := point.Date.Format(layout)
+		if period != current {
+			result = append(result, periodReturn(current, base, last))
+			base = last
+			current = period
+		}
+		last = point.Value
+	}
+	return append(result, periodReturn(current, base, last))
+}
+
+func periodReturn(period string, base, last float64) data.PeriodReturn {
+	row := data.PeriodReturn{Period: period}
+	if base > 0 {
+		row.Return = (last/base - 1) * 100
+	}
+	return row
+}
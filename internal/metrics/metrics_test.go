@@ -0,0 +1,158 @@
+package metrics
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// handCurve rises 10%, falls 10%, stays flat, rises 20% to a new high and gives back 5%.
+// Its daily returns are 0.10, -0.10, 0, 0.20 and -0.05: mean 0.03 and population variance
+// 0.0116. Only -0.10 and -0.05 are below a zero target, so the downside deviation is
+// sqrt((0.01+0.0025)/5) = 0.05.
+func handCurve() []Point {
+	days := []string{"2024-01-30", "2024-01-31", "2024-02-01", "2024-02-02", "2024-02-05", "2024-02-06"}
+	values := []float64{100, 110, 99, 99, 118.8, 112.86}
+	curve := make([]Point, len(days))
+	for i, day := range days {
+		date, _ := time.Parse("2006-01-02", day)
+		curve[i] = Point{Date: date, Value: values[i]}
+	}
+	return curve
+}
+
+func approx(a, b float64) bool {
+	return math.Abs(a-b) <= 1e-9*math.Max(1, math.Abs(b))
+}
+
+func TestRatios(t *testing.T) {
+	returns := Returns(handCurve())
+	tests := []struct {
+		name      string
+		got, want float64
+	}{
+		{"Mean", Mean(returns), 0.03},
+		{"StdDev", StdDev(returns, Mean(returns)), math.Sqrt(0.0116)},
+		{"Sharpe", Sharpe(returns, 0), 0.03 / math.Sqrt(0.0116) * math.Sqrt(252)},
+		{"Sortino", Sortino(returns, 0), 0.03 / 0.05 * math.Sqrt(252)},
+		{"AnnualizedVolatility", AnnualizedVolatility(returns), math.Sqrt(0.0116) * math.Sqrt(252)},
+		{"MaxDrawdown", MaxDrawdown(handCurve()), 10},
+		// Undefined ratios are 0
+		{"Sharpe of flat returns", Sharpe([]float64{0.01, 0.01}, 0), 0},
+		{"Sortino without downside", Sortino([]float64{0.01, 0.02}, 0), 0},
+		{"Sharpe of no returns", Sharpe(nil, 0), 0},
+	}
+	for _, tt := range tests {
+		if !approx(tt.got, tt.want) {
+			t.Errorf("%s = %v, want %v", tt.name, tt.got, tt.want)
+		}
+	}
+}
+
+func TestSharpeRiskFree(t *testing.T) {
+	returns := Returns(handCurve())
+	daily := DailyRiskFree(0.035)
+	if !approx(math.Pow(1+daily, 252), 1.035) {
+		t.Fatalf("DailyRiskFree(0.035) = %v does not compound to 3.5%% a year", daily)
+	}
+	want := (0.03 - daily) / math.Sqrt(0.0116) * math.Sqrt(252)
+	if got := Sharpe(returns, 0.035); !approx(got, want) {
+		t.Errorf("Sharpe(3.5%%) = %v, want %v", got, want)
+	}
+}
+
+func TestDrawdowns(t *testing.T) {
+	curve := handCurve()
+	episodes := Drawdowns(curve)
+	if len(episodes) != 2 {
+		t.Fatalf("got %d drawdowns, want 2: %+v", len(episodes), episodes)
+	}
+
+	first := episodes[0]
+	if !first.Recovered || !approx(first.Depth, 0.1) ||
+		!first.Peak.Equal(curve[1].Date) || !first.Trough.Equal(curve[2].Date) || !first.Recovery.Equal(curve[4].Date) {
+		t.Errorf("first drawdown = %+v, want 110 -> 99 recovered on %s", first, curve[4].Date.Format("2006-01-02"))
+	}
+	if got := first.Duration(curve[5].Date); got != 5 {
+		t.Errorf("first drawdown lasted %d days, want 5", got)
+	}
+
+	second := episodes[1]
+	if second.Recovered || !approx(second.Depth, 0.05) || !second.Peak.Equal(curve[4].Date) {
+		t.Errorf("second drawdown = %+v, want an open 5%% drawdown from 118.8", second)
+	}
+	if got := second.Duration(curve[5].Date); got != 1 {
+		t.Errorf("open drawdown lasted %d days to the end, want 1", got)
+	}
+}
+
+func TestCompute(t *testing.T) {
+	result := Compute(handCurve(), Options{Confidence: 0.75})
+
+	if !approx(result.TotalReturn, 12.86) {
+		t.Errorf("TotalReturn = %v, want 12.86", result.TotalReturn)
+	}
+	if !approx(result.MaxDrawdown, 10) || result.MaxDrawdownPeak != "2024-01-31" ||
+		result.MaxDrawdownTrough != "2024-02-01" || result.MaxDrawdownRecovery != "2024-02-05" || result.RecoveryDays != 4 {
+		t.Errorf("max drawdown = %v%% %s -> %s recovered %s after %d days, want 10%% 2024-01-31 -> 2024-02-01 recovered 2024-02-05 after 4",
+			result.MaxDrawdown, result.MaxDrawdownPeak, result.MaxDrawdownTrough, result.MaxDrawdownRecovery, result.RecoveryDays)
+	}
+	if result.LongestDrawdownDays != 5 || result.LongestDrawdownFrom != "2024-01-31" || result.LongestDrawdownTo != "2024-02-05" {
+		t.Errorf("longest drawdown = %d days %s -> %s, want 5 days 2024-01-31 -> 2024-02-05",
+			result.LongestDrawdownDays, result.LongestDrawdownFrom, result.LongestDrawdownTo)
+	}
+	if !approx(result.CalmarRatio, result.CAGR/10) {
+		t.Errorf("CalmarRatio = %v, want CAGR/10 = %v", result.CalmarRatio, result.CAGR/10)
+	}
+
+	// At 75% the VaR is the second worst of five returns and the CVaR averages the worst two
+	if !approx(result.HistoricalVaR, 5) || !approx(result.HistoricalCVaR, 7.5) {
+		t.Errorf("historical VaR/CVaR = %v/%v, want 5/7.5", result.HistoricalVaR, result.HistoricalCVaR)
+	}
+
+	if len(result.MonthlyReturns) != 2 ||
+		result.MonthlyReturns[0].Period != "2024-01" || !approx(result.MonthlyReturns[0].Return, 10) ||
+		result.MonthlyReturns[1].Period != "2024-02" || !approx(result.MonthlyReturns[1].Return, 2.6) {
+		t.Errorf("MonthlyReturns = %+v, want 2024-01 10%% and 2024-02 2.6%%", result.MonthlyReturns)
+	}
+	if len(result.YearlyReturns) != 1 || !approx(result.YearlyReturns[0].Return, 12.86) {
+		t.Errorf("YearlyReturns = %+v, want 2024 12.86%%", result.YearlyReturns)
+	}
+}
+
+func TestComputeShortCurve(t *testing.T) {
+	result := Compute(handCurve()[:1], Options{})
+	if result.SharpeRatio != 0 || result.MaxDrawdown != 0 || result.RecoveryDays != -1 || result.VaRConfidence != DefaultConfidence {
+		t.Errorf("Compute of one point = %+v, want empty metrics", result)
+	}
+}
+
+func TestHistoricalVaR(t *testing.T) {
+	// 100 returns whose ten worst are -1% to -10%
+	returns := make([]float64, 0, 100)
+	for i := 1; i <= 10; i++ {
+		returns = append(returns, -0.01*float64(i))
+	}
+	for i := 0; i < 90; i++ {
+		returns = append(returns, 0.001*float64(i%7))
+	}
+
+	tests := []struct {
+		confidence float64
+		wantVaR    float64
+		wantCVaR   float64
+	}{
+		// At 95% the tail is the 5 worst returns: -10% to -6%
+		{0.95, 0.06, 0.08},
+		{0.99, 0.10, 0.10},
+		{0.90, 0.01, 0.055},
+		// Less than one observation still takes the worst return
+		{0.999, 0.10, 0.10},
+	}
+	for _, tt := range tests {
+		gotVaR, gotCVaR := HistoricalVaR(returns, tt.confidence)
+		if !approx(gotVaR, tt.wantVaR) || !approx(gotCVaR, tt.wantCVaR) {
+			t.Errorf("HistoricalVaR at %v = %v/%v, want %v/%v", tt.confidence, gotVaR, gotCVaR, tt.wantVaR, tt.wantCVaR)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package metrics
+
+import (
+	"math"
+	"sort"
+)
+
+// HistoricalVaR returns the one-day value at risk and conditional value at risk of returns at
+// the given confidence, as positive loss fractions. VaR is the empirical (1-confidence)
+// quantile of returns, the k-th worst of n returns with k = ceil((1-confidence)*n); CVaR is the
+// mean of those k returns.
+func HistoricalVaR(returns []float64, confidence float64) (float64, float64) {
+	if len(returns) == 0 {
+		return 0, 0
+	}
+	sorted := append([]float64(nil), returns...)
+	sort.Float64s(sorted)
+
+	// 1-0.95 is not exact in floating point, so allow for the rounding before taking the ceiling
+	cutoff := int(math.Ceil((1-confidence)*float64(len(sorted))-1e-9)) - 1
+	cutoff = max(0, min(cutoff, len(sorted)-1))
+	tail := sorted[:cutoff+1]
+	return -sorted[cutoff], -Mean(tail)
+}
+
+// ParametricVaR returns the one-day VaR and CVaR (expected shortfall) of returns assuming they
+// are normally distributed with their sample mean and stddev, as positive loss fractions.
+func ParametricVaR(returns []float64, confidence float64) (float64, float64) {
+	if len(returns) == 0 || confidence <= 0 || confidence >= 1 {
+		return 0, 0
+	}
+	mean := Mean(returns)
+	stdDev := StdDev(returns, mean)
+
+	z := math.Sqrt2 * math.Erfinv(2*confidence-1)
+	density := math.Exp(-z*z/2) / math.Sqrt(2*math.Pi)
+	return z*stdDev - mean, stdDev*density/(1-confidence) - mean
+}
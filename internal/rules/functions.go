@@ -0,0 +1,224 @@
+package rules
+
+import (
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/Paaaark/hanquant/internal/data"
+	"github.com/Paaaark/hanquant/internal/indicators"
+)
+
+// seriesFunction is a rule function that runs over the whole history of a symbol
+type seriesFunction struct {
+	spec   string // indicators spec name, "" for highest and lowest
+	output int    // index into the stream's Values
+	source bool   // takes an optional series to run over instead of the closes
+}
+
+var seriesFunctions = map[string]seriesFunction{
+	"sma":         {"sma", 0, true},
+	"ema":         {"ema", 0, true},
+	"wma":         {"wma", 0, true},
+	"rsi":         {"rsi", 0, true},
+	"bb_upper":    {"bbands", 0, true},
+	"bb_middle":   {"bbands", 1, true},
+	"bb_lower":    {"bbands", 2, true},
+	"macd":        {"macd", 0, true},
+	"macd_signal": {"macd", 1, true},
+	"macd_hist":   {"macd", 2, true},
+	"highest":     {"", 0, true},
+	"lowest":      {"", 0, true},
+	// These need the high, low or volume of the bars
+	"atr":      {"atr", 0, false},
+	"adx":      {"adx", 0, false},
+	"plus_di":  {"adx", 1, false},
+	"minus_di": {"adx", 2, false},
+	"stoch_k":  {"stoch", 0, false},
+	"stoch_d":  {"stoch", 1, false},
+	"obv":      {"obv", 0, false},
+	"vwap":     {"vwap", 0, false},
+}
+
+// maxPeriod bounds the bar counts of prev, highest and lowest like indicators.ParseSpec does
+const maxPeriod = 1000
+
+// seriesNode is an indicator over the bars, or over source when it is set
+type seriesNode struct {
+	at     Pos
+	name   string
+	source node
+	params []float64
+	stream func() indicators.Indicator
+	output int
+}
+
+func (n *seriesNode) pos() Pos        { return n.at }
+func (n *seriesNode) kind() valueKind { return kindNumber }
+
+func (n *seriesNode) eval(e *Evaluator, i int) float64 {
+	return e.cached(n, func() []float64 { return n.compute(e) })[i]
+}
+
+// compute feeds every bar through a fresh stream. A source is fed as bars whose prices all
+// equal its value; bars where it is undefined are skipped and stay undefined.
+func (n *seriesNode) compute(e *Evaluator) []float64 {
+	stream := n.stream()
+	values := make([]float64, len(e.bars))
+	for i, bar := range e.bars {
+		if n.source != nil {
+			value := n.source.eval(e, i)
+			if math.IsNaN(value) {
+				values[i] = undefined
+				continue
+			}
+			bar = data.StockData{Symbol: bar.Symbol, Date: bar.Date, Open: value, High: value, Low: value, Close: value}
+		}
+		stream.Update(bar)
+		values[i] = stream.Values()[n.output]
+	}
+	return values
+}
+
+func (n *seriesNode) String() string {
+	var args []string
+	if n.source != nil {
+		args = append(args, n.source.String())
+	}
+	for _, param := range n.params {
+		args = append(args, strconv.FormatFloat(param, 'f', -1, 64))
+	}
+	return n.name + "(" + strings.Join(args, ",") + ")"
+}
+
+// extremeStream is the highest or lowest close of the last period bars
+type extremeStream struct {
+	period  int
+	highest bool
+	closes  []float64
+	value   float64
+}
+
+func (s *extremeStream) Update(bar data.StockData) {
+	s.closes = append(s.closes, bar.Close)
+	if len(s.closes) > s.period {
+		s.closes = s.closes[1:]
+	}
+	s.value = undefined
+	if len(s.closes) < s.period {
+		return
+	}
+	s.value = s.closes[0]
+	for _, value := range s.closes[1:] {
+		if s.highest {
+			s.value = math.Max(s.value, value)
+		} else {
+			s.value = math.Min(s.value, value)
+		}
+	}
+}
+
+func (s *extremeStream) Values() []float64 { return []float64{s.value} }
+func (s *extremeStream) Outputs() []string { return []string{"extreme"} }
+func (s *extremeStream) Lookback() int     { return s.period - 1 }
+
+// buildCall checks the arguments of a function call and builds its node
+func buildCall(name token, args []node) (node, error) {
+	switch name.text {
+	case "abs", "min", "max":
+		want := 2
+		if name.text == "abs" {
+			want = 1
+		}
+		if len(args) != want {
+			return nil, errorAt(name.pos, "%s takes %d arguments, found %d", name.text, want, len(args))
+		}
+		for _, arg := range args {
+			if arg.kind() != kindNumber {
+				return nil, errorAt(arg.pos(), "%s needs a number, found %s", name.text, arg.kind())
+			}
+		}
+		return &mathNode{at: name.pos, name: name.text, args: args}, nil
+	case "prev":
+		if len(args) < 1 || len(args) > 2 {
+			return nil, errorAt(name.pos, "prev takes a value and an optional number of bars, found %d arguments", len(args))
+		}
+		if args[0].kind() != kindNumber {
+			return nil, errorAt(args[0].pos(), "prev needs a number, found %s", args[0].kind())
+		}
+		bars := 1
+		if len(args) == 2 {
+			var err error
+			if bars, err = periodArg("prev", args[1]); err != nil {
+				return nil, err
+			}
+		}
+		return &prevNode{at: name.pos, operand: args[0], bars: bars}, nil
+	}
+
+	function, exists := seriesFunctions[name.text]
+	if !exists {
+		return nil, errorAt(name.pos, "unknown function %q", name.text)
+	}
+	call := &seriesNode{at: name.pos, name: name.text, output: function.output}
+
+	// A leading argument that is not a plain number is the series to run over
+	if len(args) > 0 {
+		if _, isNumber := args[0].(*numberNode); !isNumber {
+			if !function.source {
+				return nil, errorAt(args[0].pos(), "%s works on the bars and only takes numeric parameters", name.text)
+			}
+			if args[0].kind() != kindNumber {
+				return nil, errorAt(args[0].pos(), "%s needs a series of numbers, found %s", name.text, args[0].kind())
+			}
+			if position := findPosition(args[0]); position != nil {
+				return nil, errorAt(position.pos(), "%s changes with the position and cannot be used inside %s", position, name.text)
+			}
+			call.source = args[0]
+			args = args[1:]
+		}
+	}
+	for _, arg := range args {
+		if _, isNumber := arg.(*numberNode); !isNumber {
+			return nil, errorAt(arg.pos(), "%s parameters must be plain numbers", name.text)
+		}
+	}
+
+	if function.spec == "" {
+		if len(args) != 1 {
+			return nil, errorAt(name.pos, "%s needs a number of bars", name.text)
+		}
+		period, err := periodArg(name.text, args[0])
+		if err != nil {
+			return nil, err
+		}
+		highest := name.text == "highest"
+		call.params = []float64{float64(period)}
+		call.stream = func() indicators.Indicator {
+			return &extremeStream{period: period, highest: highest, value: undefined}
+		}
+		return call, nil
+	}
+
+	raw := []string{function.spec}
+	for _, arg := range args {
+		raw = append(raw, arg.String())
+	}
+	spec, err := indicators.ParseSpec(strings.Join(raw, ":"))
+	if err != nil {
+		// Errors name the spec, e.g. "bbands: ...", where the rules say bb_upper
+		return nil, errorAt(name.pos, "%s%s", name.text, strings.TrimPrefix(err.Error(), function.spec))
+	}
+	call.params = spec.Params
+	call.stream = spec.New
+	return call, nil
+}
+
+// periodArg reads a whole number of bars between 1 and maxPeriod
+func periodArg(function string, arg node) (int, error) {
+	number, isNumber := arg.(*numberNode)
+	if !isNumber || number.value != math.Trunc(number.value) || number.value < 1 || number.value > maxPeriod {
+		return 0, errorAt(arg.pos(), "%s needs a whole number of bars between 1 and %d", function, maxPeriod)
+	}
+	return int(number.value), nil
+}
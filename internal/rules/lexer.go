@@ -0,0 +1,114 @@
+package rules
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenNumber
+	tokenIdent
+	tokenOperator // + - * / < <= > >= == !=
+	tokenLParen
+	tokenRParen
+	tokenComma
+	tokenColon
+	tokenSemicolon
+)
+
+type token struct {
+	kind  tokenKind
+	text  string  // identifiers are lowercased
+	value float64 // tokenNumber only
+	pos   Pos
+}
+
+// describe names the token for error messages
+func (t token) describe() string {
+	if t.kind == tokenEOF {
+		return "end of rules"
+	}
+	return strconv.Quote(t.text)
+}
+
+// tokenize splits source into tokens. Whitespace, including newlines, only separates tokens
+// and "#" starts a comment that runs to the end of the line.
+func tokenize(source string) ([]token, error) {
+	var tokens []token
+	runes := []rune(source)
+	line, column := 1, 1
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		pos := Pos{Line: line, Column: column}
+		advance := func(n int) {
+			i += n
+			column += n
+		}
+
+		switch {
+		case r == '\n':
+			i++
+			line++
+			column = 1
+		case unicode.IsSpace(r):
+			advance(1)
+		case r == '#':
+			for i < len(runes) && runes[i] != '\n' {
+				advance(1)
+			}
+		case unicode.IsDigit(r) || r == '.' && i+1 < len(runes) && unicode.IsDigit(runes[i+1]):
+			end := i
+			for end < len(runes) && (unicode.IsDigit(runes[end]) || runes[end] == '.') {
+				end++
+			}
+			text := string(runes[i:end])
+			value, err := strconv.ParseFloat(text, 64)
+			if err != nil {
+				return nil, errorAt(pos, "invalid number %q", text)
+			}
+			tokens = append(tokens, token{kind: tokenNumber, text: text, value: value, pos: pos})
+			advance(end - i)
+		case unicode.IsLetter(r) || r == '_':
+			end := i
+			for end < len(runes) && (unicode.IsLetter(runes[end]) || unicode.IsDigit(runes[end]) || runes[end] == '_') {
+				end++
+			}
+			tokens = append(tokens, token{kind: tokenIdent, text: strings.ToLower(string(runes[i:end])), pos: pos})
+			advance(end - i)
+		default:
+			next := rune(0)
+			if i+1 < len(runes) {
+				next = runes[i+1]
+			}
+			switch {
+			case strings.ContainsRune("<>=!", r) && next == '=':
+				tokens = append(tokens, token{kind: tokenOperator, text: string(r) + "=", pos: pos})
+				advance(2)
+			case r == '=':
+				return nil, errorAt(pos, "unexpected \"=\", use == to compare")
+			case r == '&' || r == '|':
+				return nil, errorAt(pos, "unexpected %q, use and / or to combine conditions", string(r))
+			case strings.ContainsRune("+-*/<>", r):
+				tokens = append(tokens, token{kind: tokenOperator, text: string(r), pos: pos})
+				advance(1)
+			case strings.ContainsRune("(),:;", r):
+				kinds := map[rune]tokenKind{'(': tokenLParen, ')': tokenRParen, ',': tokenComma, ':': tokenColon, ';': tokenSemicolon}
+				tokens = append(tokens, token{kind: kinds[r], text: string(r), pos: pos})
+				advance(1)
+			default:
+				return nil, errorAt(pos, "unexpected character %q", string(r))
+			}
+		}
+	}
+	return append(tokens, token{kind: tokenEOF, pos: Pos{Line: line, Column: column}}), nil
+}
+
+// errorAt builds an *Error at pos
+func errorAt(pos Pos, format string, args ...any) *Error {
+	return &Error{Line: pos.Line, Column: pos.Column, Message: fmt.Sprintf(format, args...)}
+}
@@ -0,0 +1,302 @@
+package rules
+
+import (
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/Paaaark/hanquant/internal/data"
+)
+
+// valueKind is the type of an expression
+type valueKind int
+
+const (
+	kindNumber valueKind = iota
+	kindCondition
+)
+
+func (k valueKind) String() string {
+	if k == kindCondition {
+		return "a condition"
+	}
+	return "a number"
+}
+
+// node is an expression of the parsed rules. eval returns its value on bar i; conditions
+// evaluate to 1, 0 or NaN when undefined.
+type node interface {
+	pos() Pos // start of the expression in the source
+	kind() valueKind
+	eval(e *Evaluator, i int) float64
+	String() string
+}
+
+type numberNode struct {
+	at    Pos
+	value float64
+}
+
+func (n *numberNode) pos() Pos                         { return n.at }
+func (n *numberNode) kind() valueKind                  { return kindNumber }
+func (n *numberNode) eval(e *Evaluator, i int) float64 { return n.value }
+func (n *numberNode) String() string                   { return strconv.FormatFloat(n.value, 'f', -1, 64) }
+
+var barFields = map[string]func(bar data.StockData) float64{
+	"open":   func(bar data.StockData) float64 { return bar.Open },
+	"high":   func(bar data.StockData) float64 { return bar.High },
+	"low":    func(bar data.StockData) float64 { return bar.Low },
+	"close":  func(bar data.StockData) float64 { return bar.Close },
+	"volume": func(bar data.StockData) float64 { return float64(bar.Volume) },
+}
+
+// fieldNode reads a field of the current bar
+type fieldNode struct {
+	at   Pos
+	name string
+}
+
+func (n *fieldNode) pos() Pos                         { return n.at }
+func (n *fieldNode) kind() valueKind                  { return kindNumber }
+func (n *fieldNode) eval(e *Evaluator, i int) float64 { return barFields[n.name](e.bars[i]) }
+func (n *fieldNode) String() string                   { return n.name }
+
+// positionNode reads the open position: entry_price or bars_held
+type positionNode struct {
+	at   Pos
+	name string
+}
+
+func (n *positionNode) pos() Pos        { return n.at }
+func (n *positionNode) kind() valueKind { return kindNumber }
+func (n *positionNode) String() string  { return n.name }
+
+func (n *positionNode) eval(e *Evaluator, i int) float64 {
+	if n.name == "bars_held" {
+		return float64(e.position.BarsHeld)
+	}
+	return e.position.EntryPrice
+}
+
+// unaryNode is a negation "-x" or "not x"
+type unaryNode struct {
+	at      Pos
+	op      string
+	operand node
+}
+
+func (n *unaryNode) pos() Pos { return n.at }
+
+func (n *unaryNode) kind() valueKind {
+	if n.op == "not" {
+		return kindCondition
+	}
+	return kindNumber
+}
+
+func (n *unaryNode) eval(e *Evaluator, i int) float64 {
+	value := n.operand.eval(e, i)
+	if n.op == "-" {
+		return -value
+	}
+	if math.IsNaN(value) {
+		return undefined
+	}
+	return 1 - value
+}
+
+func (n *unaryNode) String() string {
+	operand := n.operand.String()
+	if precedence(n.operand) < precedence(n) {
+		operand = "(" + operand + ")"
+	}
+	if n.op == "not" {
+		return "not " + operand
+	}
+	return "-" + operand
+}
+
+// binaryNode is an arithmetic, comparison, cross or logical operator
+type binaryNode struct {
+	op          string
+	left, right node
+}
+
+func (n *binaryNode) pos() Pos { return n.left.pos() }
+
+func (n *binaryNode) kind() valueKind {
+	switch n.op {
+	case "+", "-", "*", "/":
+		return kindNumber
+	}
+	return kindCondition
+}
+
+func (n *binaryNode) eval(e *Evaluator, i int) float64 {
+	switch n.op {
+	case "and", "or":
+		// Three-valued logic: a decided side wins over an undefined one
+		decisive := condition(n.op == "or")
+		left := n.left.eval(e, i)
+		if left == decisive {
+			return decisive
+		}
+		right := n.right.eval(e, i)
+		if right == decisive {
+			return decisive
+		}
+		if math.IsNaN(left) || math.IsNaN(right) {
+			return undefined
+		}
+		return 1 - decisive
+	case "crosses_above", "crosses_below":
+		if i == 0 {
+			return undefined
+		}
+		prevLeft, prevRight := n.left.eval(e, i-1), n.right.eval(e, i-1)
+		left, right := n.left.eval(e, i), n.right.eval(e, i)
+		if math.IsNaN(prevLeft) || math.IsNaN(prevRight) || math.IsNaN(left) || math.IsNaN(right) {
+			return undefined
+		}
+		if n.op == "crosses_above" {
+			return condition(prevLeft <= prevRight && left > right)
+		}
+		return condition(prevLeft >= prevRight && left < right)
+	}
+
+	left, right := n.left.eval(e, i), n.right.eval(e, i)
+	if math.IsNaN(left) || math.IsNaN(right) {
+		return undefined
+	}
+	switch n.op {
+	case "+":
+		return left + right
+	case "-":
+		return left - right
+	case "*":
+		return left * right
+	case "/":
+		return left / right
+	case "<":
+		return condition(left < right)
+	case "<=":
+		return condition(left <= right)
+	case ">":
+		return condition(left > right)
+	case ">=":
+		return condition(left >= right)
+	case "==":
+		return condition(left == right)
+	}
+	return condition(left != right)
+}
+
+func (n *binaryNode) String() string {
+	left, right := n.left.String(), n.right.String()
+	if precedence(n.left) < precedence(n) {
+		left = "(" + left + ")"
+	}
+	// - and / are left associative, so an equal operator on the right keeps its parentheses
+	if precedence(n.right) < precedence(n) || precedence(n.right) == precedence(n) && (n.op == "-" || n.op == "/") {
+		right = "(" + right + ")"
+	}
+	return left + " " + n.op + " " + right
+}
+
+// precedence of the operator at the root of n, higher binds tighter
+func precedence(n node) int {
+	switch n := n.(type) {
+	case *binaryNode:
+		switch n.op {
+		case "or":
+			return 1
+		case "and":
+			return 2
+		case "+", "-":
+			return 5
+		case "*", "/":
+			return 6
+		}
+		return 4
+	case *unaryNode:
+		if n.op == "not" {
+			return 3
+		}
+		return 7
+	}
+	return 8
+}
+
+// prevNode is the value of operand a number of bars ago
+type prevNode struct {
+	at      Pos
+	operand node
+	bars    int
+}
+
+func (n *prevNode) pos() Pos        { return n.at }
+func (n *prevNode) kind() valueKind { return kindNumber }
+
+func (n *prevNode) eval(e *Evaluator, i int) float64 {
+	if i < n.bars {
+		return undefined
+	}
+	return n.operand.eval(e, i-n.bars)
+}
+
+func (n *prevNode) String() string {
+	return "prev(" + n.operand.String() + "," + strconv.Itoa(n.bars) + ")"
+}
+
+// mathNode is abs, min or max of its arguments on the same bar
+type mathNode struct {
+	at   Pos
+	name string
+	args []node
+}
+
+func (n *mathNode) pos() Pos        { return n.at }
+func (n *mathNode) kind() valueKind { return kindNumber }
+
+func (n *mathNode) eval(e *Evaluator, i int) float64 {
+	switch n.name {
+	case "abs":
+		return math.Abs(n.args[0].eval(e, i))
+	case "min":
+		return math.Min(n.args[0].eval(e, i), n.args[1].eval(e, i))
+	}
+	return math.Max(n.args[0].eval(e, i), n.args[1].eval(e, i))
+}
+
+func (n *mathNode) String() string {
+	args := make([]string, len(n.args))
+	for i, arg := range n.args {
+		args[i] = arg.String()
+	}
+	return n.name + "(" + strings.Join(args, ",") + ")"
+}
+
+// findPosition returns the first entry_price or bars_held inside n, or nil
+func findPosition(n node) node {
+	switch n := n.(type) {
+	case *positionNode:
+		return n
+	case *unaryNode:
+		return findPosition(n.operand)
+	case *binaryNode:
+		if found := findPosition(n.left); found != nil {
+			return found
+		}
+		return findPosition(n.right)
+	case *prevNode:
+		return findPosition(n.operand)
+	case *mathNode:
+		for _, arg := range n.args {
+			if found := findPosition(arg); found != nil {
+				return found
+			}
+		}
+	}
+	// Indicator sources are checked when the call is parsed
+	return nil
+}
@@ -0,0 +1,271 @@
+package rules
+
+// parser is a recursive descent parser over the tokens of a rule set. From loosest to
+// tightest binding the levels are: or, and, not, comparisons and crosses, + -, * /, unary minus.
+type parser struct {
+	tokens []token
+	next   int
+}
+
+var keywords = map[string]bool{"and": true, "or": true, "not": true, "crosses_above": true, "crosses_below": true}
+
+func (p *parser) peek() token {
+	return p.tokens[p.next]
+}
+
+func (p *parser) take() token {
+	t := p.tokens[p.next]
+	if t.kind != tokenEOF {
+		p.next++
+	}
+	return t
+}
+
+func (p *parser) peekKeyword(word string) bool {
+	t := p.peek()
+	return t.kind == tokenIdent && t.text == word
+}
+
+// atSection reports whether the next tokens start a section, "name:"
+func (p *parser) atSection() bool {
+	return p.peek().kind == tokenIdent && p.tokens[p.next+1].kind == tokenColon
+}
+
+func (p *parser) parseProgram() (*Program, error) {
+	program := &Program{}
+	seen := make(map[string]bool)
+	for {
+		for p.peek().kind == tokenSemicolon {
+			p.take()
+		}
+		if p.peek().kind == tokenEOF {
+			break
+		}
+		if !p.atSection() {
+			return nil, errorAt(p.peek().pos, "expected a section such as \"entry:\", found %s", p.peek().describe())
+		}
+		section := p.take()
+		p.take()
+		if section.text != "entry" && section.text != "exit" {
+			return nil, errorAt(section.pos, "unknown section %q, expected entry or exit", section.text)
+		}
+		if seen[section.text] {
+			return nil, errorAt(section.pos, "section %q is given twice", section.text)
+		}
+		seen[section.text] = true
+		if kind := p.peek().kind; kind == tokenEOF || kind == tokenSemicolon || p.atSection() {
+			return nil, errorAt(p.peek().pos, "section %q is empty", section.text)
+		}
+
+		rule, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if rule.kind() != kindCondition {
+			return nil, errorAt(rule.pos(), "%s must be a condition, found %s", section.text, rule.kind())
+		}
+		if next := p.peek(); next.kind != tokenEOF && next.kind != tokenSemicolon && !p.atSection() {
+			return nil, errorAt(next.pos, "expected an operator, \";\" or the next section, found %s", next.describe())
+		}
+
+		if section.text == "exit" {
+			program.exit = rule
+			continue
+		}
+		if position := findPosition(rule); position != nil {
+			return nil, errorAt(position.pos(), "%s describes the open position and can only be used in exit", position)
+		}
+		program.entry = rule
+	}
+
+	if program.entry == nil {
+		return nil, &Error{Message: "rules need an entry section"}
+	}
+	return program, nil
+}
+
+// parseLogical parses a left associative chain of and / or
+func (p *parser) parseLogical(op string, operand func() (node, error)) (node, error) {
+	left, err := operand()
+	if err != nil {
+		return nil, err
+	}
+	for p.peekKeyword(op) {
+		p.take()
+		right, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		if err := expectKind(op, left, right, kindCondition); err != nil {
+			return nil, err
+		}
+		left = &binaryNode{op: op, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseOr() (node, error) {
+	return p.parseLogical("or", p.parseAnd)
+}
+
+func (p *parser) parseAnd() (node, error) {
+	return p.parseLogical("and", p.parseNot)
+}
+
+func (p *parser) parseNot() (node, error) {
+	if !p.peekKeyword("not") {
+		return p.parseComparison()
+	}
+	not := p.take()
+	operand, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	if operand.kind() != kindCondition {
+		return nil, errorAt(operand.pos(), "\"not\" needs a condition, found %s", operand.kind())
+	}
+	return &unaryNode{at: not.pos, op: "not", operand: operand}, nil
+}
+
+// isComparison reports whether t compares two numbers
+func isComparison(t token) bool {
+	switch t.text {
+	case "<", "<=", ">", ">=", "==", "!=":
+		return t.kind == tokenOperator
+	case "crosses_above", "crosses_below":
+		return t.kind == tokenIdent
+	}
+	return false
+}
+
+func (p *parser) parseComparison() (node, error) {
+	left, err := p.parseArithmetic(0)
+	if err != nil {
+		return nil, err
+	}
+	if !isComparison(p.peek()) {
+		return left, nil
+	}
+	op := p.take()
+	right, err := p.parseArithmetic(0)
+	if err != nil {
+		return nil, err
+	}
+	if err := expectKind(op.text, left, right, kindNumber); err != nil {
+		return nil, err
+	}
+	if next := p.peek(); isComparison(next) {
+		return nil, errorAt(next.pos, "comparisons cannot be chained, join them with and")
+	}
+	return &binaryNode{op: op.text, left: left, right: right}, nil
+}
+
+// arithmeticLevels lists the binary arithmetic operators from loosest to tightest
+var arithmeticLevels = [][]string{{"+", "-"}, {"*", "/"}}
+
+func (p *parser) parseArithmetic(level int) (node, error) {
+	if level == len(arithmeticLevels) {
+		return p.parseUnary()
+	}
+	left, err := p.parseArithmetic(level + 1)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		next := p.peek()
+		if next.kind != tokenOperator || (next.text != arithmeticLevels[level][0] && next.text != arithmeticLevels[level][1]) {
+			return left, nil
+		}
+		op := p.take()
+		right, err := p.parseArithmetic(level + 1)
+		if err != nil {
+			return nil, err
+		}
+		if err := expectKind(op.text, left, right, kindNumber); err != nil {
+			return nil, err
+		}
+		left = &binaryNode{op: op.text, left: left, right: right}
+	}
+}
+
+func (p *parser) parseUnary() (node, error) {
+	if next := p.peek(); next.kind != tokenOperator || next.text != "-" {
+		return p.parsePrimary()
+	}
+	minus := p.take()
+	operand, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	if operand.kind() != kindNumber {
+		return nil, errorAt(operand.pos(), "\"-\" needs a number, found %s", operand.kind())
+	}
+	if number, isNumber := operand.(*numberNode); isNumber {
+		return &numberNode{at: minus.pos, value: -number.value}, nil
+	}
+	return &unaryNode{at: minus.pos, op: "-", operand: operand}, nil
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	t := p.take()
+	switch {
+	case t.kind == tokenNumber:
+		return &numberNode{at: t.pos, value: t.value}, nil
+	case t.kind == tokenLParen:
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek().kind != tokenRParen {
+			return nil, errorAt(p.peek().pos, "expected \")\", found %s", p.peek().describe())
+		}
+		p.take()
+		return inner, nil
+	case t.kind != tokenIdent || keywords[t.text]:
+		return nil, errorAt(t.pos, "expected a value, found %s", t.describe())
+	case p.peek().kind == tokenLParen:
+		return p.parseCall(t)
+	case barFields[t.text] != nil:
+		return &fieldNode{at: t.pos, name: t.text}, nil
+	case t.text == "entry_price" || t.text == "bars_held":
+		return &positionNode{at: t.pos, name: t.text}, nil
+	}
+	if _, exists := seriesFunctions[t.text]; exists {
+		return nil, errorAt(t.pos, "%s is a function, call it as %s(...)", t.text, t.text)
+	}
+	return nil, errorAt(t.pos, "unknown name %q", t.text)
+}
+
+func (p *parser) parseCall(name token) (node, error) {
+	p.take()
+	var args []node
+	if p.peek().kind != tokenRParen {
+		for {
+			arg, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, arg)
+			if p.peek().kind != tokenComma {
+				break
+			}
+			p.take()
+		}
+	}
+	if p.peek().kind != tokenRParen {
+		return nil, errorAt(p.peek().pos, "expected \",\" or \")\" in the arguments of %s, found %s", name.text, p.peek().describe())
+	}
+	p.take()
+	return buildCall(name, args)
+}
+
+// expectKind checks that both operands of op are of the wanted kind
+func expectKind(op string, left, right node, want valueKind) error {
+	if left.kind() != want {
+		return errorAt(left.pos(), "%q needs %s on its left, found %s", op, want, left.kind())
+	}
+	if right.kind() != want {
+		return errorAt(right.pos(), "%q needs %s on its right, found %s", op, want, right.kind())
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+// Package rules parses and evaluates declarative trading rules, so a backtest strategy can be
+// written as text instead of Go. A rule set has an entry and an optional exit section:
+//
+//	entry: sma(close,20) crosses_above sma(close,50) and rsi(14) < 70
+//	exit:  close < entry_price*0.93 or bars_held >= 20
+//
+// Sections are separated by newlines or ";" and "#" starts a comment, so a rule file reads like
+// a small YAML mapping. Expressions combine
+//
+//   - bar fields: open, high, low, close, volume
+//   - numbers and the arithmetic operators + - * /
+//   - comparisons < <= > >= == != and the cross operators crosses_above and crosses_below,
+//     which hold on the bar where the left side moves from at or below the right side to above
+//     it (or the reverse)
+//   - conditions joined with and, or, not
+//   - functions, see functions.go; indicators take numeric parameters with the defaults of
+//     indicators.ParseSpec and close-based ones an optional series first, e.g. sma(high,10)
+//   - entry_price and bars_held, which describe the open position and so only exist in exit
+//
+// Values that are not defined yet, such as an SMA before its window is full, make comparisons
+// undefined and undefined conditions never fire.
+package rules
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/Paaaark/hanquant/internal/data"
+)
+
+// Pos is a 1-based line and column in the rule source, counted in characters
+type Pos struct {
+	Line   int
+	Column int
+}
+
+// Error is a problem with the rule source. Line and Column are 0 when it is not tied to a place.
+type Error struct {
+	Line    int    `json:"line,omitempty"`
+	Column  int    `json:"column,omitempty"`
+	Message string `json:"error"`
+}
+
+func (e *Error) Error() string {
+	if e.Line == 0 {
+		return e.Message
+	}
+	return fmt.Sprintf("line %d, column %d: %s", e.Line, e.Column, e.Message)
+}
+
+// Program is a parsed rule set
+type Program struct {
+	entry node
+	exit  node // nil when the rules never sell
+}
+
+// Parse parses and type checks rule source. Errors are *Error values with the position of the problem.
+func Parse(source string) (*Program, error) {
+	tokens, err := tokenize(source)
+	if err != nil {
+		return nil, err
+	}
+	return (&parser{tokens: tokens}).parseProgram()
+}
+
+// Entry returns the entry condition in canonical form, with every operator spelled out
+func (p *Program) Entry() string {
+	return p.entry.String()
+}
+
+// Exit returns the exit condition in canonical form, or "" when there is none
+func (p *Program) Exit() string {
+	if p.exit == nil {
+		return ""
+	}
+	return p.exit.String()
+}
+
+// Position is the open position an exit rule is evaluated against
+type Position struct {
+	EntryPrice float64 // Price the position was bought at
+	BarsHeld   int     // Bars since the entry bar, 0 on the entry bar itself
+}
+
+// Evaluator evaluates a program over the bars of one symbol. Indicator series are computed
+// on first use and kept, so evaluating every bar of a run costs one pass per indicator.
+// An Evaluator is not safe for concurrent use.
+type Evaluator struct {
+	program  *Program
+	bars     []data.StockData
+	series   map[node][]float64
+	position Position
+}
+
+// Bind prepares the program for the oldest-first bars of one symbol
+func (p *Program) Bind(bars []data.StockData) *Evaluator {
+	return &Evaluator{program: p, bars: bars, series: make(map[node][]float64)}
+}
+
+// Entry reports whether the entry condition holds on bar i
+func (e *Evaluator) Entry(i int) bool {
+	return e.holds(e.program.entry, i)
+}
+
+// Exit reports whether the exit condition holds on bar i for the given position
+func (e *Evaluator) Exit(i int, position Position) bool {
+	if e.program.exit == nil {
+		return false
+	}
+	e.position = position
+	return e.holds(e.program.exit, i)
+}
+
+func (e *Evaluator) holds(condition node, i int) bool {
+	if i < 0 || i >= len(e.bars) {
+		return false
+	}
+	return condition.eval(e, i) == 1
+}
+
+// cached returns the series of n over every bar, computing it with compute the first time
+func (e *Evaluator) cached(n node, compute func() []float64) []float64 {
+	values, exists := e.series[n]
+	if !exists {
+		values = compute()
+		e.series[n] = values
+	}
+	return values
+}
+
+// Conditions are numbers too: 1 is true, 0 is false and NaN is undefined
+func condition(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+var undefined = math.NaN()
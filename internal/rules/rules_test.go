@@ -0,0 +1,84 @@
+package rules
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestParseErrorPositions(t *testing.T) {
+	tests := []struct {
+		name         string
+		source       string
+		line, column int
+		message      string
+	}{
+		{"single =", "entry: close = 5", 1, 14, "use =="},
+		{"&& instead of and", "entry: close > 5 && open < 3", 1, 18, "use and / or"},
+		{"unknown character on the second line", "entry: close > 5\nexit: bars_held > 10 or close $ 3", 2, 31, "unexpected character"},
+		{"columns count characters, not bytes", "entry: 종가 > 5 ?", 1, 15, "unexpected character"},
+		{"missing section", "close > 5", 1, 1, "expected a section"},
+		{"unknown section", "entry: close > 5; buy: close > 3", 1, 19, "unknown section"},
+		{"section given twice", "entry: close > 5\nentry: close < 3", 2, 1, "given twice"},
+		{"empty section", "entry:\nexit: close < 3", 2, 1, "is empty"},
+		{"missing operator", "entry: close > 5 open < 3", 1, 18, "expected an operator"},
+		{"not a condition", "entry: close + 1", 1, 8, "must be a condition"},
+		{"chained comparison", "entry: 1 < close < 5", 1, 18, "cannot be chained"},
+		{"position in entry", "entry: close > 5 and bars_held > 3", 1, 22, "only be used in exit"},
+		{"unknown name", "entry: closing > 5", 1, 8, "unknown name"},
+		{"function without a call", "entry: close > sma", 1, 16, "is a function"},
+		{"unclosed call", "entry: sma(close, 20 > 3", 1, 25, "expected \",\" or \")\""},
+		{"unclosed parenthesis", "entry: (close > 5", 1, 18, "expected \")\""},
+		{"and of numbers", "entry: close and open", 1, 8, "needs a condition on its left"},
+		{"not of a number", "entry: not close", 1, 12, "needs a condition"},
+		{"comment does not hide the next line", "entry: close > 5 # fine\n  exit: close <", 2, 16, "expected a value"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(tt.source)
+			var ruleErr *Error
+			if !errors.As(err, &ruleErr) {
+				t.Fatalf("Parse(%q) error = %v, want an *Error", tt.source, err)
+			}
+			if ruleErr.Line != tt.line || ruleErr.Column != tt.column || !strings.Contains(ruleErr.Message, tt.message) {
+				t.Errorf("Parse(%q) = %d:%d %q, want %d:%d containing %q",
+					tt.source, ruleErr.Line, ruleErr.Column, ruleErr.Message, tt.line, tt.column, tt.message)
+			}
+		})
+	}
+}
+
+func TestParseErrorWithoutPosition(t *testing.T) {
+	_, err := Parse("exit: close < 5")
+	var ruleErr *Error
+	if !errors.As(err, &ruleErr) || ruleErr.Line != 0 || ruleErr.Column != 0 {
+		t.Fatalf("Parse without entry = %v, want an *Error without a position", err)
+	}
+	if err.Error() != "rules need an entry section" {
+		t.Errorf("Error() = %q, want the bare message", err.Error())
+	}
+
+	_, err = Parse("entry: close = 5")
+	if want := "line 1, column 14: "; err == nil || !strings.HasPrefix(err.Error(), want) {
+		t.Errorf("Error() = %v, want it to start with %q", err, want)
+	}
+}
+
+func TestParseCanonicalForm(t *testing.T) {
+	program, err := Parse("# trend following\nENTRY: sma(close,20) crosses_above sma(close,50) and rsi(14) < 70\nexit:  close < entry_price*0.93 or bars_held >= 20")
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if program.Entry() == "" || program.Exit() == "" {
+		t.Fatalf("Entry() = %q, Exit() = %q, want both sections", program.Entry(), program.Exit())
+	}
+
+	// The canonical form parses back to itself
+	again, err := Parse("entry: " + program.Entry() + "; exit: " + program.Exit())
+	if err != nil {
+		t.Fatalf("Parse of the canonical form: %v", err)
+	}
+	if again.Entry() != program.Entry() || again.Exit() != program.Exit() {
+		t.Errorf("canonical form changed from %q / %q to %q / %q", program.Entry(), program.Exit(), again.Entry(), again.Exit())
+	}
+}
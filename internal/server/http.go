@@ -40,6 +40,17 @@ func NewHTTPServer() http.Handler {
 	backtestService := service.NewBacktestService(stockService)
 	backtestHandler := handler.NewBacktestHandler(backtestService)
 
+	// Asynchronous backtest jobs need the database to persist results
+	var backtestJobHandler *handler.BacktestJobHandler
+	if db != nil {
+		backtestJobs := service.NewBacktestJobService(db, backtestService, 0)
+		if err := backtestJobs.Start(); err != nil {
+			log.Printf("Warning: failed to start backtest jobs: %v", err)
+		} else {
+			backtestJobHandler = handler.NewBacktestJobHandler(backtestJobs)
+		}
+	}
+
 	wsService := service.NewWebSocketService(kisClient)
 	wsHandler := handler.NewWebSocketHandler(wsService)
 	wsService.Start()
@@ -71,6 +82,7 @@ func NewHTTPServer() http.Handler {
 		})
 		mux.HandleFunc("/accounts_mock/", apiHandler.GetAccountPortfolioMock)
 		mux.HandleFunc("/portfolio", apiHandler.GetPortfolio)
+		mux.HandleFunc("/portfolio/risk", apiHandler.GetPortfolioRisk)
 		mux.HandleFunc("/orders", func(w http.ResponseWriter, r *http.Request) {
 			switch r.Method {
 			case http.MethodPost:
@@ -88,6 +100,9 @@ func NewHTTPServer() http.Handler {
 	// --- Restore all ranking and price endpoints ---
 	mux.HandleFunc("/prices/recent/", apiHandler.GetRecentPrice)
 	mux.HandleFunc("/prices/historical/", apiHandler.GetHistoricalPrice)
+	mux.HandleFunc("/indicators/", apiHandler.GetIndicators)
+	mux.HandleFunc("/corporate-actions/", apiHandler.GetCorporateActions)
+	mux.HandleFunc("/listings", apiHandler.GetListings)
 	mux.HandleFunc("/ranking/fluctuation", apiHandler.GetTopFluctuationStocks)
 	mux.HandleFunc("/ranking/volume", apiHandler.GetMostTradedStocks)
 	mux.HandleFunc("/ranking/market-cap", apiHandler.GetTopMarketCapStocks)
@@ -96,6 +111,16 @@ func NewHTTPServer() http.Handler {
 
 	// --- Backtesting endpoints ---
 	mux.HandleFunc("/backtest/sma", backtestHandler.RunSMABacktest)
+	mux.HandleFunc("/backtest/run", backtestHandler.RunBacktest)
+	mux.HandleFunc("/backtest/strategies", backtestHandler.ListStrategies)
+	mux.HandleFunc("/backtest/optimize", backtestHandler.Optimize)
+	mux.HandleFunc("/backtest/walkforward", backtestHandler.WalkForward)
+	mux.HandleFunc("/backtest/compare", backtestHandler.Compare)
+	mux.HandleFunc("/backtest/rules/check", backtestHandler.CheckRules)
+	if backtestJobHandler != nil {
+		mux.HandleFunc("/backtests", backtestJobHandler.Jobs)
+		mux.HandleFunc("/backtests/", backtestJobHandler.Job)
+	}
 
 	return mux
 }
\ No newline at end of file
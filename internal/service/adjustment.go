@@ -0,0 +1,144 @@
+package service
+
+import (
+	"math"
+	"sort"
+	"strconv"
+
+	"github.com/Paaaark/hanquant/internal/data"
+)
+
+// minActionChange is the smallest jump in the adjusted/raw price ratio that counts as a corporate
+// action. KIS rounds adjusted prices to whole won, which moves the ratio of cheap stocks by a
+// few hundredths of a percent from day to day.
+const minActionChange = 0.005
+
+// detectCorporateActions compares the traded and the KIS-adjusted prices of the same days. Their
+// ratio is constant between capital changes, so every jump marks the first day on a new basis.
+func detectCorporateActions(raw, adjusted data.SlicePriceStruct) []data.CorporateAction {
+	rawClose := make(map[string]float64, len(raw))
+	for _, row := range raw {
+		if value, err := strconv.ParseFloat(row.Close, 64); err == nil && value > 0 {
+			rawClose[row.Date] = value
+		}
+	}
+
+	ratios := make(map[string]float64, len(adjusted))
+	var dates []string
+	for _, row := range adjusted {
+		value, err := strconv.ParseFloat(row.Close, 64)
+		if err != nil || value <= 0 || rawClose[row.Date] == 0 {
+			continue
+		}
+		if _, exists := ratios[row.Date]; !exists {
+			dates = append(dates, row.Date)
+		}
+		ratios[row.Date] = value / rawClose[row.Date]
+	}
+	sort.Strings(dates)
+
+	var actions []data.CorporateAction
+	for i := 1; i < len(dates); i++ {
+		factor := ratios[dates[i-1]] / ratios[dates[i]]
+		if math.Abs(factor-1) <= minActionChange {
+			continue
+		}
+		// Six significant digits are more than the whole-won adjusted prices can resolve
+		factor, _ = strconv.ParseFloat(strconv.FormatFloat(factor, 'g', 6, 64), 64)
+
+		actionType := "capital_change"
+		if factor < 0.8 {
+			actionType = "split"
+		} else if factor > 1.25 {
+			actionType = "reverse_split"
+		}
+		actions = append(actions, data.CorporateAction{Date: dates[i], Type: actionType, Factor: factor, Source: "kis"})
+	}
+	return actions
+}
+
+// mergeCorporateActions adds detected actions to a log. Entries entered by hand are never replaced.
+func mergeCorporateActions(existing, detected []data.CorporateAction) []data.CorporateAction {
+	byDate := make(map[string]data.CorporateAction, len(existing)+len(detected))
+	for _, action := range existing {
+		byDate[action.Date] = action
+	}
+	for _, action := range detected {
+		if current, exists := byDate[action.Date]; exists && current.Source != "kis" {
+			continue
+		}
+		byDate[action.Date] = action
+	}
+
+	merged := make([]data.CorporateAction, 0, len(byDate))
+	for _, action := range byDate {
+		merged = append(merged, action)
+	}
+	sort.Slice(merged, func(i, j int) bool {
+		return merged[i].Date < merged[j].Date
+	})
+	return merged
+}
+
+// adjustmentFactors returns what the price and the volume of a bar traded on date are multiplied
+// by to match today's share basis: the product of the factors of every later action. Dividends
+// move prices but not the share count, so they leave volume alone.
+func adjustmentFactors(actions []data.CorporateAction, date string) (float64, float64) {
+	price, volume := 1.0, 1.0
+	for _, action := range actions {
+		if action.Date <= date {
+			continue
+		}
+		price *= action.Factor
+		if action.Type != "dividend" {
+			volume *= action.Factor
+		}
+	}
+	return price, volume
+}
+
+// adjustPrices returns a copy of prices on today's share basis. Prices are rounded to 0.01 won.
+func adjustPrices(prices data.SlicePriceStruct, actions []data.CorporateAction) data.SlicePriceStruct {
+	if len(actions) == 0 {
+		return prices
+	}
+	adjustPrice := func(value string, factor float64) string {
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return value
+		}
+		return strconv.FormatFloat(math.Round(parsed*factor*100)/100, 'f', -1, 64)
+	}
+
+	adjusted := make(data.SlicePriceStruct, len(prices))
+	for i, row := range prices {
+		priceFactor, volumeFactor := adjustmentFactors(actions, row.Date)
+		adjusted[i] = row
+		if priceFactor == 1 && volumeFactor == 1 {
+			continue
+		}
+		adjusted[i].Open = adjustPrice(row.Open, priceFactor)
+		adjusted[i].High = adjustPrice(row.High, priceFactor)
+		adjusted[i].Low = adjustPrice(row.Low, priceFactor)
+		adjusted[i].Close = adjustPrice(row.Close, priceFactor)
+		if volume, err := strconv.ParseFloat(row.Volume, 64); err == nil {
+			adjusted[i].Volume = strconv.FormatInt(int64(math.Round(volume/volumeFactor)), 10)
+		}
+	}
+	return adjusted
+}
+
+// adjustBars puts bars on today's share basis in place
+func adjustBars(bars []data.StockData, actions []data.CorporateAction) {
+	if len(actions) == 0 {
+		return
+	}
+	for i := range bars {
+		priceFactor, volumeFactor := adjustmentFactors(actions, bars[i].Date.Format("20060102"))
+		bars[i].Open *= priceFactor
+		bars[i].High *= priceFactor
+		bars[i].Low *= priceFactor
+		bars[i].Close *= priceFactor
+		bars[i].Volume = int64(math.Round(float64(bars[i].Volume) / volumeFactor))
+	}
+}
@@ -1,13 +1,14 @@
 package service
 
 import (
+	"context"
 	"fmt"
-	"math"
-	"sort"
-	"strconv"
+	"io"
+	"log"
 	"time"
 
 	"github.com/Paaaark/hanquant/internal/data"
+	"github.com/Paaaark/hanquant/internal/metrics"
 )
 
 type BacktestService struct {
@@ -30,13 +31,6 @@ func NewBacktestService(stockService *StockService) *BacktestService {
 
 // RunSMABacktest executes the SMA crossover strategy backtest
 func (s *BacktestService) RunSMABacktest(params data.BacktestParams) (*data.BacktestResult, error) {
-	// Set default parameters
-	if params.From == "" {
-		params.From = "20170801"
-	}
-	if params.To == "" {
-		params.To = "20250801"
-	}
 	if params.SMA_short == 0 {
 		params.SMA_short = 20
 	}
@@ -49,6 +43,97 @@ func (s *BacktestService) RunSMABacktest(params data.BacktestParams) (*data.Back
 		return nil, err
 	}
 
+	strategy, err := NewSMACrossoverStrategy(params.SMA_short, params.SMA_long)
+	if err != nil {
+		return nil, err
+	}
+	params.Strategy = strategy.Name()
+
+	return s.runStrategy(params, strategy)
+}
+
+// ProgressFunc receives the completed fraction of a backtest, from 0 to 1
+type ProgressFunc func(fraction float64)
+
+// SessionFunc receives the portfolio at the end of every session and every trade of the run so far
+type SessionFunc func(snapshot data.PortfolioSnapshot, trades []data.Trade)
+
+// RunBacktest executes the registered strategy named in params.Strategy, or the rule set in params.Rules
+func (s *BacktestService) RunBacktest(params data.BacktestParams) (*data.BacktestResult, error) {
+	result, err := s.RunBacktestContext(context.Background(), params, nil)
+	if err != nil {
+		return nil, err
+	}
+	compactResult(result)
+	return result, nil
+}
+
+// RunBacktestContext is RunBacktest with cancellation through ctx and optional progress reports.
+// The result keeps a snapshot of every day and no equity curve, for callers that store it.
+func (s *BacktestService) RunBacktestContext(ctx context.Context, params data.BacktestParams, progress ProgressFunc) (*data.BacktestResult, error) {
+	if params.Strategy == "" && params.Rules == "" {
+		return nil, fmt.Errorf("strategy or rules is required")
+	}
+
+	strategy, resolved, err := newRunStrategy(params.Strategy, params.StrategyParams, params.Rules)
+	if err != nil {
+		return nil, err
+	}
+	params.Strategy = strategy.Name()
+	params.StrategyParams = resolved
+
+	prepared, err := s.prepareBacktest(ctx, params, progress)
+	if err != nil {
+		return nil, err
+	}
+	return s.simulate(prepared, prepared.params, strategy)
+}
+
+// runStrategy loads the price history of the universe and drives the strategy over it
+func (s *BacktestService) runStrategy(params data.BacktestParams, strategy Strategy) (*data.BacktestResult, error) {
+	prepared, err := s.prepareBacktest(context.Background(), params, nil)
+	if err != nil {
+		return nil, err
+	}
+	result, err := s.simulate(prepared, prepared.params, strategy)
+	if err != nil {
+		return nil, err
+	}
+	compactResult(result)
+	return result, nil
+}
+
+// preparedBacktest holds everything about a run that does not depend on the strategy, so
+// several strategies or parameter sets can be simulated over the same data
+type preparedBacktest struct {
+	params    data.BacktestParams // with defaults applied
+	universe  []string
+	stockData map[string][]data.StockData
+	days      []data.MarketDay
+	sizer     *positionSizer
+	costs     *costCalculator
+	benchmark *benchmarkSeries // nil unless params.Benchmark is set
+
+	ctx       context.Context // cancels simulate between trading days
+	progress  ProgressFunc    // nil when nobody is listening
+	onSession SessionFunc     // nil when nobody is listening
+}
+
+// report forwards the completed fraction to the progress listener, if any
+func (p *preparedBacktest) report(fraction float64) {
+	if p.progress != nil {
+		p.progress(fraction)
+	}
+}
+
+// prepareBacktest applies defaults, validates params, resolves the universe and loads its history.
+// Loading counts as the first half of the progress reported to progress.
+func (s *BacktestService) prepareBacktest(ctx context.Context, params data.BacktestParams, progress ProgressFunc) (*preparedBacktest, error) {
+	applyBacktestDefaults(&params)
+	if err := s.validateBacktestParams(params); err != nil {
+		return nil, err
+	}
+
 	// Parse dates
 	fromDate, err := time.Parse("20060102", params.From)
 	if err != nil {
@@ -60,40 +145,143 @@ func (s *BacktestService) RunSMABacktest(params data.BacktestParams) (*data.Back
 		return nil, fmt.Errorf("invalid to date: %w", err)
 	}
 
-	// Initialize portfolio
-	portfolio := &data.Portfolio{
-		Cash:      10000000, // 10M KRW starting capital
-		Positions: make(map[string]int),
-		Values:    make(map[string]float64),
-		Total:     10000000,
+	universe, err := s.resolveUniverse(params.Universe, params.From, params.To)
+	if err != nil {
+		return nil, err
 	}
 
 	// Fetch historical data for all stocks in universe
-	stockData, err := s.fetchHistoricalData(params.From, params.To)
+	stockData, err := s.fetchHistoricalData(ctx, universe, params, func(fraction float64) {
+		if progress != nil {
+			progress(fraction / 2)
+		}
+	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch historical data: %w", err)
 	}
+	if params.Universe.PointInTime {
+		universe = loadedSymbols(universe, stockData)
+		if len(universe) == 0 {
+			return nil, fmt.Errorf("no price data for any stock of the universe")
+		}
+	}
+
+	prepared := &preparedBacktest{
+		params:    params,
+		universe:  universe,
+		stockData: stockData,
+		days:      buildMarketDays(universe, stockData, fromDate, toDate),
+		sizer:     newPositionSizer(params.Sizing, len(universe), stockData, barsPerYear(params.Interval)),
+		costs:     newCostCalculator(params.Costs, universe),
+		ctx:       ctx,
+		progress:  progress,
+	}
+	if err := markRebalanceDays(prepared.days, params.Rebalance); err != nil {
+		return nil, fmt.Errorf("failed to build rebalance schedule: %w", err)
+	}
+
+	// Load the benchmark index if one was requested
+	if params.Benchmark != "" {
+		prepared.benchmark, err = s.loadBenchmark(params.Benchmark, params.From, params.To)
+		if err != nil {
+			return nil, err
+		}
+	}
 
-	// Calculate SMAs for all stocks
-	smaData := s.calculateSMAs(stockData, params.SMA_short, params.SMA_long)
+	return prepared, nil
+}
+
+// simulate runs one strategy over prepared data. It only reads from prepared, so it is safe
+// to call concurrently with different strategies; runs on a growing feed reindex a copy of the
+// sizer instead of prepared.sizer.
+func (s *BacktestService) simulate(prepared *preparedBacktest, params data.BacktestParams, strategy Strategy) (*data.BacktestResult, error) {
+	return s.simulateFeed(prepared, params, strategy, newReplayFeed(prepared.days))
+}
+
+// simulateFeed runs one strategy over the steps of feed, which replaces prepared.days
+func (s *BacktestService) simulateFeed(prepared *preparedBacktest, params data.BacktestParams, strategy Strategy, feed Feed) (*data.BacktestResult, error) {
+	// Initialize portfolio
+	portfolio := &data.Portfolio{
+		Cash:      params.InitialCash,
+		Settled:   params.InitialCash,
+		Positions: make(map[string]int),
+		Values:    make(map[string]float64),
+		Total:     params.InitialCash,
+	}
+
+	if err := strategy.Init(prepared.stockData); err != nil {
+		return nil, fmt.Errorf("failed to initialize strategy %s: %w", strategy.Name(), err)
+	}
 
 	// Run backtest
-	trades, portfolioHistory := s.executeStrategy(stockData, smaData, portfolio, fromDate, toDate)
+	trades, portfolioHistory, broker, err := s.executeStrategy(prepared, feed, strategy, portfolio)
+	if err != nil {
+		return nil, err
+	}
 
-	// Calculate metrics
-	metrics := s.calculateMetrics(portfolioHistory, trades)
+	// Match entries to exits and calculate metrics
+	roundTrips := buildRoundTrips(trades)
+	backtestMetrics := s.calculateMetrics(portfolioHistory, trades, roundTrips, params.RiskFreeRate)
+	backtestMetrics.InterestIncome = broker.settlement.interestIncome
+	backtestMetrics.MarginInterest = broker.settlement.marginInterest
 
 	result := &data.BacktestResult{
 		Params:           params,
 		PortfolioHistory: portfolioHistory,
 		Trades:           trades,
-		Metrics:          metrics,
-		Universe:         s.universe,
+		RoundTrips:       roundTrips,
+		Metrics:          backtestMetrics,
+		Universe:         prepared.universe,
+		Orders:           broker.orders(),
+	}
+
+	// Compare against the benchmark index if one was requested
+	if prepared.benchmark != nil {
+		result.Benchmark = s.buildBenchmarkComparison(portfolioHistory, prepared.benchmark, params.RiskFreeRate)
 	}
 
 	return result, nil
 }
 
+// applyBacktestDefaults fills in every parameter of a run the request left empty
+func applyBacktestDefaults(params *data.BacktestParams) {
+	if params.From == "" {
+		params.From = "20170801"
+	}
+	if params.To == "" {
+		params.To = "20250801"
+	}
+	if params.InitialCash == 0 {
+		params.InitialCash = defaultInitialCash
+	}
+	applySizingDefaults(&params.Sizing)
+	applyCostDefaults(&params.Costs)
+	applyExecutionDefaults(&params.Execution)
+	applySettlementDefaults(&params.Settlement)
+	applyRebalanceDefaults(params)
+	applySnapshotDefaults(params)
+}
+
+// validateBacktestParams checks params with defaults applied, without loading any data
+func (s *BacktestService) validateBacktestParams(params data.BacktestParams) error {
+	if err := s.validateDateRange(params); err != nil {
+		return err
+	}
+	if err := s.validatePortfolioParams(params); err != nil {
+		return err
+	}
+	if err := validateInterval(params); err != nil {
+		return err
+	}
+	if err := validateSource(params); err != nil {
+		return err
+	}
+	if err := validateRebalance(params.Rebalance); err != nil {
+		return err
+	}
+	return validateSnapshots(params.Snapshots)
+}
+
 func (s *BacktestService) validateParams(params data.BacktestParams) error {
 	if params.SMA_short >= params.SMA_long {
 		return fmt.Errorf("short SMA window must be less than long SMA window")
@@ -103,10 +291,45 @@ func (s *BacktestService) validateParams(params data.BacktestParams) error {
 		return fmt.Errorf("SMA windows must be positive integers")
 	}
 
+	return nil
+}
+
+func (s *BacktestService) validatePortfolioParams(params data.BacktestParams) error {
+	if params.InitialCash < minInitialCash {
+		return fmt.Errorf("initial cash must be at least %d KRW", minInitialCash)
+	}
+	if err := validateUniverse(params.Universe); err != nil {
+		return err
+	}
+	if err := validateSizing(params.Sizing, params.InitialCash); err != nil {
+		return err
+	}
+	if err := validateBenchmark(params.Benchmark); err != nil {
+		return err
+	}
+	if params.RiskFreeRate < -0.1 || params.RiskFreeRate > 0.5 {
+		return fmt.Errorf("risk_free_rate must be an annual fraction between -0.1 and 0.5")
+	}
+	if err := validateExecution(params.Execution); err != nil {
+		return err
+	}
+	if err := validateSettlement(params.Settlement); err != nil {
+		return err
+	}
+	return validateCosts(params.Costs)
+}
+
+func (s *BacktestService) validateDateRange(params data.BacktestParams) error {
+	if _, err := time.Parse("20060102", params.From); params.From != "" && err != nil {
+		return fmt.Errorf("invalid from date: %w", err)
+	}
 	today := time.Now()
 	if params.To != "" {
 		toDate, err := time.Parse("20060102", params.To)
-		if err == nil && toDate.After(today) {
+		if err != nil {
+			return fmt.Errorf("invalid to date: %w", err)
+		}
+		if toDate.After(today) {
 			return fmt.Errorf("end date cannot be in the future")
 		}
 	}
@@ -114,168 +337,144 @@ func (s *BacktestService) validateParams(params data.BacktestParams) error {
 	return nil
 }
 
-func (s *BacktestService) fetchHistoricalData(from, to string) (map[string][]data.StockData, error) {
+// fetchHistoricalData loads daily bars of the universe, or intraday bars when interval is set,
+// from the source params names. Point-in-time universes include delisted stocks, which often
+// have no bars left to load; those are skipped with a warning instead of failing the run.
+func (s *BacktestService) fetchHistoricalData(ctx context.Context, universe []string, params data.BacktestParams, progress ProgressFunc) (map[string][]data.StockData, error) {
+	from, to := params.From, params.To
+	interval, adjusted := params.Interval, params.Adjusted
 	stockData := make(map[string][]data.StockData)
 
-	for _, symbol := range s.universe {
-		data, err := s.stockService.GetHistoricalPrice(symbol, from, to, "D")
-		if err != nil {
-			return nil, fmt.Errorf("failed to fetch data for %s: %w", symbol, err)
+	for i, symbol := range universe {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		progress(float64(i) / float64(len(universe)))
+
+		var bars []data.StockData
+		var err error
+		if params.Source == "csv" {
+			bars, err = LoadCSVBars(csvDataDir(), symbol, from, to)
+		} else if interval > 0 {
+			bars, err = s.stockService.GetMinuteBars(ctx, symbol, from, to, interval, adjusted)
+		} else {
+			bars, err = s.stockService.GetDailyBars(symbol, from, to, adjusted)
+		}
+		if params.Universe.PointInTime && ctx.Err() == nil && (err != nil || len(bars) == 0) {
+			if err == nil {
+				err = fmt.Errorf("no bars between %s and %s", from, to)
+			}
+			log.Printf("backtest: skipping %s of the point-in-time universe: %v", symbol, err)
+			continue
 		}
-
-		// Convert to StockData format
-		convertedData, err := s.convertToStockData(symbol, data)
 		if err != nil {
-			return nil, fmt.Errorf("failed to convert data for %s: %w", symbol, err)
+			return nil, err
 		}
-
-		stockData[symbol] = convertedData
+		stockData[symbol] = bars
 	}
 
 	return stockData, nil
 }
 
-func (s *BacktestService) convertToStockData(symbol string, rawData interface{}) ([]data.StockData, error) {
-	var result []data.StockData
-
-	// Try to convert from SlicePriceStruct
-	if sliceData, ok := rawData.(data.SlicePriceStruct); ok {
-		for _, price := range sliceData {
-			// Parse date
-			date, err := time.Parse("20060102", price.Date)
-			if err != nil {
-				continue // Skip invalid dates
-			}
-
-			// Parse numeric values
-			open, _ := strconv.ParseFloat(price.Open, 64)
-			high, _ := strconv.ParseFloat(price.High, 64)
-			low, _ := strconv.ParseFloat(price.Low, 64)
-			close, _ := strconv.ParseFloat(price.Close, 64)
-			volume, _ := strconv.ParseInt(price.Volume, 10, 64)
-
-			stockData := data.StockData{
-				Symbol: symbol,
-				Date:   date,
-				Open:   open,
-				High:   high,
-				Low:    low,
-				Close:  close,
-				Volume: volume,
-			}
-
-			result = append(result, stockData)
-		}
-		return result, nil
+// executeStrategy walks the steps of feed, trading days or intraday bars, in order. On each step
+// the broker first fills orders from earlier steps, then the strategy sees the step and submits
+// new ones. The portfolio is recorded once per session, at its last step. The broker is returned
+// for its order records and settlement totals.
+// It stops early with the context error if prepared.ctx is cancelled.
+func (s *BacktestService) executeStrategy(prepared *preparedBacktest, feed Feed, strategy Strategy, portfolio *data.Portfolio) ([]data.Trade, []data.PortfolioSnapshot, *broker, error) {
+	var trades []data.Trade
+	var portfolioHistory []data.PortfolioSnapshot
+	broker := newBroker(prepared)
+	steps := 0
+	if replay, ok := feed.(*replayFeed); ok {
+		steps = replay.Len()
 	}
 
-	// If not SlicePriceStruct, return empty result
-	return result, nil
-}
+	// Latest bar of each symbol in the current session, for flattening at the close
+	sessionBars := make(map[string]data.StockData)
 
-func (s *BacktestService) calculateSMAs(stockData map[string][]data.StockData, shortWindow, longWindow int) map[string]data.SMACalculation {
-	smaData := make(map[string]data.SMACalculation)
+	// A growing feed reindexes the sizer, so the run gets its own
+	grown, growing := feed.(growingFeed)
+	if growing {
+		sizer := *prepared.sizer
+		broker.sizer = &sizer
+	}
+	historyBars := historySize(prepared.stockData)
 
-	for symbol, stockDataSlice := range stockData {
-		if len(stockDataSlice) < longWindow {
-			continue
+	for i := 0; ; i++ {
+		// Report progress every few weeks of trading
+		if i%20 == 0 && steps > 0 {
+			prepared.report(0.5 + 0.5*float64(i)/float64(steps))
 		}
-
-		shortSMA := make([]float64, 0)
-		longSMA := make([]float64, 0)
-		dates := make([]string, 0)
-
-		// Calculate short SMA
-		for i := shortWindow - 1; i < len(stockDataSlice); i++ {
-			sum := 0.0
-			for j := 0; j < shortWindow; j++ {
-				sum += stockDataSlice[i-j].Close
-			}
-			shortSMA = append(shortSMA, sum/float64(shortWindow))
+		day, err := feed.Next(prepared.ctx)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, nil, err
 		}
 
-		// Calculate long SMA
-		for i := longWindow - 1; i < len(stockDataSlice); i++ {
-			sum := 0.0
-			for j := 0; j < longWindow; j++ {
-				sum += stockDataSlice[i-j].Close
+		// Bars that arrived after Init have to reach the strategy and the sizer
+		if growing {
+			if history := grown.History(); history != nil && historySize(history) != historyBars {
+				if err := extendStrategy(strategy, history); err != nil {
+					return nil, nil, nil, fmt.Errorf("failed to extend strategy %s: %w", strategy.Name(), err)
+				}
+				broker.sizer.reindex(history)
+				historyBars = historySize(history)
 			}
-			longSMA = append(longSMA, sum/float64(longWindow))
 		}
 
-		// Align dates
-		for i := longWindow - 1; i < len(stockDataSlice); i++ {
-			dates = append(dates, stockDataSlice[i].Date.Format("2006-01-02"))
-		}
+		// Fill working orders against this step's prices
+		broker.startStep(day, portfolio)
+		trades = append(trades, broker.process(day, portfolio)...)
 
-		smaData[symbol] = data.SMACalculation{
-			ShortSMA: shortSMA,
-			LongSMA:  longSMA,
-			Dates:    dates,
+		// Update portfolio values
+		s.updatePortfolioValues(portfolio, day)
+		for _, bar := range day.Bars {
+			sessionBars[bar.Symbol] = bar
 		}
-	}
-
-	return smaData
-}
 
-func (s *BacktestService) executeStrategy(stockData map[string][]data.StockData, smaData map[string]data.SMACalculation, portfolio *data.Portfolio, fromDate, toDate time.Time) ([]data.Trade, []data.PortfolioSnapshot) {
-	var trades []data.Trade
-	var portfolioHistory []data.PortfolioSnapshot
+		// Queue the orders the strategy emits for this day
+		for _, order := range strategy.OnDay(day, portfolio) {
+			broker.submit(order, day, portfolio)
+		}
+		broker.endStep(day)
 
-	// Get all trading dates
-	tradingDates := s.getTradingDates(stockData, fromDate, toDate)
+		if !day.SessionEnd {
+			continue
+		}
 
-	for _, date := range tradingDates {
-		// Update portfolio values
-		s.updatePortfolioValues(portfolio, stockData, date)
-
-		// Check for trading signals
-		for _, symbol := range s.universe {
-			if signal := s.checkSMASignal(smaData, symbol, date); signal != "" {
-				trade := s.executeTrade(portfolio, symbol, signal, stockData, date)
-				if trade != nil {
-					trades = append(trades, *trade)
+		// Sell whatever is still held at its last price of the session
+		if prepared.params.FlatAtClose {
+			for _, symbol := range prepared.universe {
+				if bar, exists := sessionBars[symbol]; exists && portfolio.Positions[symbol] > 0 {
+					if trade := broker.closePosition(bar, day, portfolio); trade != nil {
+						trades = append(trades, *trade)
+					}
 				}
 			}
+			s.updatePortfolioValues(portfolio, day)
 		}
+		clear(sessionBars)
+		broker.endSession()
 
 		// Record portfolio snapshot
 		snapshot := data.PortfolioSnapshot{
-			Date:      date.Format("2006-01-02"),
-			Portfolio: *portfolio,
+			Date:      day.Date.Format("2006-01-02"),
+			Portfolio: snapshotPortfolio(portfolio),
 		}
 		portfolioHistory = append(portfolioHistory, snapshot)
-	}
-
-	return trades, portfolioHistory
-}
-
-func (s *BacktestService) getTradingDates(stockData map[string][]data.StockData, fromDate, toDate time.Time) []time.Time {
-	// Get all unique dates from stock data
-	dateSet := make(map[string]bool)
-	var dates []time.Time
-
-	for _, data := range stockData {
-		for _, stock := range data {
-			if stock.Date.After(fromDate) && stock.Date.Before(toDate) {
-				dateStr := stock.Date.Format("2006-01-02")
-				if !dateSet[dateStr] {
-					dateSet[dateStr] = true
-					dates = append(dates, stock.Date)
-				}
-			}
+		if prepared.onSession != nil {
+			prepared.onSession(snapshot, trades)
 		}
 	}
+	prepared.report(1)
 
-	// Sort dates
-	sort.Slice(dates, func(i, j int) bool {
-		return dates[i].Before(dates[j])
-	})
-
-	return dates
+	return trades, portfolioHistory, broker, nil
 }
 
-func (s *BacktestService) updatePortfolioValues(portfolio *data.Portfolio, stockData map[string][]data.StockData, date time.Time) {
+func (s *BacktestService) updatePortfolioValues(portfolio *data.Portfolio, day data.MarketDay) {
 	portfolio.Total = portfolio.Cash
 
 	for symbol, quantity := range portfolio.Positions {
@@ -283,123 +482,15 @@ func (s *BacktestService) updatePortfolioValues(portfolio *data.Portfolio, stock
 			continue
 		}
 
-		// Find price for this date
-		if data, exists := stockData[symbol]; exists {
-			for _, stock := range data {
-				if stock.Date.Equal(date) {
-					value := float64(quantity) * stock.Close
-					portfolio.Values[symbol] = value
-					portfolio.Total += value
-					break
-				}
-			}
-		}
-	}
-}
-
-func (s *BacktestService) checkSMASignal(smaData map[string]data.SMACalculation, symbol string, date time.Time) string {
-	calculation, exists := smaData[symbol]
-	if !exists {
-		return ""
-	}
-
-	dateStr := date.Format("2006-01-02")
-	
-	// Find index for this date
-	var idx int = -1
-	for i, d := range calculation.Dates {
-		if d == dateStr {
-			idx = i
-			break
-		}
-	}
-
-	if idx < 1 || idx >= len(calculation.ShortSMA) || idx >= len(calculation.LongSMA) {
-		return ""
-	}
-
-	// Check for crossover
-	prevShort := calculation.ShortSMA[idx-1]
-	prevLong := calculation.LongSMA[idx-1]
-	currShort := calculation.ShortSMA[idx]
-	currLong := calculation.LongSMA[idx]
-
-	// Golden cross: short SMA crosses above long SMA
-	if prevShort <= prevLong && currShort > currLong {
-		return "BUY"
-	}
-
-	// Death cross: short SMA crosses below long SMA
-	if prevShort >= prevLong && currShort < currLong {
-		return "SELL"
-	}
-
-	return ""
-}
-
-func (s *BacktestService) executeTrade(portfolio *data.Portfolio, symbol, signal string, stockData map[string][]data.StockData, date time.Time) *data.Trade {
-	// Find current price
-	var currentPrice float64
-	if data, exists := stockData[symbol]; exists {
-		for _, stock := range data {
-			if stock.Date.Equal(date) {
-				currentPrice = stock.Close
-				break
-			}
-		}
-	}
-
-	if currentPrice == 0 {
-		return nil
-	}
-
-	var trade *data.Trade
-
-	if signal == "BUY" && portfolio.Cash > 0 {
-		// Calculate position size (10% of portfolio per stock)
-		positionValue := portfolio.Total * 0.1
-		quantity := int(positionValue / currentPrice)
-		
-		if quantity > 0 {
-			tradeValue := float64(quantity) * currentPrice
-			if tradeValue <= portfolio.Cash {
-				portfolio.Cash -= tradeValue
-				portfolio.Positions[symbol] += quantity
-				
-				trade = &data.Trade{
-					Date:      date.Format("2006-01-02"),
-					Symbol:    symbol,
-					Side:      "BUY",
-					Quantity:  quantity,
-					Price:     currentPrice,
-					Value:     tradeValue,
-					Portfolio: portfolio.Total,
-				}
-			}
-		}
-	} else if signal == "SELL" && portfolio.Positions[symbol] > 0 {
-		quantity := portfolio.Positions[symbol]
-		tradeValue := float64(quantity) * currentPrice
-		
-		portfolio.Cash += tradeValue
-		portfolio.Positions[symbol] = 0
-		delete(portfolio.Values, symbol)
-		
-		trade = &data.Trade{
-			Date:      date.Format("2006-01-02"),
-			Symbol:    symbol,
-			Side:      "SELL",
-			Quantity:  quantity,
-			Price:     currentPrice,
-			Value:     tradeValue,
-			Portfolio: portfolio.Total,
+		// Use today's close, or the last known value if the symbol did not trade today
+		if bar, exists := day.Bar(symbol); exists {
+			portfolio.Values[symbol] = float64(quantity) * bar.Close
 		}
+		portfolio.Total += portfolio.Values[symbol]
 	}
-
-	return trade
 }
 
-func (s *BacktestService) calculateMetrics(portfolioHistory []data.PortfolioSnapshot, trades []data.Trade) data.BacktestMetrics {
+func (s *BacktestService) calculateMetrics(portfolioHistory []data.PortfolioSnapshot, trades []data.Trade, roundTrips []data.RoundTrip, riskFreeRate float64) data.BacktestMetrics {
 	if len(portfolioHistory) < 2 {
 		return data.BacktestMetrics{}
 	}
@@ -411,107 +502,55 @@ func (s *BacktestService) calculateMetrics(portfolioHistory []data.PortfolioSnap
 	totalReturn := (finalValue - initialValue) / initialValue * 100
 	totalPnL := finalValue - initialValue
 
-	// Calculate daily returns for Sharpe ratio
-	var dailyReturns []float64
-	for i := 1; i < len(portfolioHistory); i++ {
-		prevValue := portfolioHistory[i-1].Portfolio.Total
-		currValue := portfolioHistory[i].Portfolio.Total
-		if prevValue > 0 {
-			dailyReturn := (currValue - prevValue) / prevValue
-			dailyReturns = append(dailyReturns, dailyReturn)
-		}
-	}
+	// Sharpe, drawdowns and the other equity-curve statistics
+	risk := metrics.Compute(metrics.FromSnapshots(portfolioHistory), metrics.Options{RiskFreeRate: riskFreeRate})
 
-	// Calculate Sharpe ratio (assuming 0% risk-free rate)
-	sharpeRatio := 0.0
-	if len(dailyReturns) > 0 {
-		meanReturn := s.calculateMean(dailyReturns)
-		stdDev := s.calculateStdDev(dailyReturns, meanReturn)
-		if stdDev > 0 {
-			sharpeRatio = meanReturn / stdDev * math.Sqrt(252) // Annualized
-		}
+	result := data.BacktestMetrics{
+		TotalReturn: totalReturn,
+		TotalPnL:    totalPnL,
+		SharpeRatio: risk.SharpeRatio,
+		MaxDrawdown: risk.MaxDrawdown,
+		TotalTrades: len(trades),
+		Risk:        risk,
 	}
+	s.addCostMetrics(&result, trades, initialValue)
 
-	// Calculate max drawdown
-	maxDrawdown := s.calculateMaxDrawdown(portfolioHistory)
+	// Calculate trade metrics from the round-trip ledger
+	calculateRoundTripMetrics(&result, roundTrips)
 
-	// Calculate trade metrics
-	winRate, avgTradeReturn := s.calculateTradeMetrics(trades, initialValue)
-
-	return data.BacktestMetrics{
-		TotalReturn:    totalReturn,
-		TotalPnL:       totalPnL,
-		SharpeRatio:    sharpeRatio,
-		MaxDrawdown:    maxDrawdown,
-		TotalTrades:    len(trades),
-		WinRate:        winRate,
-		AvgTradeReturn: avgTradeReturn,
-	}
-}
-
-func (s *BacktestService) calculateMean(values []float64) float64 {
-	if len(values) == 0 {
-		return 0
-	}
-	sum := 0.0
-	for _, v := range values {
-		sum += v
-	}
-	return sum / float64(len(values))
+	return result
 }
 
-func (s *BacktestService) calculateStdDev(values []float64, mean float64) float64 {
-	if len(values) == 0 {
-		return 0
+// addCostMetrics sums the costs of all trades and derives the return before costs.
+// Costs are added back without compounding, which slightly understates the gross return.
+func (s *BacktestService) addCostMetrics(metrics *data.BacktestMetrics, trades []data.Trade, initialValue float64) {
+	for _, trade := range trades {
+		metrics.TotalCommission += trade.Commission
+		metrics.TotalTax += trade.Tax
+		metrics.TotalSlippage += trade.Slippage
 	}
-	sum := 0.0
-	for _, v := range values {
-		sum += math.Pow(v-mean, 2)
+	metrics.TotalCosts = metrics.TotalCommission + metrics.TotalTax + metrics.TotalSlippage
+	if initialValue > 0 {
+		metrics.GrossReturn = (metrics.TotalPnL + metrics.TotalCosts) / initialValue * 100
 	}
-	return math.Sqrt(sum / float64(len(values)))
 }
 
-func (s *BacktestService) calculateMaxDrawdown(portfolioHistory []data.PortfolioSnapshot) float64 {
-	if len(portfolioHistory) == 0 {
-		return 0
+// historySize counts the bars of history, to tell when a growing feed has added some
+func historySize(history map[string][]data.StockData) int {
+	size := 0
+	for _, bars := range history {
+		size += len(bars)
 	}
-
-	maxValue := portfolioHistory[0].Portfolio.Total
-	maxDrawdown := 0.0
-
-	for _, snapshot := range portfolioHistory {
-		if snapshot.Portfolio.Total > maxValue {
-			maxValue = snapshot.Portfolio.Total
-		}
-		
-		drawdown := (maxValue - snapshot.Portfolio.Total) / maxValue * 100
-		if drawdown > maxDrawdown {
-			maxDrawdown = drawdown
-		}
-	}
-
-	return maxDrawdown
+	return size
 }
 
-func (s *BacktestService) calculateTradeMetrics(trades []data.Trade, initialValue float64) (float64, float64) {
-	if len(trades) == 0 {
-		return 0, 0
-	}
-
-	wins := 0
-	totalReturn := 0.0
-
-	for _, trade := range trades {
-		if trade.Side == "SELL" {
-			// Calculate return for this trade
-			// This is simplified - in practice you'd track entry/exit prices
-			totalReturn += trade.Value
-			wins++
+// loadedSymbols keeps the symbols of universe that have bars in stockData, in order
+func loadedSymbols(universe []string, stockData map[string][]data.StockData) []string {
+	var loaded []string
+	for _, symbol := range universe {
+		if len(stockData[symbol]) > 0 {
+			loaded = append(loaded, symbol)
 		}
 	}
-
-	winRate := float64(wins) / float64(len(trades)) * 100
-	avgTradeReturn := totalReturn / float64(len(trades))
-
-	return winRate, avgTradeReturn
+	return loaded
 }
@@ -0,0 +1,279 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/Paaaark/hanquant/internal/data"
+)
+
+const (
+	defaultJobWorkers     = 2
+	jobQueueSize          = 256
+	jobProgressInterval   = time.Second // minimum time between progress writes
+	defaultJobListLimit   = 50
+	maxJobListLimit       = 200
+	interruptedJobMessage = "interrupted by server restart"
+)
+
+// ErrJobNotFound is returned when a job does not exist or belongs to another user
+var ErrJobNotFound = errors.New("backtest job not found")
+
+// ErrJobNotDone is returned when a job has no result to analyze yet
+var ErrJobNotDone = errors.New("backtest job is not done")
+
+// BacktestJobService runs backtests asynchronously on a fixed pool of workers and persists
+// their results through the backtest_jobs tables
+type BacktestJobService struct {
+	db        *sql.DB
+	backtests *BacktestService
+	workers   int
+	queue     chan int64
+
+	mu      sync.Mutex
+	running map[int64]context.CancelFunc
+}
+
+// NewBacktestJobService creates a job service with the given number of workers (default 2)
+func NewBacktestJobService(db *sql.DB, backtests *BacktestService, workers int) *BacktestJobService {
+	if workers <= 0 {
+		workers = defaultJobWorkers
+	}
+	return &BacktestJobService{
+		db:        db,
+		backtests: backtests,
+		workers:   workers,
+		queue:     make(chan int64, jobQueueSize),
+		running:   make(map[int64]context.CancelFunc),
+	}
+}
+
+// Start launches the workers. Jobs left RUNNING by a previous process are marked FAILED and
+// jobs still QUEUED are picked up again.
+func (s *BacktestJobService) Start() error {
+	interrupted, err := data.ListBacktestJobIDsByStatus(s.db, data.BacktestJobRunning)
+	if err != nil {
+		return fmt.Errorf("failed to list running backtest jobs: %w", err)
+	}
+	for _, id := range interrupted {
+		if err := data.SetBacktestJobStatus(s.db, id, data.BacktestJobFailed, interruptedJobMessage); err != nil {
+			return err
+		}
+	}
+
+	queued, err := data.ListBacktestJobIDsByStatus(s.db, data.BacktestJobQueued)
+	if err != nil {
+		return fmt.Errorf("failed to list queued backtest jobs: %w", err)
+	}
+
+	for i := 0; i < s.workers; i++ {
+		go s.worker()
+	}
+	go func() {
+		for _, id := range queued {
+			s.queue <- id
+		}
+	}()
+	return nil
+}
+
+// Submit validates params, stores a QUEUED job for the user and hands it to the workers
+func (s *BacktestJobService) Submit(userID int64, params data.BacktestParams) (*data.BacktestJob, error) {
+	if params.Strategy == "" && params.Rules == "" {
+		return nil, fmt.Errorf("strategy or rules is required")
+	}
+	if _, _, err := newRunStrategy(params.Strategy, params.StrategyParams, params.Rules); err != nil {
+		return nil, err
+	}
+	// Reject bad params now rather than in a worker; the job keeps the params as submitted
+	resolved := params
+	applyBacktestDefaults(&resolved)
+	if err := s.backtests.validateBacktestParams(resolved); err != nil {
+		return nil, err
+	}
+
+	job := &data.BacktestJob{UserID: userID, Params: params}
+	if err := data.CreateBacktestJob(s.db, job); err != nil {
+		return nil, fmt.Errorf("failed to create backtest job: %w", err)
+	}
+
+	select {
+	case s.queue <- job.ID:
+	default:
+		data.SetBacktestJobStatus(s.db, job.ID, data.BacktestJobFailed, "backtest queue is full")
+		return nil, fmt.Errorf("backtest queue is full, try again later")
+	}
+	return job, nil
+}
+
+// Get returns a job of the user with its trades, equity curve and the position snapshots its
+// params ask for once it is done
+func (s *BacktestJobService) Get(userID, jobID int64) (*data.BacktestJob, error) {
+	job, err := s.find(userID, jobID)
+	if err != nil {
+		return nil, err
+	}
+	compactJob(job)
+	return job, nil
+}
+
+// Export returns a finished job of the user with a snapshot of every day, for WriteExport
+func (s *BacktestJobService) Export(userID, jobID int64) (*data.BacktestJob, error) {
+	job, err := s.find(userID, jobID)
+	if err != nil {
+		return nil, err
+	}
+	if job.Status != data.BacktestJobDone {
+		return nil, ErrJobNotDone
+	}
+	return job, nil
+}
+
+// find loads a job of the user with its full daily history
+func (s *BacktestJobService) find(userID, jobID int64) (*data.BacktestJob, error) {
+	job, err := data.GetBacktestJob(s.db, userID, jobID)
+	if err != nil {
+		return nil, err
+	}
+	if job == nil {
+		return nil, ErrJobNotFound
+	}
+	return job, nil
+}
+
+// List returns the user's most recent jobs, newest first
+func (s *BacktestJobService) List(userID int64, limit int) ([]data.BacktestJob, error) {
+	if limit <= 0 {
+		limit = defaultJobListLimit
+	}
+	if limit > maxJobListLimit {
+		limit = maxJobListLimit
+	}
+	return data.ListBacktestJobsByUserID(s.db, userID, limit)
+}
+
+// Cancel stops a queued or running job of the user. Finished jobs are returned unchanged.
+func (s *BacktestJobService) Cancel(userID, jobID int64) (*data.BacktestJob, error) {
+	job, err := s.find(userID, jobID)
+	if err != nil {
+		return nil, err
+	}
+
+	switch job.Status {
+	case data.BacktestJobQueued:
+		if _, err := data.CancelQueuedBacktestJob(s.db, userID, jobID); err != nil {
+			return nil, err
+		}
+	case data.BacktestJobRunning:
+		s.mu.Lock()
+		cancel, exists := s.running[jobID]
+		s.mu.Unlock()
+		if exists {
+			cancel()
+		}
+	}
+	return s.Get(userID, jobID)
+}
+
+// AnalyzeRobustness runs a robustness analysis of a finished job of the user and stores it with the job
+func (s *BacktestJobService) AnalyzeRobustness(userID, jobID int64, params data.RobustnessParams) (*data.RobustnessAnalysis, error) {
+	job, err := s.Export(userID, jobID)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := AnalyzeRobustness(params, job.PortfolioHistory, job.Trades, job.Params.InitialCash, job.Params.RiskFreeRate)
+	if err != nil {
+		return nil, err
+	}
+	analysis := &data.RobustnessAnalysis{JobID: jobID, RobustnessResult: *result}
+	if err := data.CreateBacktestRobustness(s.db, analysis); err != nil {
+		return nil, fmt.Errorf("failed to save robustness analysis: %w", err)
+	}
+	return analysis, nil
+}
+
+// ListRobustness returns the stored robustness analyses of a job of the user, newest first
+func (s *BacktestJobService) ListRobustness(userID, jobID int64) ([]data.RobustnessAnalysis, error) {
+	if _, err := s.find(userID, jobID); err != nil {
+		return nil, err
+	}
+	return data.ListBacktestRobustness(s.db, jobID)
+}
+
+func (s *BacktestJobService) worker() {
+	for id := range s.queue {
+		s.run(id)
+	}
+}
+
+// run executes one job and records its outcome. A panicking strategy fails the job instead of
+// taking the worker, and the server, down with it.
+func (s *BacktestJobService) run(jobID int64) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("backtest job %d: panic: %v", jobID, r)
+			s.fail(jobID, data.BacktestJobFailed, fmt.Sprint(r))
+		}
+	}()
+
+	claimed, err := data.ClaimBacktestJob(s.db, jobID)
+	if err != nil {
+		log.Printf("backtest job %d: failed to claim: %v", jobID, err)
+		return
+	}
+	if !claimed {
+		return // cancelled while queued
+	}
+
+	params, err := data.GetBacktestJobParams(s.db, jobID)
+	if err != nil {
+		s.fail(jobID, data.BacktestJobFailed, fmt.Sprintf("failed to load params: %v", err))
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.mu.Lock()
+	s.running[jobID] = cancel
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.running, jobID)
+		s.mu.Unlock()
+		cancel()
+	}()
+
+	var lastReport time.Time
+	result, err := s.backtests.RunBacktestContext(ctx, *params, func(fraction float64) {
+		if time.Since(lastReport) < jobProgressInterval {
+			return
+		}
+		lastReport = time.Now()
+		if err := data.UpdateBacktestJobProgress(s.db, jobID, fraction); err != nil {
+			log.Printf("backtest job %d: failed to update progress: %v", jobID, err)
+		}
+	})
+	if errors.Is(err, context.Canceled) {
+		s.fail(jobID, data.BacktestJobCancelled, "")
+		return
+	}
+	if err != nil {
+		s.fail(jobID, data.BacktestJobFailed, err.Error())
+		return
+	}
+
+	if err := data.SaveBacktestResult(s.db, jobID, result); err != nil {
+		s.fail(jobID, data.BacktestJobFailed, fmt.Sprintf("failed to save result: %v", err))
+	}
+}
+
+func (s *BacktestJobService) fail(jobID int64, status, message string) {
+	if err := data.SetBacktestJobStatus(s.db, jobID, status, message); err != nil {
+		log.Printf("backtest job %d: failed to set status %s: %v", jobID, status, err)
+	}
+}
@@ -0,0 +1,219 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Paaaark/hanquant/internal/data"
+)
+
+// jobStore is an in-memory backtest_jobs table behind a database/sql driver, answering the few
+// statements the job service issues
+type jobStore struct {
+	mu       sync.Mutex
+	params   map[int64]string
+	statuses map[int64]string
+	errors   map[int64]string
+	finished chan int64
+}
+
+var (
+	jobStoresMu sync.Mutex
+	jobStores   = make(map[string]*jobStore)
+)
+
+func init() {
+	sql.Register("backtest_jobs_test", jobDriver{})
+	RegisterStrategy(data.StrategyInfo{Name: "panic_test"}, func(params map[string]float64) (Strategy, error) {
+		return panickingStrategy{}, nil
+	})
+}
+
+func openJobStore(t *testing.T) (*sql.DB, *jobStore) {
+	store := &jobStore{
+		params:   make(map[int64]string),
+		statuses: make(map[int64]string),
+		errors:   make(map[int64]string),
+		finished: make(chan int64, 1),
+	}
+	jobStoresMu.Lock()
+	jobStores[t.Name()] = store
+	jobStoresMu.Unlock()
+
+	db, err := sql.Open("backtest_jobs_test", t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db, store
+}
+
+type jobDriver struct{}
+
+func (jobDriver) Open(name string) (driver.Conn, error) {
+	jobStoresMu.Lock()
+	defer jobStoresMu.Unlock()
+	store, exists := jobStores[name]
+	if !exists {
+		return nil, fmt.Errorf("no job store %q", name)
+	}
+	return &jobConn{store: store}, nil
+}
+
+type jobConn struct {
+	store *jobStore
+}
+
+func (c *jobConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, fmt.Errorf("prepared statements are not supported")
+}
+
+func (c *jobConn) Close() error { return nil }
+
+func (c *jobConn) Begin() (driver.Tx, error) {
+	return nil, fmt.Errorf("transactions are not supported")
+}
+
+func (c *jobConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	s := c.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id := args[0].Value.(int64)
+
+	switch {
+	case strings.Contains(query, "started_at"):
+		if s.statuses[id] != data.BacktestJobQueued {
+			return driver.RowsAffected(0), nil
+		}
+		s.statuses[id] = data.BacktestJobRunning
+	case strings.Contains(query, "SET progress"):
+	case strings.Contains(query, "error = "):
+		s.statuses[id] = args[1].Value.(string)
+		s.errors[id] = args[2].Value.(string)
+		s.finished <- id
+	default:
+		return nil, fmt.Errorf("unexpected statement %q", query)
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (c *jobConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	s := c.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch {
+	case strings.HasPrefix(query, "INSERT INTO backtest_jobs"):
+		id := int64(len(s.params) + 1)
+		s.statuses[id] = args[1].Value.(string)
+		s.params[id] = args[2].Value.(string)
+		return &jobRows{columns: []string{"id", "created_at"}, values: []driver.Value{id, time.Now()}}, nil
+	case strings.HasPrefix(query, "SELECT params"):
+		params, exists := s.params[args[0].Value.(int64)]
+		if !exists {
+			return &jobRows{columns: []string{"params"}}, nil
+		}
+		return &jobRows{columns: []string{"params"}, values: []driver.Value{[]byte(params)}}, nil
+	}
+	return nil, fmt.Errorf("unexpected query %q", query)
+}
+
+// jobRows holds at most one row
+type jobRows struct {
+	columns []string
+	values  []driver.Value
+	read    bool
+}
+
+func (r *jobRows) Columns() []string { return r.columns }
+
+func (r *jobRows) Close() error { return nil }
+
+func (r *jobRows) Next(dest []driver.Value) error {
+	if r.read || r.values == nil {
+		return io.EOF
+	}
+	r.read = true
+	copy(dest, r.values)
+	return nil
+}
+
+type panickingStrategy struct{}
+
+func (panickingStrategy) Name() string { return "panic_test" }
+
+func (panickingStrategy) Init(history map[string][]data.StockData) error { return nil }
+
+func (panickingStrategy) OnDay(day data.MarketDay, portfolio *data.Portfolio) []data.StrategyOrder {
+	panic("strategy bug")
+}
+
+func TestBacktestJobPanicFailsJob(t *testing.T) {
+	t.Setenv("TRADING_DAYS_CSV", "../../weekdays.csv")
+	dir := t.TempDir()
+	t.Setenv("BACKTEST_CSV_DIR", dir)
+	csv := "date,open,high,low,close,volume\n20240102,100,110,90,105,1000\n20240103,105,115,95,110,1200\n"
+	if err := os.WriteFile(filepath.Join(dir, "000001.csv"), []byte(csv), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	db, store := openJobStore(t)
+	jobs := NewBacktestJobService(db, &BacktestService{}, 1)
+	go jobs.worker()
+	t.Cleanup(func() { close(jobs.queue) })
+	job, err := jobs.Submit(1, data.BacktestParams{
+		Strategy: "panic_test",
+		From:     "20240101",
+		To:       "20240131",
+		Source:   "csv",
+		Universe: data.UniverseSpec{Tickers: []string{"000001"}},
+	})
+	if err != nil {
+		t.Fatalf("Submit: %v", err)
+	}
+
+	select {
+	case id := <-store.finished:
+		store.mu.Lock()
+		status, message := store.statuses[id], store.errors[id]
+		store.mu.Unlock()
+		if id != job.ID || status != data.BacktestJobFailed || !strings.Contains(message, "strategy bug") {
+			t.Errorf("job %d finished %s with %q, want job %d FAILED with the panic", id, status, message, job.ID)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the job did not finish; did the worker die with the strategy?")
+	}
+}
+
+func TestBacktestJobSubmitValidatesParams(t *testing.T) {
+	db, store := openJobStore(t)
+	jobs := NewBacktestJobService(db, &BacktestService{}, 1)
+
+	tests := []struct {
+		name   string
+		params data.BacktestParams
+	}{
+		{"future end date", data.BacktestParams{Strategy: "sma_crossover", To: "29990101"}},
+		{"malformed start date", data.BacktestParams{Strategy: "sma_crossover", From: "2024-01-02"}},
+		{"cash below the minimum", data.BacktestParams{Strategy: "sma_crossover", InitialCash: 1}},
+		{"unknown source", data.BacktestParams{Strategy: "sma_crossover", Source: "ftp"}},
+		{"two universe selectors", data.BacktestParams{Strategy: "sma_crossover", Universe: data.UniverseSpec{Tickers: []string{"005930"}, TopN: 5}}},
+	}
+	for _, tt := range tests {
+		if _, err := jobs.Submit(1, tt.params); err == nil {
+			t.Errorf("%s: Submit accepted the params", tt.name)
+		}
+	}
+	if len(store.params) != 0 {
+		t.Errorf("%d jobs were stored, want none", len(store.params))
+	}
+}
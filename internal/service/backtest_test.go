@@ -0,0 +1,47 @@
+package service
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Paaaark/hanquant/internal/data"
+)
+
+func TestFetchHistoricalDataSkipsDelistedStocks(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("BACKTEST_CSV_DIR", dir)
+	csv := "date,open,high,low,close,volume\n20240102,100,110,90,105,1000\n20240103,105,115,95,110,1200\n"
+	if err := os.WriteFile(filepath.Join(dir, "000001.csv"), []byte(csv), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// 000002 traded before the backtest, 000003 has no file at all
+	if err := os.WriteFile(filepath.Join(dir, "000002.csv"), []byte("date,open,high,low,close,volume\n20230102,1,1,1,1,1\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	s := &BacktestService{}
+	universe := []string{"000001", "000002", "000003"}
+	params := data.BacktestParams{From: "20240101", To: "20240131", Source: "csv"}
+	progress := func(float64) {}
+
+	if _, err := s.fetchHistoricalData(context.Background(), universe, params, progress); err == nil {
+		t.Error("a missing file of an explicit universe should fail the run")
+	}
+
+	params.Universe.PointInTime = true
+	stockData, err := s.fetchHistoricalData(context.Background(), universe, params, progress)
+	if err != nil {
+		t.Fatalf("point-in-time universe: %v", err)
+	}
+	if loaded := loadedSymbols(universe, stockData); len(loaded) != 1 || loaded[0] != "000001" {
+		t.Errorf("loaded %v, want only 000001", loaded)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := s.fetchHistoricalData(ctx, universe, params, progress); err != context.Canceled {
+		t.Errorf("cancelled fetch error = %v, want context.Canceled", err)
+	}
+}
@@ -0,0 +1,159 @@
+package service
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/Paaaark/hanquant/internal/data"
+	"github.com/Paaaark/hanquant/internal/metrics"
+)
+
+// indexClose is a parsed daily index value
+type indexClose struct {
+	date  string // YYYY-MM-DD, the format of PortfolioSnapshot.Date
+	value float64
+}
+
+// validateBenchmark checks that the benchmark names a known index
+func validateBenchmark(benchmark string) error {
+	if benchmark == "" {
+		return nil
+	}
+	if _, ok := data.ResolveIndexCode(benchmark); !ok {
+		return fmt.Errorf("unknown benchmark %q: use KOSPI, KOSDAQ, KOSPI200 or KRX100", benchmark)
+	}
+	return nil
+}
+
+// benchmarkSeries is the daily history of a benchmark index, oldest first
+type benchmarkSeries struct {
+	code   string
+	closes []indexClose
+}
+
+// loadBenchmark fetches the benchmark index over the backtest range
+func (s *BacktestService) loadBenchmark(benchmark, from, to string) (*benchmarkSeries, error) {
+	code, ok := data.ResolveIndexCode(benchmark)
+	if !ok {
+		return nil, fmt.Errorf("unknown benchmark %q", benchmark)
+	}
+
+	raw, err := s.stockService.GetIndexHistory(code, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch benchmark %s: %w", benchmark, err)
+	}
+
+	series := &benchmarkSeries{code: code}
+	for _, bar := range raw {
+		date, err := time.Parse("20060102", bar.Date)
+		if err != nil {
+			continue
+		}
+		value, err := strconv.ParseFloat(bar.Close, 64)
+		if err != nil || value <= 0 {
+			continue
+		}
+		series.closes = append(series.closes, indexClose{date: date.Format("2006-01-02"), value: value})
+	}
+	if len(series.closes) == 0 {
+		return nil, fmt.Errorf("no data for benchmark %s between %s and %s", benchmark, from, to)
+	}
+
+	sort.Slice(series.closes, func(i, j int) bool {
+		return series.closes[i].date < series.closes[j].date
+	})
+	return series, nil
+}
+
+// buildBenchmarkComparison aligns the index closes with the portfolio snapshots and derives
+// the relative metrics. Days before the first index value are skipped; later gaps carry
+// the last close forward so both series have the same length.
+func (s *BacktestService) buildBenchmarkComparison(portfolioHistory []data.PortfolioSnapshot, benchmark *benchmarkSeries, riskFreeRate float64) *data.BenchmarkComparison {
+	closes := benchmark.closes
+	comparison := &data.BenchmarkComparison{Code: benchmark.code, Name: data.IndexName(benchmark.code)}
+
+	var dates []string
+	var strategyValues, indexValues []float64
+	next, last := 0, 0.0
+	for _, snapshot := range portfolioHistory {
+		for next < len(closes) && closes[next].date <= snapshot.Date {
+			last = closes[next].value
+			next++
+		}
+		if last == 0 {
+			continue
+		}
+		dates = append(dates, snapshot.Date)
+		strategyValues = append(strategyValues, snapshot.Portfolio.Total)
+		indexValues = append(indexValues, last)
+	}
+
+	if len(dates) == 0 || strategyValues[0] <= 0 {
+		return comparison
+	}
+
+	comparison.Curve = make([]data.BenchmarkPoint, len(dates))
+	for i := range dates {
+		strategyReturn := (strategyValues[i]/strategyValues[0] - 1) * 100
+		benchmarkReturn := (indexValues[i]/indexValues[0] - 1) * 100
+		comparison.Curve[i] = data.BenchmarkPoint{
+			Date:            dates[i],
+			IndexValue:      indexValues[i],
+			StrategyReturn:  strategyReturn,
+			BenchmarkReturn: benchmarkReturn,
+			ExcessReturn:    strategyReturn - benchmarkReturn,
+		}
+	}
+	final := comparison.Curve[len(dates)-1]
+	comparison.BenchmarkReturn = final.BenchmarkReturn
+	comparison.ExcessReturn = final.ExcessReturn
+
+	// Daily returns of both series and their difference
+	var strategyReturns, benchmarkReturns, excessReturns []float64
+	for i := 1; i < len(dates); i++ {
+		if strategyValues[i-1] <= 0 {
+			continue
+		}
+		rs := strategyValues[i]/strategyValues[i-1] - 1
+		rb := indexValues[i]/indexValues[i-1] - 1
+		strategyReturns = append(strategyReturns, rs)
+		benchmarkReturns = append(benchmarkReturns, rb)
+		excessReturns = append(excessReturns, rs-rb)
+	}
+	if len(strategyReturns) < 2 {
+		return comparison
+	}
+
+	meanStrategy := metrics.Mean(strategyReturns)
+	meanBenchmark := metrics.Mean(benchmarkReturns)
+	stdStrategy := metrics.StdDev(strategyReturns, meanStrategy)
+	stdBenchmark := metrics.StdDev(benchmarkReturns, meanBenchmark)
+
+	covariance := 0.0
+	for i := range strategyReturns {
+		covariance += (strategyReturns[i] - meanStrategy) * (benchmarkReturns[i] - meanBenchmark)
+	}
+	covariance /= float64(len(strategyReturns))
+
+	if stdBenchmark > 0 {
+		comparison.Beta = covariance / (stdBenchmark * stdBenchmark)
+	}
+	if stdStrategy > 0 && stdBenchmark > 0 {
+		comparison.Correlation = covariance / (stdStrategy * stdBenchmark)
+	}
+	// Jensen's alpha: the part of the excess return over the risk-free rate not explained by beta
+	riskFree := metrics.DailyRiskFree(riskFreeRate)
+	comparison.Alpha = ((meanStrategy - riskFree) - comparison.Beta*(meanBenchmark-riskFree)) * metrics.TradingDaysPerYear * 100
+
+	meanExcess := metrics.Mean(excessReturns)
+	stdExcess := metrics.StdDev(excessReturns, meanExcess)
+	comparison.TrackingError = stdExcess * math.Sqrt(metrics.TradingDaysPerYear) * 100
+	if stdExcess > 0 {
+		comparison.InformationRatio = meanExcess / stdExcess * math.Sqrt(metrics.TradingDaysPerYear)
+	}
+
+	return comparison
+}
@@ -0,0 +1,407 @@
+package service
+
+import (
+	"fmt"
+
+	"github.com/Paaaark/hanquant/internal/data"
+)
+
+// defaultMaxVolumeShare caps each order at 10% of a bar's volume
+const defaultMaxVolumeShare = 0.1
+
+// applyExecutionDefaults fills in the execution settings that were not set explicitly
+func applyExecutionDefaults(model *data.ExecutionModel) {
+	if model.MaxVolumeShare == nil {
+		v := defaultMaxVolumeShare
+		model.MaxVolumeShare = &v
+	}
+}
+
+// validateExecution rejects out-of-range execution settings
+func validateExecution(model data.ExecutionModel) error {
+	if model.MaxVolumeShare != nil && (*model.MaxVolumeShare < 0 || *model.MaxVolumeShare > 1) {
+		return fmt.Errorf("max_volume_share must be between 0 and 1")
+	}
+	return nil
+}
+
+// workingOrder is an order the broker has accepted but not finished
+type workingOrder struct {
+	record    int    // index into broker.records
+	remaining int    // shares left to fill; 0 on a SELL means close whatever is held
+	triggered bool   // a stop_limit whose stop has been hit and now works as a limit
+	session   string // YYYYMMDD of the first session the order worked in, for day orders
+	done      bool   // filled, rejected or expired
+}
+
+// broker simulates order execution. Orders submitted on one bar are only eligible from the
+// next bar on, so strategies cannot trade on the prices that produced their signals.
+type broker struct {
+	sizer      *positionSizer
+	costs      *costCalculator
+	settlement *settlementLedger
+	maxShare   float64
+
+	working   []*workingOrder
+	records   []data.OrderRecord
+	lastClose map[string]float64 // latest close of each symbol
+	baseClose map[string]float64 // previous session's close, the base of the daily price limit
+	session   string             // YYYYMMDD of the current session
+	intraday  bool
+}
+
+func newBroker(prepared *preparedBacktest) *broker {
+	return &broker{
+		sizer:      prepared.sizer,
+		costs:      prepared.costs,
+		settlement: newSettlementLedger(prepared.params.Settlement),
+		maxShare:   *prepared.params.Execution.MaxVolumeShare,
+		lastClose:  make(map[string]float64),
+		baseClose:  make(map[string]float64),
+		intraday:   prepared.params.Interval > 0,
+	}
+}
+
+// startStep rolls the price limit base and settles the trades due at the first step of each
+// session
+func (b *broker) startStep(day data.MarketDay, portfolio *data.Portfolio) {
+	session := day.Date.Format("20060102")
+	if session != b.session {
+		b.session = session
+		b.settlement.startSession(session, portfolio)
+		for symbol, close := range b.lastClose {
+			b.baseClose[symbol] = close
+		}
+	}
+}
+
+// endStep remembers the closes of the step
+func (b *broker) endStep(day data.MarketDay) {
+	for _, bar := range day.Bars {
+		b.lastClose[bar.Symbol] = bar.Close
+	}
+}
+
+// submit validates and sizes a strategy order against the bar that produced it. The order
+// works from the next bar on.
+func (b *broker) submit(order data.StrategyOrder, day data.MarketDay, portfolio *data.Portfolio) {
+	if order.Type == "" {
+		order.Type = "market"
+	}
+	if order.TimeInForce == "" {
+		order.TimeInForce = "day"
+	}
+	record := data.OrderRecord{
+		ID:            len(b.records) + 1,
+		SubmittedDate: day.Date.Format("2006-01-02"),
+		StrategyOrder: order,
+		Status:        data.OrderOpen,
+	}
+	if b.intraday {
+		record.SubmittedTime = day.Date.Format("15:04")
+	}
+
+	if reason := b.resolve(&record.StrategyOrder, day, portfolio); reason != "" {
+		record.Status = data.OrderRejected
+		record.Reason = reason
+		b.records = append(b.records, record)
+		return
+	}
+
+	b.records = append(b.records, record)
+	b.working = append(b.working, &workingOrder{record: len(b.records) - 1, remaining: record.Quantity})
+}
+
+// resolve checks order and sizes BUYs with the sizing rule, returning a rejection reason if any
+func (b *broker) resolve(order *data.StrategyOrder, day data.MarketDay, portfolio *data.Portfolio) string {
+	if order.Side != "BUY" && order.Side != "SELL" {
+		return fmt.Sprintf("unknown side %q", order.Side)
+	}
+	if order.TimeInForce != "day" && order.TimeInForce != "gtc" {
+		return fmt.Sprintf("unknown time in force %q", order.TimeInForce)
+	}
+	if order.Quantity < 0 {
+		return "quantity must not be negative"
+	}
+	market := b.costs.markets[order.Symbol]
+	bar, exists := day.Bar(order.Symbol)
+
+	switch order.Type {
+	case "market":
+	case "limit", "stop", "stop_limit":
+		if order.Type != "stop" && order.LimitPrice <= 0 {
+			return order.Type + " order needs a positive limit_price"
+		}
+		if order.Type != "limit" && order.StopPrice <= 0 {
+			return order.Type + " order needs a positive stop_price"
+		}
+		// Order prices must sit on a tick; round limits to the passive side and stops away from the market
+		if exists {
+			if order.LimitPrice > 0 {
+				order.LimitPrice = roundToTick(order.LimitPrice, order.Side == "SELL", market, bar.Date)
+			}
+			if order.StopPrice > 0 {
+				order.StopPrice = roundToTick(order.StopPrice, order.Side == "BUY", market, bar.Date)
+			}
+		}
+	default:
+		return fmt.Sprintf("unknown order type %q", order.Type)
+	}
+
+	if order.Side == "SELL" || order.Quantity > 0 {
+		return ""
+	}
+
+	// Size BUYs on the signal bar, the last price the strategy has seen
+	if !exists || bar.Close <= 0 {
+		return "no price to size the order"
+	}
+	if b.settlement.buyingPower(portfolio) <= 0 {
+		return "insufficient cash"
+	}
+	positionValue := b.sizer.positionValue(portfolio, order.Symbol, day)
+	order.Quantity = int(positionValue / b.costs.estimateBuyPrice(bar))
+	if order.Quantity <= 0 {
+		return "position size is less than one share"
+	}
+	return ""
+}
+
+// process tries to fill every working order against this step's bars, in submission order
+func (b *broker) process(day data.MarketDay, portfolio *data.Portfolio) []data.Trade {
+	var trades []data.Trade
+	working := b.working[:0]
+	for _, order := range b.working {
+		if order.session == "" {
+			order.session = b.session
+		}
+		if bar, exists := day.Bar(b.records[order.record].Symbol); exists {
+			if trade := b.fill(order, bar, portfolio); trade != nil {
+				trades = append(trades, *trade)
+			}
+		}
+		if !order.done {
+			working = append(working, order)
+		}
+	}
+	b.working = working
+	return trades
+}
+
+// fill executes as much of order as bar allows
+func (b *broker) fill(order *workingOrder, bar data.StockData, portfolio *data.Portfolio) *data.Trade {
+	record := &b.records[order.record]
+	price, slip, ok := b.executionPrice(order, record.StrategyOrder, bar)
+	if !ok {
+		return nil
+	}
+	return b.execute(order, price, slip, bar, portfolio, true)
+}
+
+// executionPrice decides whether order executes on bar and at which reference price,
+// assuming the bar opens at Open and visits High and Low before it closes
+func (b *broker) executionPrice(order *workingOrder, o data.StrategyOrder, bar data.StockData) (float64, bool, bool) {
+	buy := o.Side == "BUY"
+	switch o.Type {
+	case "market":
+		return bar.Open, true, bar.Open > 0
+	case "limit":
+		price, ok := limitPrice(buy, o.LimitPrice, bar)
+		return price, false, ok
+	case "stop":
+		price, ok := stopPrice(buy, o.StopPrice, bar)
+		return price, true, ok
+	default: // stop_limit
+		if order.triggered {
+			price, ok := limitPrice(buy, o.LimitPrice, bar)
+			return price, false, ok
+		}
+		trigger, ok := stopPrice(buy, o.StopPrice, bar)
+		if !ok {
+			return 0, false, false
+		}
+		order.triggered = true
+		// Within the triggering bar only the trigger price itself is known to be reachable
+		if (buy && trigger <= o.LimitPrice) || (!buy && trigger >= o.LimitPrice) {
+			return trigger, false, true
+		}
+		return 0, false, false
+	}
+}
+
+// limitPrice fills a limit at the open if the bar opens through it, else at the limit if the bar reaches it
+func limitPrice(buy bool, limit float64, bar data.StockData) (float64, bool) {
+	if buy {
+		if bar.Open <= limit {
+			return bar.Open, bar.Open > 0
+		}
+		return limit, bar.Low <= limit
+	}
+	if bar.Open >= limit {
+		return bar.Open, bar.Open > 0
+	}
+	return limit, bar.High >= limit
+}
+
+// stopPrice triggers a stop at the open if the bar gaps through it, else at the stop if the bar reaches it
+func stopPrice(buy bool, stop float64, bar data.StockData) (float64, bool) {
+	if buy {
+		if bar.Open >= stop {
+			return bar.Open, bar.Open > 0
+		}
+		return stop, bar.High >= stop
+	}
+	if bar.Open <= stop {
+		return bar.Open, bar.Open > 0
+	}
+	return stop, bar.Low <= stop
+}
+
+// execute fills order at price, capped by the bar's volume (when capVolume), the daily price
+// limit, available cash for BUYs and the held position for SELLs
+func (b *broker) execute(order *workingOrder, price float64, slip bool, bar data.StockData, portfolio *data.Portfolio, capVolume bool) *data.Trade {
+	record := &b.records[order.record]
+	symbol := record.Symbol
+
+	quantity := order.remaining
+	if record.Side == "SELL" {
+		held := portfolio.Positions[symbol]
+		if held <= 0 {
+			b.finish(order, "no position to sell")
+			return nil
+		}
+		if quantity == 0 || quantity > held {
+			quantity = held
+		}
+	}
+	if capVolume && b.maxShare > 0 {
+		quantity = min(quantity, int(float64(bar.Volume)*b.maxShare))
+		if quantity <= 0 {
+			record.Reason = "no volume available on the bar"
+			return nil
+		}
+	}
+
+	fill := b.costs.costs(record.Side, quantity, price, slip, bar)
+	if base, known := b.baseClose[symbol]; known {
+		lower, upper := priceLimits(base, b.costs.markets[symbol], bar.Date)
+		if fill.fillPrice < lower || fill.fillPrice > upper {
+			record.Reason = "fill price beyond the daily price limit"
+			return nil
+		}
+	}
+
+	if record.Side == "BUY" {
+		// Shrink to what the buying power covers; volume_share slippage changes with size, so re-price
+		power := b.settlement.buyingPower(portfolio)
+		for quantity > 0 && float64(quantity)*fill.fillPrice+fill.commission > power {
+			affordable := int(power / (fill.fillPrice * (1 + *b.costs.model.CommissionBps/10000)))
+			quantity = min(quantity-1, affordable)
+			if quantity > 0 {
+				fill = b.costs.costs(record.Side, quantity, price, slip, bar)
+			}
+		}
+		if quantity <= 0 {
+			b.finish(order, "insufficient cash")
+			return nil
+		}
+	}
+
+	value := float64(quantity) * fill.fillPrice
+	trade := &data.Trade{
+		Date:       bar.Date.Format("2006-01-02"),
+		Symbol:     symbol,
+		Side:       record.Side,
+		Quantity:   quantity,
+		Price:      fill.fillPrice,
+		Value:      value,
+		Portfolio:  portfolio.Total,
+		Commission: fill.commission,
+		Tax:        fill.tax,
+		Slippage:   fill.slippage,
+	}
+	if b.intraday {
+		trade.Time = bar.Date.Format("15:04")
+	}
+
+	if record.Side == "BUY" {
+		portfolio.Cash -= value + fill.commission
+		portfolio.Positions[symbol] += quantity
+		b.settlement.record(bar.Date.Format("20060102"), -(value + fill.commission), portfolio)
+	} else {
+		portfolio.Cash += value - fill.commission - fill.tax
+		b.settlement.record(bar.Date.Format("20060102"), value-fill.commission-fill.tax, portfolio)
+		portfolio.Positions[symbol] -= quantity
+		if portfolio.Positions[symbol] == 0 {
+			delete(portfolio.Values, symbol)
+		} else {
+			portfolio.Values[symbol] = float64(portfolio.Positions[symbol]) * bar.Close
+		}
+	}
+
+	// Update the running average fill price and what is left
+	record.AvgFillPrice = (record.AvgFillPrice*float64(record.FilledQuantity) + value) / float64(record.FilledQuantity+quantity)
+	record.FilledQuantity += quantity
+	record.Reason = ""
+	if order.remaining > 0 {
+		order.remaining -= quantity
+		order.done = order.remaining == 0
+	} else {
+		// A close-the-position order is done once nothing is held
+		order.done = portfolio.Positions[symbol] == 0
+	}
+	record.Status = data.OrderPartiallyFilled
+	if order.done {
+		record.Status = data.OrderFilled
+	}
+	return trade
+}
+
+// finish ends an order that can no longer fill
+func (b *broker) finish(order *workingOrder, reason string) {
+	record := &b.records[order.record]
+	record.Reason = reason
+	if record.FilledQuantity == 0 {
+		record.Status = data.OrderRejected
+	}
+	order.done = true
+}
+
+// endSession expires day orders whose session has ended
+func (b *broker) endSession() {
+	working := b.working[:0]
+	for _, order := range b.working {
+		record := &b.records[order.record]
+		if record.TimeInForce == "day" && order.session == b.session {
+			if record.FilledQuantity == 0 {
+				record.Status = data.OrderExpired
+			}
+			order.done = true
+			continue
+		}
+		working = append(working, order)
+	}
+	b.working = working
+}
+
+// closePosition sells all of symbol at the session's last close, like a market-on-close order.
+// It is not capped by volume so the portfolio is always flat afterwards.
+func (b *broker) closePosition(bar data.StockData, day data.MarketDay, portfolio *data.Portfolio) *data.Trade {
+	record := data.OrderRecord{
+		ID:            len(b.records) + 1,
+		SubmittedDate: day.Date.Format("2006-01-02"),
+		StrategyOrder: data.StrategyOrder{Symbol: bar.Symbol, Side: "SELL", Type: "market", TimeInForce: "day"},
+		Status:        data.OrderOpen,
+	}
+	if b.intraday {
+		record.SubmittedTime = day.Date.Format("15:04")
+	}
+	b.records = append(b.records, record)
+	order := &workingOrder{record: len(b.records) - 1}
+	return b.execute(order, bar.Close, true, bar, portfolio, false)
+}
+
+// orders returns the order log; orders still working are left OPEN or PARTIALLY_FILLED
+func (b *broker) orders() []data.OrderRecord {
+	return b.records
+}
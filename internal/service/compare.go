@@ -0,0 +1,184 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/Paaaark/hanquant/internal/data"
+	"github.com/Paaaark/hanquant/internal/metrics"
+)
+
+const maxCompareStrategies = 10
+
+// Compare runs every strategy of params over history that is loaded once and lines their equity
+// curves up by date, with a correlation matrix of their daily returns
+func (s *BacktestService) Compare(params data.CompareParams) (*data.CompareResult, error) {
+	if len(params.Strategies) < 2 {
+		return nil, fmt.Errorf("compare needs at least 2 strategies")
+	}
+	if len(params.Strategies) > maxCompareStrategies {
+		return nil, fmt.Errorf("compare runs at most %d strategies", maxCompareStrategies)
+	}
+
+	strategies := make([]Strategy, len(params.Strategies))
+	runs := make([]data.CompareRun, len(params.Strategies))
+	labels := make(map[string]bool, len(params.Strategies))
+	for i, config := range params.Strategies {
+		strategy, resolved, err := newRunStrategy(config.Strategy, config.StrategyParams, config.Rules)
+		if err != nil {
+			return nil, fmt.Errorf("strategy %d: %w", i+1, err)
+		}
+		strategies[i] = strategy
+		runs[i] = data.CompareRun{Label: config.Label, Strategy: strategy.Name(), StrategyParams: resolved}
+		if runs[i].Label == "" {
+			runs[i].Label = strategyLabel(strategy.Name(), resolved)
+		}
+		if labels[runs[i].Label] {
+			return nil, fmt.Errorf("strategy label %q is used twice, give the runs their own label", runs[i].Label)
+		}
+		labels[runs[i].Label] = true
+
+		// Target-weight strategies need a rebalance schedule on the shared trading days
+		if strategyRegistry[config.Strategy].info.Rebalances && params.Rebalance.Frequency == "" {
+			params.Rebalance.Frequency = "monthly"
+		}
+	}
+	params.Strategy = ""
+	params.StrategyParams = nil
+
+	prepared, err := s.prepareBacktest(context.Background(), params.BacktestParams, nil)
+	if err != nil {
+		return nil, err
+	}
+	params.BacktestParams = prepared.params
+
+	histories := make([][]data.PortfolioSnapshot, len(runs))
+	var wg sync.WaitGroup
+	for i := range runs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			runParams := prepared.params
+			runParams.Strategy = runs[i].Strategy
+			runParams.StrategyParams = runs[i].StrategyParams
+			runParams.Rules = params.Strategies[i].Rules
+			result, err := s.simulate(prepared, runParams, strategies[i])
+			if err != nil {
+				runs[i].Error = err.Error()
+				return
+			}
+			histories[i] = result.PortfolioHistory
+			runs[i].Metrics = result.Metrics
+			runs[i].Metrics.Risk.MonthlyReturns = nil
+			runs[i].Metrics.Risk.YearlyReturns = nil
+		}(i)
+	}
+	wg.Wait()
+
+	dates := compareDates(histories)
+	for i := range runs {
+		if runs[i].Error == "" {
+			runs[i].Equity = alignEquity(histories[i], dates)
+		}
+	}
+
+	return &data.CompareResult{
+		Params:      params,
+		Universe:    prepared.universe,
+		Dates:       dates,
+		Runs:        runs,
+		Correlation: returnCorrelations(runs),
+	}, nil
+}
+
+// strategyLabel names a run by its strategy and resolved parameters, e.g. "sma_crossover(sma_long=50,sma_short=20)"
+func strategyLabel(name string, params map[string]float64) string {
+	if len(params) == 0 {
+		return name
+	}
+	names := make([]string, 0, len(params))
+	for param := range params {
+		names = append(names, param)
+	}
+	sort.Strings(names)
+	parts := make([]string, len(names))
+	for i, param := range names {
+		parts[i] = param + "=" + strconv.FormatFloat(params[param], 'f', -1, 64)
+	}
+	return name + "(" + strings.Join(parts, ",") + ")"
+}
+
+// compareDates is the sorted union of the snapshot dates of every run. Runs share the trading
+// days, so this is normally just the dates of any one of them.
+func compareDates(histories [][]data.PortfolioSnapshot) []string {
+	seen := make(map[string]bool)
+	var dates []string
+	for _, history := range histories {
+		for _, snapshot := range history {
+			if !seen[snapshot.Date] {
+				seen[snapshot.Date] = true
+				dates = append(dates, snapshot.Date)
+			}
+		}
+	}
+	sort.Strings(dates)
+	return dates
+}
+
+// alignEquity returns the portfolio total of history on each date, carrying the last known
+// total forward over dates the run has no snapshot for
+func alignEquity(history []data.PortfolioSnapshot, dates []string) []float64 {
+	totals := make(map[string]float64, len(history))
+	for _, snapshot := range history {
+		totals[snapshot.Date] = snapshot.Portfolio.Total
+	}
+	equity := make([]float64, len(dates))
+	last := 0.0
+	if len(history) > 0 {
+		last = history[0].Portfolio.Total
+	}
+	for i, date := range dates {
+		if total, exists := totals[date]; exists {
+			last = total
+		}
+		equity[i] = last
+	}
+	return equity
+}
+
+// returnCorrelations is the Pearson correlation matrix of the runs' daily returns
+func returnCorrelations(runs []data.CompareRun) [][]*float64 {
+	returns := make([][]float64, len(runs))
+	for i, run := range runs {
+		if run.Error != "" || len(run.Equity) < 3 {
+			continue
+		}
+		curve := make([]metrics.Point, len(run.Equity))
+		for j, value := range run.Equity {
+			curve[j] = metrics.Point{Value: value}
+		}
+		returns[i] = metrics.Returns(curve)
+	}
+
+	matrix := make([][]*float64, len(runs))
+	for i := range matrix {
+		matrix[i] = make([]*float64, len(runs))
+		for j := range matrix[i] {
+			if returns[i] == nil || returns[j] == nil || len(returns[i]) != len(returns[j]) {
+				continue
+			}
+			denominator := math.Sqrt(covariance(returns[i], returns[i]) * covariance(returns[j], returns[j]))
+			if denominator == 0 {
+				continue
+			}
+			correlation := covariance(returns[i], returns[j]) / denominator
+			matrix[i][j] = &correlation
+		}
+	}
+	return matrix
+}
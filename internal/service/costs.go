@@ -0,0 +1,193 @@
+package service
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/Paaaark/hanquant/internal/data"
+)
+
+const (
+	defaultCommissionBps = 1.5  // 0.015% per side, typical online brokerage rate
+	defaultSlippageBps   = 5.0  // fixed_bps default
+	defaultImpactBps     = 10.0 // volume_share default: 10 bps per 1% of daily volume
+)
+
+// sellTaxSchedule lists the combined securities transaction tax (증권거래세 + 농어촌특별세 on KOSPI)
+// charged on sells, in basis points, by the date it took effect.
+var sellTaxSchedule = []struct {
+	effective string // YYYYMMDD
+	kospiBps  float64
+	kosdaqBps float64
+}{
+	{"00000000", 30, 30},
+	{"20190530", 25, 25},
+	{"20210101", 23, 23},
+	{"20230101", 20, 20},
+	{"20240101", 18, 18},
+	{"20250101", 15, 15},
+	{"20260101", 20, 20},
+}
+
+// applyCostDefaults fills in the default rates that were not set explicitly
+func applyCostDefaults(model *data.CostModel) {
+	if model.CommissionBps == nil {
+		v := defaultCommissionBps
+		model.CommissionBps = &v
+	}
+	if model.Slippage == "" {
+		model.Slippage = "fixed_bps"
+	}
+	switch model.Slippage {
+	case "fixed_bps":
+		if model.SlippageBps == nil {
+			v := defaultSlippageBps
+			model.SlippageBps = &v
+		}
+	case "volume_share":
+		if model.ImpactBps == nil {
+			v := defaultImpactBps
+			model.ImpactBps = &v
+		}
+	}
+}
+
+// validateCosts rejects negative rates and unknown slippage models
+func validateCosts(model data.CostModel) error {
+	for name, rate := range map[string]*float64{
+		"commission_bps": model.CommissionBps,
+		"kospi_tax_bps":  model.KOSPITaxBps,
+		"kosdaq_tax_bps": model.KOSDAQTaxBps,
+		"slippage_bps":   model.SlippageBps,
+		"impact_bps":     model.ImpactBps,
+	} {
+		if rate != nil && (*rate < 0 || *rate > 1000) {
+			return fmt.Errorf("%s must be between 0 and 1000", name)
+		}
+	}
+	if model.Slippage != "fixed_bps" && model.Slippage != "volume_share" {
+		return fmt.Errorf("unknown slippage model: %q", model.Slippage)
+	}
+	return nil
+}
+
+// tradeCosts is the breakdown of frictions for a single fill
+type tradeCosts struct {
+	fillPrice  float64
+	commission float64
+	tax        float64
+	slippage   float64
+}
+
+// costCalculator prices commission, tax and slippage for fills in a backtest
+type costCalculator struct {
+	model   data.CostModel
+	markets map[string]string // symbol -> "1" (KOSPI) or "2" (KOSDAQ)
+}
+
+func newCostCalculator(model data.CostModel, universe []string) *costCalculator {
+	calc := &costCalculator{
+		model:   model,
+		markets: make(map[string]string, len(universe)),
+	}
+
+	// Without listings every symbol is taxed at the KOSPI rate
+	rows, err := loadListings()
+	if err != nil {
+		return calc
+	}
+	inUniverse := make(map[string]bool, len(universe))
+	for _, symbol := range universe {
+		inUniverse[symbol] = true
+	}
+	for _, row := range rows {
+		if inUniverse[row.Code] {
+			calc.markets[row.Code] = row.Market
+		}
+	}
+
+	// Delisted stocks are only in the listing history
+	if len(calc.markets) < len(inUniverse) {
+		if history, err := loadListingHistory(); err == nil {
+			for _, record := range history {
+				if _, known := calc.markets[record.Code]; inUniverse[record.Code] && !known {
+					calc.markets[record.Code] = record.Market
+				}
+			}
+		}
+	}
+	return calc
+}
+
+// slippageRate returns the fraction of price conceded when filling quantity against bar
+func (c *costCalculator) slippageRate(quantity int, bar data.StockData) float64 {
+	switch c.model.Slippage {
+	case "volume_share":
+		if bar.Volume <= 0 {
+			return 0
+		}
+		participation := float64(quantity) / float64(bar.Volume) * 100 // in percent of the bar volume
+		return *c.model.ImpactBps * participation / 10000
+	default:
+		return *c.model.SlippageBps / 10000
+	}
+}
+
+// estimateBuyPrice returns the per-share cash needed to buy one share, used for sizing
+func (c *costCalculator) estimateBuyPrice(bar data.StockData) float64 {
+	price := bar.Close
+	if c.model.Slippage == "fixed_bps" {
+		price *= 1 + *c.model.SlippageBps/10000
+	}
+	return price * (1 + *c.model.CommissionBps/10000)
+}
+
+// costs prices a fill of quantity shares on the given side. price is the reference price the
+// order executes against; marketable fills (slip) concede slippage from it and are rounded to
+// the tick against the trader, while limit fills execute exactly at price.
+func (c *costCalculator) costs(side string, quantity int, price float64, slip bool, bar data.StockData) tradeCosts {
+	fillPrice := price
+	if slip {
+		rate := c.slippageRate(quantity, bar)
+		if side == "SELL" {
+			fillPrice = roundToTick(price*(1-rate), false, c.markets[bar.Symbol], bar.Date)
+		} else {
+			fillPrice = roundToTick(price*(1+rate), true, c.markets[bar.Symbol], bar.Date)
+		}
+	}
+	value := float64(quantity) * fillPrice
+
+	result := tradeCosts{
+		fillPrice:  fillPrice,
+		commission: value * *c.model.CommissionBps / 10000,
+		slippage:   float64(quantity) * math.Abs(fillPrice-price),
+	}
+	if side == "SELL" {
+		result.tax = value * c.sellTaxBps(bar.Symbol, bar.Date) / 10000
+	}
+	return result
+}
+
+// sellTaxBps returns the transaction tax rate for selling symbol on date
+func (c *costCalculator) sellTaxBps(symbol string, date time.Time) float64 {
+	kosdaq := c.markets[symbol] == "2"
+	if kosdaq && c.model.KOSDAQTaxBps != nil {
+		return *c.model.KOSDAQTaxBps
+	}
+	if !kosdaq && c.model.KOSPITaxBps != nil {
+		return *c.model.KOSPITaxBps
+	}
+
+	day := date.Format("20060102")
+	rate := sellTaxSchedule[0]
+	for _, entry := range sellTaxSchedule {
+		if entry.effective <= day {
+			rate = entry
+		}
+	}
+	if kosdaq {
+		return rate.kosdaqBps
+	}
+	return rate.kospiBps
+}
@@ -0,0 +1,112 @@
+package service
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/Paaaark/hanquant/internal/data"
+)
+
+func date(day string) time.Time {
+	parsed, err := time.Parse("20060102", day)
+	if err != nil {
+		panic(err)
+	}
+	return parsed
+}
+
+func testCostCalculator(model data.CostModel) *costCalculator {
+	applyCostDefaults(&model)
+	return &costCalculator{model: model, markets: map[string]string{"005930": "1", "247540": "2"}}
+}
+
+func TestSellTaxSchedule(t *testing.T) {
+	calc := testCostCalculator(data.CostModel{})
+	tests := []struct {
+		day  string
+		want float64
+	}{
+		{"20190529", 30},
+		{"20190530", 25},
+		{"20201231", 25},
+		{"20210101", 23},
+		{"20221230", 23},
+		{"20230102", 20},
+		{"20240102", 18},
+		{"20250102", 15},
+		{"20251230", 15},
+		{"20260102", 20},
+	}
+	for _, tt := range tests {
+		for _, symbol := range []string{"005930", "247540"} {
+			if got := calc.sellTaxBps(symbol, date(tt.day)); got != tt.want {
+				t.Errorf("sellTaxBps(%s, %s) = %v, want %v", symbol, tt.day, got, tt.want)
+			}
+		}
+	}
+}
+
+func TestSellTaxOverrides(t *testing.T) {
+	kospi := 10.0
+	calc := testCostCalculator(data.CostModel{KOSPITaxBps: &kospi})
+
+	if got := calc.sellTaxBps("005930", date("20240102")); got != 10 {
+		t.Errorf("KOSPI override: got %v, want 10", got)
+	}
+	// Symbols without a listing are taxed as KOSPI
+	if got := calc.sellTaxBps("999999", date("20240102")); got != 10 {
+		t.Errorf("unlisted symbol: got %v, want 10", got)
+	}
+	if got := calc.sellTaxBps("247540", date("20240102")); got != 18 {
+		t.Errorf("KOSDAQ without an override: got %v, want the scheduled 18", got)
+	}
+}
+
+func TestCosts(t *testing.T) {
+	calc := testCostCalculator(data.CostModel{})
+	bar := data.StockData{Symbol: "005930", Date: date("20240102"), Close: 10000, Volume: 1000000}
+
+	tests := []struct {
+		side  string
+		slip  bool
+		price float64
+		want  tradeCosts
+	}{
+		// 5 bps of slippage moves the fill off the 10 won tick, so it rounds against the trader
+		{"BUY", true, 10000, tradeCosts{fillPrice: 10010, commission: 15.015, slippage: 100}},
+		{"SELL", true, 10000, tradeCosts{fillPrice: 9990, commission: 14.985, tax: 179.82, slippage: 100}},
+		// Limit fills execute at their price
+		{"SELL", false, 10000, tradeCosts{fillPrice: 10000, commission: 15, tax: 180}},
+	}
+	for _, tt := range tests {
+		got := calc.costs(tt.side, 10, tt.price, tt.slip, bar)
+		if got.fillPrice != tt.want.fillPrice ||
+			math.Abs(got.commission-tt.want.commission) > 1e-9 ||
+			math.Abs(got.tax-tt.want.tax) > 1e-9 ||
+			math.Abs(got.slippage-tt.want.slippage) > 1e-9 {
+			t.Errorf("costs(%s, slip %v) = %+v, want %+v", tt.side, tt.slip, got, tt.want)
+		}
+	}
+}
+
+func TestValidateCosts(t *testing.T) {
+	negative := -1.0
+	tests := []struct {
+		name    string
+		model   data.CostModel
+		wantErr bool
+	}{
+		{"defaults", data.CostModel{}, false},
+		{"volume share", data.CostModel{Slippage: "volume_share"}, false},
+		{"negative commission", data.CostModel{CommissionBps: &negative}, true},
+		{"unknown slippage", data.CostModel{Slippage: "random"}, true},
+	}
+	for _, tt := range tests {
+		model := tt.model
+		applyCostDefaults(&model)
+		if err := validateCosts(model); (err != nil) != tt.wantErr {
+			t.Errorf("%s: validateCosts error = %v, want error %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package service
+
+import (
+	"fmt"
+	"maps"
+	"math"
+
+	"github.com/Paaaark/hanquant/internal/data"
+)
+
+// applySnapshotDefaults keeps position snapshots only on days the holdings change
+func applySnapshotDefaults(params *data.BacktestParams) {
+	if params.Snapshots == "" {
+		params.Snapshots = "changes"
+	}
+}
+
+// validateSnapshots checks the snapshot mode after defaults have been applied
+func validateSnapshots(mode string) error {
+	switch mode {
+	case "changes", "all", "none":
+		return nil
+	}
+	return fmt.Errorf("unknown snapshots mode %q", mode)
+}
+
+// snapshotPortfolio copies portfolio so later fills do not rewrite the recorded day.
+// Symbols that are no longer held are left out.
+func snapshotPortfolio(portfolio *data.Portfolio) data.Portfolio {
+	snapshot := data.Portfolio{
+		Cash:      portfolio.Cash,
+		Settled:   portfolio.Settled,
+		Positions: make(map[string]int, len(portfolio.Positions)),
+		Values:    make(map[string]float64, len(portfolio.Values)),
+		Total:     portfolio.Total,
+	}
+	for symbol, quantity := range portfolio.Positions {
+		if quantity == 0 {
+			continue
+		}
+		snapshot.Positions[symbol] = quantity
+		snapshot.Values[symbol] = portfolio.Values[symbol]
+	}
+	return snapshot
+}
+
+// buildEquityCurve lays the daily snapshots out in columns
+func buildEquityCurve(history []data.PortfolioSnapshot) data.EquityCurve {
+	curve := data.EquityCurve{
+		Dates:    make([]string, len(history)),
+		Total:    make([]float64, len(history)),
+		Cash:     make([]float64, len(history)),
+		Invested: make([]float64, len(history)),
+		Drawdown: make([]float64, len(history)),
+	}
+	peak := 0.0
+	for i, snapshot := range history {
+		total := snapshot.Portfolio.Total
+		curve.Dates[i] = snapshot.Date
+		curve.Total[i] = total
+		curve.Cash[i] = snapshot.Portfolio.Cash
+		curve.Invested[i] = total - snapshot.Portfolio.Cash
+		peak = math.Max(peak, total)
+		if peak > 0 {
+			curve.Drawdown[i] = (1 - total/peak) * 100
+		}
+	}
+	return curve
+}
+
+// compactHistory keeps the snapshots mode asks for: every day, none, or the first day and
+// every day whose positions differ from the day before
+func compactHistory(history []data.PortfolioSnapshot, mode string) []data.PortfolioSnapshot {
+	switch mode {
+	case "all":
+		return history
+	case "none":
+		return nil
+	}
+	var kept []data.PortfolioSnapshot
+	for i, snapshot := range history {
+		if i == 0 || !maps.Equal(snapshot.Portfolio.Positions, history[i-1].Portfolio.Positions) {
+			kept = append(kept, snapshot)
+		}
+	}
+	return kept
+}
+
+// compactResult replaces the daily history of a finished run with the equity curve and the
+// snapshots its params ask for. Metrics, benchmark and anything else that needs the whole
+// history must be computed before.
+func compactResult(result *data.BacktestResult) {
+	result.EquityCurve = buildEquityCurve(result.PortfolioHistory)
+	result.PortfolioHistory = compactHistory(result.PortfolioHistory, result.Params.Snapshots)
+}
+
+// compactJob does the same for a stored job, whose snapshots carry positions only
+func compactJob(job *data.BacktestJob) {
+	if job.Status != data.BacktestJobDone {
+		return
+	}
+	curve := buildEquityCurve(job.PortfolioHistory)
+	job.EquityCurve = &curve
+	params := job.Params
+	applySnapshotDefaults(&params)
+	job.PortfolioHistory = compactHistory(job.PortfolioHistory, params.Snapshots)
+}
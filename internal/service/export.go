@@ -0,0 +1,365 @@
+package service
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/Paaaark/hanquant/internal/data"
+	"github.com/Paaaark/hanquant/internal/metrics"
+)
+
+// Export formats of a stored backtest, by the file name they are served under
+const (
+	ExportTradesCSV      = "trades.csv"
+	ExportEquityCSV      = "equity.csv"
+	ExportSnapshotsJSONL = "snapshots.jsonl"
+	ExportTearsheet      = "tearsheet.html"
+)
+
+// ExportContentTypes maps every export format to its Content-Type
+var ExportContentTypes = map[string]string{
+	ExportTradesCSV:      "text/csv; charset=utf-8",
+	ExportEquityCSV:      "text/csv; charset=utf-8",
+	ExportSnapshotsJSONL: "application/x-ndjson; charset=utf-8",
+	ExportTearsheet:      "text/html; charset=utf-8",
+}
+
+// WriteExport writes a finished job in one of the export formats
+func WriteExport(w io.Writer, job *data.BacktestJob, format string) error {
+	switch format {
+	case ExportTradesCSV:
+		return WriteTradesCSV(w, job.Trades)
+	case ExportEquityCSV:
+		return WriteEquityCSV(w, job.PortfolioHistory)
+	case ExportSnapshotsJSONL:
+		return WriteSnapshotsJSONL(w, job.PortfolioHistory)
+	case ExportTearsheet:
+		return WriteTearsheet(w, job)
+	}
+	return fmt.Errorf("unknown export format %q", format)
+}
+
+// formatNumber writes a float without exponent and with at most two decimals, which is
+// what KRW amounts and percentages need
+func formatNumber(value float64) string {
+	return strconv.FormatFloat(math.Round(value*100)/100, 'f', -1, 64)
+}
+
+// WriteTradesCSV writes one row per fill with its costs
+func WriteTradesCSV(w io.Writer, trades []data.Trade) error {
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"Date", "Time", "Symbol", "Side", "Quantity", "Price", "Value", "Commission", "Tax", "Slippage", "Portfolio"})
+	for _, trade := range trades {
+		writer.Write([]string{
+			trade.Date,
+			trade.Time,
+			trade.Symbol,
+			trade.Side,
+			strconv.Itoa(trade.Quantity),
+			formatNumber(trade.Price),
+			formatNumber(trade.Value),
+			formatNumber(trade.Commission),
+			formatNumber(trade.Tax),
+			formatNumber(trade.Slippage),
+			formatNumber(trade.Portfolio),
+		})
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// WriteEquityCSV writes one row per day: cash, value of positions, total, and the daily return
+// and drawdown of the total in percent
+func WriteEquityCSV(w io.Writer, history []data.PortfolioSnapshot) error {
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"Date", "Cash", "Positions", "Total", "Return", "Drawdown"})
+	previous, peak := 0.0, 0.0
+	for _, snapshot := range history {
+		total := snapshot.Portfolio.Total
+		dailyReturn := 0.0
+		if previous > 0 {
+			dailyReturn = (total/previous - 1) * 100
+		}
+		peak = math.Max(peak, total)
+		drawdown := 0.0
+		if peak > 0 {
+			drawdown = (1 - total/peak) * 100
+		}
+		previous = total
+
+		writer.Write([]string{
+			snapshot.Date,
+			formatNumber(snapshot.Portfolio.Cash),
+			formatNumber(total - snapshot.Portfolio.Cash),
+			formatNumber(total),
+			strconv.FormatFloat(dailyReturn, 'f', 4, 64),
+			strconv.FormatFloat(drawdown, 'f', 4, 64),
+		})
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// WriteSnapshotsJSONL writes every portfolio snapshot as one JSON object per line
+func WriteSnapshotsJSONL(w io.Writer, history []data.PortfolioSnapshot) error {
+	encoder := json.NewEncoder(w)
+	for _, snapshot := range history {
+		if err := encoder.Encode(snapshot); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// tearsheetRow is one line of the metrics table
+type tearsheetRow struct {
+	Label string
+	Value string
+}
+
+// tearsheetPage is what the tearsheet template renders
+type tearsheetPage struct {
+	Title    string
+	Period   string
+	Universe string
+	Metrics  [][]tearsheetRow // two label/value pairs per table row
+	Equity   template.HTML
+	Drawdown template.HTML
+	Heatmap  template.HTML
+}
+
+var tearsheetTemplate = template.Must(template.New("tearsheet").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", "Noto Sans KR", sans-serif; margin: 32px auto; max-width: 880px; color: #222; }
+h1 { font-size: 22px; margin-bottom: 4px; }
+h2 { font-size: 16px; margin-top: 32px; }
+.sub { color: #666; font-size: 13px; }
+table.metrics { border-collapse: collapse; width: 100%; font-size: 13px; }
+table.metrics td { padding: 4px 8px; border-bottom: 1px solid #eee; }
+table.metrics td:nth-child(even) { text-align: right; font-variant-numeric: tabular-nums; }
+svg text { font-size: 11px; fill: #555; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<div class="sub">{{.Period}}</div>
+<div class="sub">{{.Universe}}</div>
+<h2>Metrics</h2>
+<table class="metrics">
+{{range .Metrics}}<tr>{{range .}}<td>{{.Label}}</td><td>{{.Value}}</td>{{end}}</tr>
+{{end}}</table>
+<h2>Equity</h2>
+{{.Equity}}
+<h2>Drawdown</h2>
+{{.Drawdown}}
+<h2>Monthly returns (%)</h2>
+{{.Heatmap}}
+</body>
+</html>
+`))
+
+// WriteTearsheet writes a self-contained HTML report of a finished job: the metrics table and
+// inline SVG charts of the equity curve, the drawdown and the monthly returns
+func WriteTearsheet(w io.Writer, job *data.BacktestJob) error {
+	strategy := job.Params.Strategy
+	if strategy == "" {
+		strategy = fmt.Sprintf("sma_crossover %d/%d", job.Params.SMA_short, job.Params.SMA_long)
+	}
+	page := tearsheetPage{
+		Title:    fmt.Sprintf("Backtest #%d: %s", job.ID, strategy),
+		Period:   fmt.Sprintf("%s to %s, initial cash %s KRW", job.Params.From, job.Params.To, formatNumber(job.Params.InitialCash)),
+		Universe: strings.Join(job.Universe, ", "),
+	}
+
+	curve := metrics.FromSnapshots(job.PortfolioHistory)
+	page.Equity = template.HTML(lineChart(curve))
+	page.Drawdown = template.HTML(drawdownChart(curve))
+	if job.Metrics != nil {
+		rows := tearsheetMetrics(job.Metrics)
+		for i := 0; i < len(rows); i += 2 {
+			page.Metrics = append(page.Metrics, rows[i:min(i+2, len(rows))])
+		}
+		page.Heatmap = template.HTML(monthlyHeatmap(job.Metrics.Risk.MonthlyReturns, job.Metrics.Risk.YearlyReturns))
+	}
+	return tearsheetTemplate.Execute(w, page)
+}
+
+// tearsheetMetrics picks the rows of the metrics table
+func tearsheetMetrics(m *data.BacktestMetrics) []tearsheetRow {
+	percent := func(value float64) string { return formatNumber(value) + "%" }
+	ratio := func(value float64) string { return strconv.FormatFloat(value, 'f', 2, 64) }
+	return []tearsheetRow{
+		{"Total return", percent(m.TotalReturn)},
+		{"Gross return", percent(m.GrossReturn)},
+		{"CAGR", percent(m.Risk.CAGR)},
+		{"Volatility", percent(m.Risk.Volatility)},
+		{"Sharpe ratio", ratio(m.SharpeRatio)},
+		{"Sortino ratio", ratio(m.Risk.SortinoRatio)},
+		{"Calmar ratio", ratio(m.Risk.CalmarRatio)},
+		{"Max drawdown", percent(m.MaxDrawdown)},
+		{"Longest drawdown", fmt.Sprintf("%d days", m.Risk.LongestDrawdownDays)},
+		{fmt.Sprintf("Daily VaR (%.0f%%)", m.Risk.VaRConfidence*100), percent(m.Risk.HistoricalVaR)},
+		{"Trades", strconv.Itoa(m.TotalTrades)},
+		{"Round trips", strconv.Itoa(m.RoundTripCount)},
+		{"Win rate", percent(m.WinRate)},
+		{"Profit factor", ratio(m.ProfitFactor)},
+		{"Avg holding", formatNumber(m.AvgHoldingDays) + " days"},
+		{"Total P&L", formatNumber(m.TotalPnL) + " KRW"},
+		{"Total costs", formatNumber(m.TotalCosts) + " KRW"},
+	}
+}
+
+// Chart geometry shared by the line and drawdown charts, in SVG user units
+const (
+	chartWidth   = 880
+	chartHeight  = 220
+	chartPadLeft = 70
+	chartPadBot  = 20
+	chartPadTop  = 10
+)
+
+// plotPoints maps values onto the plot area between low and high
+func plotPoints(values []float64, low, high float64) []string {
+	if high == low {
+		high = low + 1
+	}
+	plotWidth := float64(chartWidth - chartPadLeft)
+	plotHeight := float64(chartHeight - chartPadBot - chartPadTop)
+	points := make([]string, len(values))
+	for i, value := range values {
+		x := float64(chartPadLeft)
+		if len(values) > 1 {
+			x += plotWidth * float64(i) / float64(len(values)-1)
+		}
+		y := float64(chartPadTop) + plotHeight*(high-value)/(high-low)
+		points[i] = fmt.Sprintf("%.1f,%.1f", x, y)
+	}
+	return points
+}
+
+// chartFrame opens an SVG with the y-axis labels and the first and last dates
+func chartFrame(b *strings.Builder, curve []metrics.Point, top, bottom string) {
+	fmt.Fprintf(b, `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 %d %d" width="100%%">`, chartWidth, chartHeight)
+	fmt.Fprintf(b, `<line x1="%d" y1="%d" x2="%d" y2="%d" stroke="#ccc"/>`, chartPadLeft, chartHeight-chartPadBot, chartWidth, chartHeight-chartPadBot)
+	fmt.Fprintf(b, `<text x="%d" y="%d" text-anchor="end">%s</text>`, chartPadLeft-6, chartPadTop+8, template.HTMLEscapeString(top))
+	fmt.Fprintf(b, `<text x="%d" y="%d" text-anchor="end">%s</text>`, chartPadLeft-6, chartHeight-chartPadBot, template.HTMLEscapeString(bottom))
+	fmt.Fprintf(b, `<text x="%d" y="%d">%s</text>`, chartPadLeft, chartHeight-4, curve[0].Date.Format("2006-01-02"))
+	fmt.Fprintf(b, `<text x="%d" y="%d" text-anchor="end">%s</text>`, chartWidth, chartHeight-4, curve[len(curve)-1].Date.Format("2006-01-02"))
+}
+
+// lineChart draws the equity curve between its lowest and highest value
+func lineChart(curve []metrics.Point) string {
+	if len(curve) == 0 {
+		return "<p>No equity curve.</p>"
+	}
+	values := make([]float64, len(curve))
+	low, high := math.Inf(1), math.Inf(-1)
+	for i, point := range curve {
+		values[i] = point.Value
+		low = math.Min(low, point.Value)
+		high = math.Max(high, point.Value)
+	}
+
+	var b strings.Builder
+	chartFrame(&b, curve, formatNumber(high), formatNumber(low))
+	fmt.Fprintf(&b, `<polyline fill="none" stroke="#1f5fbf" stroke-width="1.5" points="%s"/>`, strings.Join(plotPoints(values, low, high), " "))
+	b.WriteString("</svg>")
+	return b.String()
+}
+
+// drawdownChart draws the decline from the running peak, in percent, as an area hanging from zero
+func drawdownChart(curve []metrics.Point) string {
+	if len(curve) == 0 {
+		return "<p>No equity curve.</p>"
+	}
+	drawdowns := make([]float64, len(curve))
+	peak, deepest := 0.0, 0.0
+	for i, point := range curve {
+		peak = math.Max(peak, point.Value)
+		if peak > 0 {
+			drawdowns[i] = -(1 - point.Value/peak) * 100
+		}
+		deepest = math.Min(deepest, drawdowns[i])
+	}
+	// Zero is the top of the plot; close the area along it
+	polygon := append([]string{fmt.Sprintf("%d,%d", chartPadLeft, chartPadTop)}, plotPoints(drawdowns, deepest, 0)...)
+	polygon = append(polygon, fmt.Sprintf("%d,%d", chartWidth, chartPadTop))
+
+	var b strings.Builder
+	chartFrame(&b, curve, "0%", formatNumber(deepest)+"%")
+	fmt.Fprintf(&b, `<polygon fill="#c0392b" fill-opacity="0.35" stroke="#c0392b" points="%s"/>`, strings.Join(polygon, " "))
+	b.WriteString("</svg>")
+	return b.String()
+}
+
+// heatColor shades a monthly return, red for gains and blue for losses as on KRX screens,
+// saturating at ±10%
+func heatColor(value float64) string {
+	intensity := math.Min(math.Abs(value)/10, 1)
+	light := int(255 - 175*intensity)
+	if value >= 0 {
+		return fmt.Sprintf("rgb(255,%d,%d)", light, light)
+	}
+	return fmt.Sprintf("rgb(%d,%d,255)", light, light)
+}
+
+// monthlyHeatmap draws a year by month grid of returns with the yearly return in the last column
+func monthlyHeatmap(monthly, yearly []data.PeriodReturn) string {
+	if len(monthly) == 0 {
+		return "<p>No monthly returns.</p>"
+	}
+	byMonth := make(map[string]float64, len(monthly))
+	var years []string
+	for _, period := range monthly {
+		byMonth[period.Period] = period.Return
+		if year := period.Period[:4]; len(years) == 0 || years[len(years)-1] != year {
+			years = append(years, year)
+		}
+	}
+	byYear := make(map[string]float64, len(yearly))
+	for _, period := range yearly {
+		byYear[period.Period] = period.Return
+	}
+
+	const cellWidth, cellHeight, labelWidth = 58, 22, 50
+	width := labelWidth + 13*cellWidth
+	height := (len(years) + 1) * cellHeight
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 %d %d" width="100%%">`, width, height)
+	headers := []string{"Jan", "Feb", "Mar", "Apr", "May", "Jun", "Jul", "Aug", "Sep", "Oct", "Nov", "Dec", "Year"}
+	for i, header := range headers {
+		fmt.Fprintf(&b, `<text x="%d" y="%d" text-anchor="middle">%s</text>`, labelWidth+i*cellWidth+cellWidth/2, cellHeight-7, header)
+	}
+	for row, year := range years {
+		y := (row + 1) * cellHeight
+		fmt.Fprintf(&b, `<text x="%d" y="%d">%s</text>`, 4, y+cellHeight-7, year)
+		for month := 1; month <= 13; month++ {
+			var value float64
+			var exists bool
+			if month == 13 {
+				value, exists = byYear[year]
+			} else {
+				value, exists = byMonth[fmt.Sprintf("%s-%02d", year, month)]
+			}
+			if !exists {
+				continue
+			}
+			x := labelWidth + (month-1)*cellWidth
+			fmt.Fprintf(&b, `<rect x="%d" y="%d" width="%d" height="%d" fill="%s" stroke="#fff"/>`, x, y, cellWidth, cellHeight, heatColor(value))
+			fmt.Fprintf(&b, `<text x="%d" y="%d" text-anchor="middle">%.1f</text>`, x+cellWidth/2, y+cellHeight-7, value)
+		}
+	}
+	b.WriteString("</svg>")
+	return b.String()
+}
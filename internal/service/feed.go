@@ -0,0 +1,301 @@
+package service
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Paaaark/hanquant/internal/data"
+)
+
+// Feed yields the bars of a universe as time-ordered steps. Backtests replay stored history
+// through one and paper trading reads a live one, so strategies and the simulated broker see
+// the same MarketDay events either way.
+type Feed interface {
+	// Next blocks until the next step is available. It returns io.EOF after the last step,
+	// or the context error once ctx is cancelled.
+	Next(ctx context.Context) (data.MarketDay, error)
+}
+
+// growingFeed is a feed whose steps extend the history the run started with. The engine hands
+// the grown history to the strategy and the sizer again before each step, so strategies that
+// precompute indicators in Init also see bars that did not exist when the run started.
+type growingFeed interface {
+	Feed
+	History() map[string][]data.StockData
+}
+
+// replayFeed steps through days that are already loaded
+type replayFeed struct {
+	days []data.MarketDay
+	next int
+}
+
+func newReplayFeed(days []data.MarketDay) *replayFeed {
+	return &replayFeed{days: days}
+}
+
+func (f *replayFeed) Next(ctx context.Context) (data.MarketDay, error) {
+	if err := ctx.Err(); err != nil {
+		return data.MarketDay{}, err
+	}
+	if f.next == len(f.days) {
+		return data.MarketDay{}, io.EOF
+	}
+	f.next++
+	return f.days[f.next-1], nil
+}
+
+// Len is the number of steps in the replay, for progress reports
+func (f *replayFeed) Len() int {
+	return len(f.days)
+}
+
+// rebalancingFeed marks the rebalance days of a feed whose days are not known in advance,
+// counting the schedule from its first step like markRebalanceDays does for a whole backtest
+type rebalancingFeed struct {
+	Feed
+	marker *rebalanceMarker
+}
+
+func newRebalancingFeed(feed Feed, schedule data.RebalanceSchedule) *rebalancingFeed {
+	return &rebalancingFeed{Feed: feed, marker: &rebalanceMarker{schedule: schedule}}
+}
+
+func (f *rebalancingFeed) Next(ctx context.Context) (data.MarketDay, error) {
+	day, err := f.Feed.Next(ctx)
+	if err != nil {
+		return day, err
+	}
+	days := []data.MarketDay{day}
+	if err := f.marker.mark(days); err != nil {
+		return data.MarketDay{}, fmt.Errorf("failed to build rebalance schedule: %w", err)
+	}
+	return days[0], nil
+}
+
+// History of the wrapped feed, when it grows
+func (f *rebalancingFeed) History() map[string][]data.StockData {
+	if grown, ok := f.Feed.(growingFeed); ok {
+		return grown.History()
+	}
+	return nil
+}
+
+// validateSource checks where params takes its bars from
+func validateSource(params data.BacktestParams) error {
+	switch params.Source {
+	case "", "store":
+		return nil
+	case "csv":
+		if params.Interval > 0 {
+			return fmt.Errorf("source csv has daily bars only")
+		}
+		if params.Adjusted {
+			return fmt.Errorf("source csv bars are used as they are and cannot be adjusted")
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown source %q: use store or csv", params.Source)
+}
+
+// csvDataDir is the directory of the csv source, one <symbol>.csv per stock
+func csvDataDir() string {
+	if dir := os.Getenv("BACKTEST_CSV_DIR"); dir != "" {
+		return dir
+	}
+	return filepath.Join(".kis_data", "csv")
+}
+
+// LoadCSVBars reads the daily bars of symbol within [from, to] from <dir>/<symbol>.csv. The
+// file needs a header naming Date, Open, High, Low, Close and Volume columns in any order;
+// dates are YYYYMMDD or YYYY-MM-DD and rows may come in any order.
+func LoadCSVBars(dir, symbol, from, to string) ([]data.StockData, error) {
+	if strings.ContainsAny(symbol, `/\`) || strings.Contains(symbol, "..") {
+		return nil, fmt.Errorf("invalid symbol %q", symbol)
+	}
+	file, err := os.Open(filepath.Join(dir, symbol+".csv"))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	records, err := csv.NewReader(file).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("read %s.csv: %w", symbol, err)
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("%s.csv is empty", symbol)
+	}
+
+	columns := make(map[string]int)
+	for i, name := range records[0] {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, name := range []string{"date", "open", "high", "low", "close", "volume"} {
+		if _, exists := columns[name]; !exists {
+			return nil, fmt.Errorf("%s.csv has no %s column", symbol, name)
+		}
+	}
+
+	var bars []data.StockData
+	for line, record := range records[1:] {
+		field := func(name string) string {
+			if i := columns[name]; i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+		day := strings.ReplaceAll(field("date"), "-", "")
+		date, err := time.Parse("20060102", day)
+		if err != nil {
+			return nil, fmt.Errorf("%s.csv line %d: invalid date %q", symbol, line+2, field("date"))
+		}
+		if day < from || day > to {
+			continue
+		}
+		bar := data.StockData{Symbol: symbol, Date: date}
+		prices := []*float64{&bar.Open, &bar.High, &bar.Low, &bar.Close}
+		for i, name := range []string{"open", "high", "low", "close"} {
+			if *prices[i], err = strconv.ParseFloat(field(name), 64); err != nil {
+				return nil, fmt.Errorf("%s.csv line %d: invalid %s %q", symbol, line+2, name, field(name))
+			}
+		}
+		volume, err := strconv.ParseFloat(field("volume"), 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s.csv line %d: invalid volume %q", symbol, line+2, field("volume"))
+		}
+		bar.Volume = int64(volume)
+		bars = append(bars, bar)
+	}
+
+	sort.Slice(bars, func(i, j int) bool {
+		return bars[i].Date.Before(bars[j].Date)
+	})
+	return bars, nil
+}
+
+// liveCloseMinute is when the live feed reads the day's bars: 15:40 KST, once the closing
+// auction has printed
+const liveCloseMinute = 15*60 + 40
+
+// snapshotBatch is the number of stocks KIS returns per multi-stock snapshot request
+const snapshotBatch = 30
+
+// LiveFeed builds one step per trading day from KIS snapshots taken after the close, so a
+// strategy trades live days exactly like the daily bars of a backtest: signals on the close,
+// fills from the next session on. New bars are added to the history the feed was given.
+type LiveFeed struct {
+	stocks   *StockService
+	universe []string
+	history  map[string][]data.StockData
+	retry    time.Duration // wait between attempts while the day's bars are not ready
+	stop     <-chan struct{}
+	last     string // YYYYMMDD of the last session emitted
+}
+
+// NewLiveFeed creates a live feed over universe that continues history. The feed ends with
+// io.EOF once stop is closed.
+func NewLiveFeed(stocks *StockService, universe []string, history map[string][]data.StockData, retry time.Duration, stop <-chan struct{}) *LiveFeed {
+	feed := &LiveFeed{stocks: stocks, universe: universe, history: history, retry: retry, stop: stop}
+	for _, bars := range history {
+		if len(bars) > 0 {
+			if day := bars[len(bars)-1].Date.Format("20060102"); day > feed.last {
+				feed.last = day
+			}
+		}
+	}
+	return feed
+}
+
+// History returns the bars the feed started with and those it emitted since
+func (f *LiveFeed) History() map[string][]data.StockData {
+	return f.history
+}
+
+// Next waits for the close of the next trading day after the last one emitted, then reads
+// snapshots of the universe. Failed reads are retried.
+func (f *LiveFeed) Next(ctx context.Context) (data.MarketDay, error) {
+	for {
+		now := time.Now().In(time.FixedZone("KST", 9*60*60))
+		session := now.Format("20060102")
+		if session > f.last && data.IsTradingDay(session) && now.Hour()*60+now.Minute() >= liveCloseMinute {
+			day, err := f.readSession(session)
+			if err == nil {
+				f.last = session
+				return day, nil
+			}
+			log.Printf("live feed: %v", err)
+		}
+
+		select {
+		case <-f.stop:
+			return data.MarketDay{}, io.EOF
+		case <-ctx.Done():
+			return data.MarketDay{}, ctx.Err()
+		case <-time.After(f.retry):
+		}
+	}
+}
+
+// readSession turns the snapshots of the universe into the bars of session
+func (f *LiveFeed) readSession(session string) (data.MarketDay, error) {
+	date, _ := time.Parse("20060102", session)
+	snapshots := make(map[string]data.StockSnapshot, len(f.universe))
+	for start := 0; start < len(f.universe); start += snapshotBatch {
+		batch := f.universe[start:min(start+snapshotBatch, len(f.universe))]
+		rows, err := f.stocks.GetMultipleStockSnapshot(batch)
+		if err != nil {
+			return data.MarketDay{}, fmt.Errorf("snapshots of %s: %w", session, err)
+		}
+		for _, row := range rows {
+			snapshots[row.Code] = row
+		}
+	}
+
+	day := data.MarketDay{Date: date, SessionEnd: true}
+	for _, symbol := range f.universe {
+		snapshot, exists := snapshots[symbol]
+		if !exists {
+			continue
+		}
+		bar, ok := snapshotBar(symbol, date, snapshot)
+		if !ok {
+			// Halted stocks report no trade for the day
+			continue
+		}
+		day.Bars = append(day.Bars, bar)
+		f.history[symbol] = append(f.history[symbol], bar)
+	}
+	if len(day.Bars) == 0 {
+		return data.MarketDay{}, fmt.Errorf("no stock of the universe traded on %s", session)
+	}
+	day.IndexBars()
+	return day, nil
+}
+
+// snapshotBar reads the day's bar from a snapshot, reporting false when the stock did not trade
+func snapshotBar(symbol string, date time.Time, snapshot data.StockSnapshot) (data.StockData, bool) {
+	parse := func(value string) float64 {
+		parsed, _ := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		return parsed
+	}
+	bar := data.StockData{
+		Symbol: symbol,
+		Date:   date,
+		Open:   parse(snapshot.Open),
+		High:   parse(snapshot.High),
+		Low:    parse(snapshot.Low),
+		Close:  parse(snapshot.Price),
+		Volume: int64(parse(snapshot.Volume)),
+	}
+	return bar, bar.Volume > 0 && bar.Open > 0 && bar.Close > 0
+}
@@ -18,25 +18,12 @@ type HistoricalService struct {
 // NewHistoricalService creates a new HistoricalService instance
 func NewHistoricalService(kisClient *data.KISClient, s3Storage *data.S3Storage) *HistoricalService {
 	return &HistoricalService{
-		kisClient: kisClient,
+		// Bulk fetches wait behind interactive requests on the same app key
+		kisClient: kisClient.WithPriority(data.PriorityBulk),
 		s3Storage: s3Storage,
 	}
 }
 
-// rateLimiter ensures we don't exceed 20 API calls per second
-type rateLimiter struct {
-	lastCall time.Time
-}
-
-func (rl *rateLimiter) wait() {
-	// Ensure at least 50ms between calls (20 calls per second = 50ms per call)
-	elapsed := time.Since(rl.lastCall)
-	if elapsed < 50*time.Millisecond {
-		time.Sleep(50*time.Millisecond - elapsed)
-	}
-	rl.lastCall = time.Now()
-}
-
 // isRateLimitError checks if an error is a rate limiting error
 func isRateLimitError(err error) bool {
 	if err == nil {
@@ -248,8 +235,8 @@ func (s *HistoricalService) FetchAndStoreDailyData(symbol, fromDate, toDate stri
 	fmt.Printf("\tFetching data for %s in %d ranges: %d existing records\n", symbol, len(neededRanges), len(existingData))
 
 	// Fetch data for each needed range (from newest to oldest)
-	rateLimiter := &rateLimiter{}
 	var allNewData data.SlicePriceStruct
+	var actions []data.CorporateAction
 	reachedEndOfData := false
 
 	for i, dateRange := range neededRanges {
@@ -258,38 +245,29 @@ func (s *HistoricalService) FetchAndStoreDailyData(symbol, fromDate, toDate stri
 			break
 		}
 
-		rateLimiter.wait()
-		
 		fmt.Printf("\tRange %d/%d: %s to %s\n", i+1, len(neededRanges), 
 			formatDate(dateRange.start), formatDate(dateRange.end))
 		
-		rateLimiter.wait()
-		
-		// Fetch data from KIS API with retry logic for rate limiting
-		var dailyData data.SlicePriceStruct
-		maxRetries := 3
-		
-		for attempt := 0; attempt < maxRetries; attempt++ {
-			dailyData, err = s.kisClient.GetDailyStockData(symbol, formatDate(dateRange.start), formatDate(dateRange.end))
-			if err == nil {
-				break // Success, exit retry loop
-			}
-			
-			if isRateLimitError(err) {
-				fmt.Printf("\tRate limit error in range %d/%d: %v\n", i+1, len(neededRanges), err)
-				if attempt < maxRetries-1 {
-					handleRateLimitError(err, attempt)
-					continue // Retry
-				}
-			}
-			
-			// Non-rate-limit error or max retries reached
-			return fmt.Errorf("failed to fetch daily data for %s (%s-%s): %w", symbol, formatDate(dateRange.start), formatDate(dateRange.end), err)
+		// Start a week early so a corporate action on the first day of the range is still
+		// seen against the day before it
+		start := dateRange.start.AddDate(0, 0, -7)
+		dailyData, err := s.fetchDailyRange(symbol, start, dateRange.end, false)
+		if err != nil {
+			return err
 		}
 
 		allNewData = append(allNewData, dailyData...)
 		fmt.Printf("\t\tReceived %d daily records for range %d\n", len(dailyData), i+1)
 
+		// The adjusted series of the same days reveals splits and other capital changes
+		if len(dailyData) > 0 {
+			adjustedData, err := s.fetchDailyRange(symbol, start, dateRange.end, true)
+			if err != nil {
+				return err
+			}
+			actions = append(actions, detectCorporateActions(dailyData, adjustedData)...)
+		}
+
 		// If the chunk returned 0 records, check if this is likely the end of historical data
 		if len(dailyData) == 0 {
 			reachedEndOfData = true
@@ -306,11 +284,87 @@ func (s *HistoricalService) FetchAndStoreDailyData(symbol, fromDate, toDate stri
 	if err != nil {
 		return fmt.Errorf("failed to store daily data for %s: %w", symbol, err)
 	}
+	if err := s.recordCorporateActions(symbol, actions); err != nil {
+		return err
+	}
 
 	// fmt.Printf("Successfully stored %d new daily records for %s\n", len(allNewData), symbol)
 	return nil
 }
 
+// fetchDailyRange fetches traded or adjusted daily prices from KIS, retrying on rate limits
+func (s *HistoricalService) fetchDailyRange(symbol string, start, end time.Time, adjusted bool) (data.SlicePriceStruct, error) {
+	maxRetries := 3
+	for attempt := 0; ; attempt++ {
+		dailyData, err := s.kisClient.GetDailyStockData(symbol, formatDate(start), formatDate(end), adjusted)
+		if err == nil {
+			return dailyData, nil
+		}
+
+		if isRateLimitError(err) && attempt < maxRetries-1 {
+			fmt.Printf("\tRate limit error for %s (%s-%s): %v\n", symbol, formatDate(start), formatDate(end), err)
+			handleRateLimitError(err, attempt)
+			continue // Retry
+		}
+
+		// Non-rate-limit error or max retries reached
+		return nil, fmt.Errorf("failed to fetch daily data for %s (%s-%s): %w", symbol, formatDate(start), formatDate(end), err)
+	}
+}
+
+// recordCorporateActions merges detected actions into the symbol's log in S3
+func (s *HistoricalService) recordCorporateActions(symbol string, detected []data.CorporateAction) error {
+	if len(detected) == 0 {
+		return nil
+	}
+	existing, err := s.s3Storage.LoadCorporateActions(symbol)
+	if err != nil {
+		return err
+	}
+	merged := mergeCorporateActions(existing, detected)
+	fmt.Printf("\tRecording %d corporate actions for %s (%d in log)\n", len(detected), symbol, len(merged))
+	return s.s3Storage.StoreCorporateActions(symbol, merged)
+}
+
+// RefreshCorporateActions refetches traded and adjusted prices of symbol between fromDate and
+// toDate, replacing the stored daily prices of that period with traded ones and recording every
+// corporate action found. Daily files collected with adjusted prices are rebuilt this way.
+func (s *HistoricalService) RefreshCorporateActions(symbol, fromDate, toDate string) error {
+	chunks, err := splitDateRange(fromDate, toDate, "daily")
+	if err != nil {
+		return err
+	}
+
+	var allData data.SlicePriceStruct
+	var actions []data.CorporateAction
+	for _, chunk := range chunks {
+		start, _ := parseDate(chunk[0])
+		end, _ := parseDate(chunk[1])
+
+		dailyData, err := s.fetchDailyRange(symbol, start, end, false)
+		if err != nil {
+			return err
+		}
+		if len(dailyData) == 0 {
+			continue
+		}
+		adjustedData, err := s.fetchDailyRange(symbol, start, end, true)
+		if err != nil {
+			return err
+		}
+		allData = append(allData, dailyData...)
+		actions = append(actions, detectCorporateActions(dailyData, adjustedData)...)
+	}
+
+	if len(allData) == 0 {
+		return fmt.Errorf("no daily data for %s between %s and %s", symbol, fromDate, toDate)
+	}
+	if err := s.s3Storage.MergeAndStoreData(symbol, allData, "daily"); err != nil {
+		return fmt.Errorf("failed to store daily data for %s: %w", symbol, err)
+	}
+	return s.recordCorporateActions(symbol, actions)
+}
+
 // dateRange represents a date range for fetching
 type dateRange struct {
 	start time.Time
@@ -421,14 +475,11 @@ func (s *HistoricalService) FetchAndStoreMinuteData(symbol, fromDate, toDate str
 		return fmt.Errorf("failed to split date range: %w", err)
 	}
 
-	rateLimiter := &rateLimiter{}
 	var allData data.SliceMinutePriceStruct
 
 	fmt.Printf("Fetching minute data for %s in %d chunks...\n", symbol, len(chunks))
 
 	for i, chunk := range chunks {
-		rateLimiter.wait()
-		
 		fmt.Printf("Chunk %d/%d: %s to %s\n", i+1, len(chunks), chunk[0], chunk[1])
 		
 		// Fetch data from KIS API with retry logic for rate limiting
@@ -565,15 +616,11 @@ func (s *HistoricalService) BulkFetchDailyData(symbols []string) error {
 		return err
 	}
 
-	rateLimiter := &rateLimiter{}
-	
 	successCount := 0
 	errorCount := 0
 	incompleteCount := 0
 
 	for i, symbol := range symbols {
-		rateLimiter.wait()
-		
 		fmt.Printf("Fetching daily data for %s (%d/%d)...\n", symbol, i+1, len(symbols))
 		
 		// Check if data is already complete
@@ -618,11 +665,7 @@ func (s *HistoricalService) BulkFetchMinuteData(symbols []string) error {
 		return err
 	}
 
-	rateLimiter := &rateLimiter{}
-	
 	for i, symbol := range symbols {
-		rateLimiter.wait()
-		
 		fmt.Printf("Fetching minute data for %s (%d/%d)...\n", symbol, i+1, len(symbols))
 		err := s.FetchAndStoreMinuteData(symbol, fromDate, toDate)
 		if err != nil {
@@ -638,8 +681,6 @@ func (s *HistoricalService) BulkFetchMinuteData(symbols []string) error {
 // FetchAndStoreTodayData fetches today's data for multiple symbols using GetMultipleStockSnapshot
 // This is more efficient than individual API calls as it can fetch 30 symbols at once
 func (s *HistoricalService) FetchAndStoreTodayData(symbols []string, targetDate string) error {
-	rateLimiter := &rateLimiter{}
-	
 	// Process symbols in batches of 30 (KIS API limit for GetMultipleStockSnapshot)
 	batchSize := 30
 	totalBatches := (len(symbols) + batchSize - 1) / batchSize
@@ -659,8 +700,6 @@ func (s *HistoricalService) FetchAndStoreTodayData(symbols []string, targetDate
 		
 		batchSymbols := symbols[start:end]
 		
-		rateLimiter.wait()
-		
 		fmt.Printf("Processing batch %d/%d: symbols %d-%d (%d symbols)\n", 
 			batchIndex+1, totalBatches, start+1, end, len(batchSymbols))
 		
@@ -0,0 +1,110 @@
+package service
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/Paaaark/hanquant/internal/data"
+	"github.com/Paaaark/hanquant/internal/indicators"
+)
+
+// maxIndicatorSpecs bounds the work of a single /indicators request
+const maxIndicatorSpecs = 20
+
+// GetIndicators computes the requested indicators for symbol over from..to (YYYYMMDD), on
+// adjusted prices if asked. Bars before from are fetched so that every series is warmed up by
+// the first returned date when enough history exists.
+func (s *StockService) GetIndicators(symbol, from, to string, specs []indicators.Spec, adjusted bool) (*data.IndicatorResult, error) {
+	if len(specs) > maxIndicatorSpecs {
+		return nil, fmt.Errorf("at most %d indicators per request", maxIndicatorSpecs)
+	}
+	if from == "" || to == "" {
+		now := time.Now()
+		to = now.Format("20060102")
+		from = now.AddDate(0, -3, 0).Format("20060102")
+	}
+	fromDate, err := time.Parse("20060102", from)
+	if err != nil {
+		return nil, fmt.Errorf("invalid from date: %w", err)
+	}
+	if _, err := time.Parse("20060102", to); err != nil {
+		return nil, fmt.Errorf("invalid to date: %w", err)
+	}
+	if from > to {
+		return nil, fmt.Errorf("from must not be after to")
+	}
+
+	streams := make([]indicators.Indicator, len(specs))
+	lookback := 0
+	for i, spec := range specs {
+		streams[i] = spec.New()
+		lookback = max(lookback, streams[i].Lookback())
+	}
+
+	bars, err := s.GetDailyBars(symbol, warmupStart(fromDate, lookback), to, adjusted)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &data.IndicatorResult{
+		Symbol:     symbol,
+		From:       from,
+		To:         to,
+		Dates:      []string{},
+		Close:      []float64{},
+		Indicators: make([]data.IndicatorSeries, len(specs)),
+	}
+	for i, spec := range specs {
+		result.Indicators[i] = data.IndicatorSeries{
+			Spec:     spec.Raw,
+			Key:      spec.Key(),
+			Lookback: streams[i].Lookback(),
+			Outputs:  make(map[string][]*float64),
+		}
+		for _, name := range streams[i].Outputs() {
+			result.Indicators[i].Outputs[name] = []*float64{}
+		}
+	}
+
+	// Feed every bar, but only record the ones inside the requested range
+	for _, bar := range bars {
+		for _, stream := range streams {
+			stream.Update(bar)
+		}
+		day := bar.Date.Format("20060102")
+		if day < from || day > to {
+			continue
+		}
+
+		result.Dates = append(result.Dates, day)
+		result.Close = append(result.Close, bar.Close)
+		for i, stream := range streams {
+			names := stream.Outputs()
+			for j, value := range stream.Values() {
+				series := result.Indicators[i].Outputs[names[j]]
+				result.Indicators[i].Outputs[names[j]] = append(series, nullableFloat(value))
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// warmupStart returns the YYYYMMDD date far enough before from to cover lookback trading
+// days, allowing for weekends and holidays
+func warmupStart(from time.Time, lookback int) string {
+	if lookback == 0 {
+		return from.Format("20060102")
+	}
+	calendarDays := lookback*7/5 + 14
+	return from.AddDate(0, 0, -calendarDays).Format("20060102")
+}
+
+// nullableFloat maps NaN to nil so it encodes as JSON null
+func nullableFloat(value float64) *float64 {
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return nil
+	}
+	return &value
+}
@@ -0,0 +1,181 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/Paaaark/hanquant/internal/data"
+)
+
+// Regular KRX session in minutes after midnight. Bars outside it (pre-market and
+// after-hours single price trading) are dropped.
+const (
+	sessionOpenMinute  = 9 * 60
+	sessionCloseMinute = 15*60 + 30
+
+	// maxIntradayDays bounds how many calendar days of minute data one backtest loads
+	maxIntradayDays = 366
+)
+
+// intradayIntervals are the supported intraday bar sizes in minutes
+var intradayIntervals = map[int]bool{1: true, 5: true, 15: true, 60: true}
+
+// validateInterval checks the intraday settings of params
+func validateInterval(params data.BacktestParams) error {
+	if params.Interval == 0 {
+		if params.FlatAtClose {
+			return fmt.Errorf("flat_at_close requires an intraday interval")
+		}
+		return nil
+	}
+	if !intradayIntervals[params.Interval] {
+		return fmt.Errorf("interval must be 1, 5, 15 or 60 minutes")
+	}
+
+	fromDate, err := time.Parse("20060102", params.From)
+	if err != nil {
+		return fmt.Errorf("invalid from date: %w", err)
+	}
+	toDate, err := time.Parse("20060102", params.To)
+	if err != nil {
+		return fmt.Errorf("invalid to date: %w", err)
+	}
+	if toDate.Sub(fromDate) > maxIntradayDays*24*time.Hour {
+		return fmt.Errorf("intraday backtests are limited to %d days", maxIntradayDays)
+	}
+	return nil
+}
+
+// barsPerYear is the number of bars of the given interval in a year of regular sessions
+func barsPerYear(interval int) float64 {
+	if interval == 0 {
+		return 252
+	}
+	perSession := (sessionCloseMinute - sessionOpenMinute + interval - 1) / interval
+	return 252 * float64(perSession)
+}
+
+// GetMinuteBars returns regular-session bars of symbol between from and to (YYYYMMDD,
+// inclusive), aggregated from the 1-minute S3 files to interval minutes. Month files are
+// read in order and aggregated one at a time, so only the aggregated bars are kept.
+// With adjusted set the bars are put on today's share basis like daily prices.
+func (s *StockService) GetMinuteBars(ctx context.Context, symbol, from, to string, interval int, adjusted bool) ([]data.StockData, error) {
+	if s.s3Storage == nil {
+		return nil, fmt.Errorf("intraday backtests need S3 minute data, but S3 storage is not configured")
+	}
+	fromDate, err := time.Parse("20060102", from)
+	if err != nil {
+		return nil, fmt.Errorf("invalid from date: %w", err)
+	}
+	toDate, err := time.Parse("20060102", to)
+	if err != nil {
+		return nil, fmt.Errorf("invalid to date: %w", err)
+	}
+
+	var result []data.StockData
+	for month := time.Date(fromDate.Year(), fromDate.Month(), 1, 0, 0, 0, 0, time.UTC); !month.After(toDate); month = month.AddDate(0, 1, 0) {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		rows, err := s.s3Storage.LoadMinuteData(symbol, month.Format("200601"))
+		if err != nil {
+			// Months before listing or not yet collected have no file
+			fmt.Printf("DEBUG: no minute data for %s in %s: %v\n", symbol, month.Format("200601"), err)
+			continue
+		}
+
+		bars := make([]data.StockData, 0, len(rows))
+		for _, row := range rows {
+			bar, ok := parseMinuteBar(symbol, row)
+			if !ok {
+				continue
+			}
+			day := bar.Date.Format("20060102")
+			if day < from || day > to || !inSession(bar.Date) {
+				continue
+			}
+			bars = append(bars, bar)
+		}
+		sort.Slice(bars, func(i, j int) bool {
+			return bars[i].Date.Before(bars[j].Date)
+		})
+		result = append(result, aggregateBars(bars, interval)...)
+	}
+
+	if len(result) == 0 {
+		return nil, fmt.Errorf("no minute data for %s between %s and %s", symbol, from, to)
+	}
+	if adjusted {
+		actions, err := s.s3Storage.LoadCorporateActions(symbol)
+		if err != nil {
+			return nil, err
+		}
+		adjustBars(result, actions)
+	}
+	return result, nil
+}
+
+// parseMinuteBar converts one S3 minute row; its DateTime is YYYYMMDDHHMMSS in KST wall time
+func parseMinuteBar(symbol string, row data.MinutePriceStruct) (data.StockData, bool) {
+	date, err := time.Parse("20060102150405", row.DateTime)
+	if err != nil {
+		return data.StockData{}, false
+	}
+	open, _ := strconv.ParseFloat(row.Open, 64)
+	high, _ := strconv.ParseFloat(row.High, 64)
+	low, _ := strconv.ParseFloat(row.Low, 64)
+	close, _ := strconv.ParseFloat(row.Close, 64)
+	volume, _ := strconv.ParseInt(row.Volume, 10, 64)
+	if close <= 0 {
+		return data.StockData{}, false
+	}
+	return data.StockData{
+		Symbol: symbol,
+		Date:   date,
+		Open:   open,
+		High:   high,
+		Low:    low,
+		Close:  close,
+		Volume: volume,
+	}, true
+}
+
+// inSession reports whether t falls within the regular session, the closing auction included
+func inSession(t time.Time) bool {
+	minute := t.Hour()*60 + t.Minute()
+	return minute >= sessionOpenMinute && minute <= sessionCloseMinute
+}
+
+// aggregateBars merges time-ordered 1-minute bars into interval-minute bars aligned to the
+// session open. Buckets never span two sessions, and each bar is stamped with its bucket start.
+func aggregateBars(bars []data.StockData, interval int) []data.StockData {
+	if interval <= 1 {
+		return bars
+	}
+
+	var result []data.StockData
+	var bucketStart time.Time
+	for _, bar := range bars {
+		midnight := time.Date(bar.Date.Year(), bar.Date.Month(), bar.Date.Day(), 0, 0, 0, 0, bar.Date.Location())
+		offset := (bar.Date.Hour()*60 + bar.Date.Minute() - sessionOpenMinute) / interval * interval
+		start := midnight.Add(time.Duration(sessionOpenMinute+offset) * time.Minute)
+
+		if len(result) == 0 || !start.Equal(bucketStart) {
+			bucketStart = start
+			bar.Date = start
+			result = append(result, bar)
+			continue
+		}
+
+		current := &result[len(result)-1]
+		current.High = max(current.High, bar.High)
+		current.Low = min(current.Low, bar.Low)
+		current.Close = bar.Close
+		current.Volume += bar.Volume
+	}
+	return result
+}
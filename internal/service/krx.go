@@ -0,0 +1,74 @@
+package service
+
+import (
+	"math"
+	"time"
+)
+
+// tickBand is the tick size for prices below upTo
+type tickBand struct {
+	upTo float64
+	tick float64
+}
+
+// KRX tick size tables. Before the 2023-01-25 reform KOSPI and KOSDAQ used different
+// tables; since then both use the same one.
+var (
+	kospiTicksBefore2023  = []tickBand{{1000, 1}, {5000, 5}, {10000, 10}, {50000, 50}, {100000, 100}, {500000, 500}, {math.Inf(1), 1000}}
+	kosdaqTicksBefore2023 = []tickBand{{1000, 1}, {5000, 5}, {10000, 10}, {50000, 50}, {math.Inf(1), 100}}
+	unifiedTicks          = []tickBand{{2000, 1}, {5000, 5}, {20000, 10}, {50000, 50}, {200000, 100}, {500000, 500}, {math.Inf(1), 1000}}
+)
+
+const tickReformDate = "20230125"
+
+// priceLimitSchedule is the daily price limit as a fraction of the base price, by the date it took effect
+var priceLimitSchedule = []struct {
+	effective string // YYYYMMDD
+	rate      float64
+}{
+	{"00000000", 0.15},
+	{"20150615", 0.30},
+}
+
+// tickSize returns the tick of price for the market ("1" KOSPI, "2" KOSDAQ) on date
+func tickSize(price float64, market string, date time.Time) float64 {
+	bands := unifiedTicks
+	if date.Format("20060102") < tickReformDate {
+		bands = kospiTicksBefore2023
+		if market == "2" {
+			bands = kosdaqTicksBefore2023
+		}
+	}
+	for _, band := range bands {
+		if price < band.upTo {
+			return band.tick
+		}
+	}
+	return bands[len(bands)-1].tick
+}
+
+// roundToTick rounds price to a valid order price, up or down
+func roundToTick(price float64, up bool, market string, date time.Time) float64 {
+	tick := tickSize(price, market, date)
+	// Tolerate float noise so prices already on a tick stay put
+	steps := price / tick
+	if up {
+		return math.Ceil(steps-1e-9) * tick
+	}
+	return math.Floor(steps+1e-9) * tick
+}
+
+// priceLimits returns the lowest and highest prices allowed on date given the base price,
+// normally the previous session's close
+func priceLimits(base float64, market string, date time.Time) (float64, float64) {
+	day := date.Format("20060102")
+	rate := priceLimitSchedule[0].rate
+	for _, entry := range priceLimitSchedule {
+		if entry.effective <= day {
+			rate = entry.rate
+		}
+	}
+	lower := roundToTick(base*(1-rate), true, market, date)
+	upper := roundToTick(base*(1+rate), false, market, date)
+	return lower, upper
+}
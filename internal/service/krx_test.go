@@ -0,0 +1,88 @@
+package service
+
+import "testing"
+
+func TestTickSize(t *testing.T) {
+	tests := []struct {
+		price  float64
+		market string
+		day    string
+		want   float64
+	}{
+		// Before the reform KOSPI and KOSDAQ differ above 50,000
+		{1500, "1", "20230124", 5},
+		{1500, "2", "20230124", 5},
+		{9999, "1", "20230124", 10},
+		{12345, "1", "20230124", 50},
+		{60000, "1", "20230124", 100},
+		{150000, "1", "20230124", 500},
+		{150000, "2", "20230124", 100},
+		{600000, "1", "20230124", 1000},
+		{600000, "2", "20230124", 100},
+		// From the reform date both markets share one table
+		{1500, "1", "20230125", 1},
+		{1500, "2", "20230125", 1},
+		{2000, "1", "20230125", 5},
+		{12345, "1", "20230125", 10},
+		{150000, "1", "20230125", 100},
+		{150000, "2", "20230125", 100},
+		{600000, "2", "20230125", 1000},
+	}
+	for _, tt := range tests {
+		if got := tickSize(tt.price, tt.market, date(tt.day)); got != tt.want {
+			t.Errorf("tickSize(%v, %q, %s) = %v, want %v", tt.price, tt.market, tt.day, got, tt.want)
+		}
+	}
+}
+
+func TestRoundToTick(t *testing.T) {
+	tests := []struct {
+		price    float64
+		market   string
+		day      string
+		up, down float64
+	}{
+		{1503, "1", "20230124", 1505, 1500},
+		{1503, "1", "20230125", 1503, 1503},
+		{12345, "1", "20230124", 12350, 12300},
+		{12345, "1", "20230125", 12350, 12340},
+		{150250, "1", "20230124", 150500, 150000},
+		{150250, "2", "20230124", 150300, 150200},
+		{150250, "1", "20230125", 150300, 150200},
+		{600500, "2", "20230124", 600500, 600500},
+		{600500, "2", "20230125", 601000, 600000},
+		// Prices already on a tick stay put despite float noise
+		{5000, "1", "20230124", 5000, 5000},
+		{1005.0000000001, "1", "20230124", 1005, 1005},
+		{0.1 * 3 * 10000, "1", "20230125", 3000, 3000},
+	}
+	for _, tt := range tests {
+		if got := roundToTick(tt.price, true, tt.market, date(tt.day)); got != tt.up {
+			t.Errorf("roundToTick(%v, up, %q, %s) = %v, want %v", tt.price, tt.market, tt.day, got, tt.up)
+		}
+		if got := roundToTick(tt.price, false, tt.market, date(tt.day)); got != tt.down {
+			t.Errorf("roundToTick(%v, down, %q, %s) = %v, want %v", tt.price, tt.market, tt.day, got, tt.down)
+		}
+	}
+}
+
+func TestPriceLimits(t *testing.T) {
+	tests := []struct {
+		base         float64
+		market       string
+		day          string
+		lower, upper float64
+	}{
+		{10000, "1", "20150612", 8500, 11500},
+		{10000, "1", "20150615", 7000, 13000},
+		// 7,035 and 13,065 are not on the 10 won tick: the limits round inwards
+		{10050, "1", "20240102", 7040, 13060},
+		{10050, "1", "20220103", 7040, 13050},
+	}
+	for _, tt := range tests {
+		lower, upper := priceLimits(tt.base, tt.market, date(tt.day))
+		if lower != tt.lower || upper != tt.upper {
+			t.Errorf("priceLimits(%v, %q, %s) = %v, %v, want %v, %v", tt.base, tt.market, tt.day, lower, upper, tt.lower, tt.upper)
+		}
+	}
+}
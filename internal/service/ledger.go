@@ -0,0 +1,124 @@
+package service
+
+import (
+	"time"
+
+	"github.com/Paaaark/hanquant/internal/data"
+)
+
+// openLot is the unmatched remainder of a BUY fill
+type openLot struct {
+	date       string
+	price      float64
+	quantity   int
+	commission float64 // Entry commission still attributed to the remaining shares
+}
+
+// buildRoundTrips matches SELL fills against earlier BUY fills of the same symbol, oldest
+// lot first. A sell that spans several lots produces one round trip per lot, and a lot
+// that is only partly sold keeps its remaining shares and commission for later exits.
+// Positions still open at the end of the backtest are not included.
+func buildRoundTrips(trades []data.Trade) []data.RoundTrip {
+	lots := make(map[string][]*openLot)
+	var roundTrips []data.RoundTrip
+
+	for _, trade := range trades {
+		switch trade.Side {
+		case "BUY":
+			lots[trade.Symbol] = append(lots[trade.Symbol], &openLot{
+				date:       trade.Date,
+				price:      trade.Price,
+				quantity:   trade.Quantity,
+				commission: trade.Commission,
+			})
+		case "SELL":
+			remaining := trade.Quantity
+			exitCostPerShare := (trade.Commission + trade.Tax) / float64(trade.Quantity)
+
+			for remaining > 0 && len(lots[trade.Symbol]) > 0 {
+				lot := lots[trade.Symbol][0]
+				matched := min(remaining, lot.quantity)
+
+				entryCommission := lot.commission * float64(matched) / float64(lot.quantity)
+				entryCost := float64(matched)*lot.price + entryCommission
+				proceeds := float64(matched)*trade.Price - exitCostPerShare*float64(matched)
+				pnl := proceeds - entryCost
+
+				roundTrip := data.RoundTrip{
+					Symbol:      trade.Symbol,
+					EntryDate:   lot.date,
+					ExitDate:    trade.Date,
+					EntryPrice:  lot.price,
+					ExitPrice:   trade.Price,
+					Quantity:    matched,
+					HoldingDays: holdingDays(lot.date, trade.Date),
+					PnL:         pnl,
+				}
+				if entryCost > 0 {
+					roundTrip.Return = pnl / entryCost * 100
+				}
+				roundTrips = append(roundTrips, roundTrip)
+
+				lot.quantity -= matched
+				lot.commission -= entryCommission
+				remaining -= matched
+				if lot.quantity == 0 {
+					lots[trade.Symbol] = lots[trade.Symbol][1:]
+				}
+			}
+		}
+	}
+
+	return roundTrips
+}
+
+// holdingDays returns the calendar days between two YYYY-MM-DD dates
+func holdingDays(entry, exit string) int {
+	entryDate, err := time.Parse("2006-01-02", entry)
+	if err != nil {
+		return 0
+	}
+	exitDate, err := time.Parse("2006-01-02", exit)
+	if err != nil {
+		return 0
+	}
+	return int(exitDate.Sub(entryDate).Hours() / 24)
+}
+
+// calculateRoundTripMetrics fills the win/loss statistics of the ledger into metrics
+func calculateRoundTripMetrics(metrics *data.BacktestMetrics, roundTrips []data.RoundTrip) {
+	metrics.RoundTripCount = len(roundTrips)
+	if len(roundTrips) == 0 {
+		return
+	}
+
+	var wins, losses int
+	var grossProfit, grossLoss, totalPnL, totalReturn, totalDays float64
+	for _, roundTrip := range roundTrips {
+		totalPnL += roundTrip.PnL
+		totalReturn += roundTrip.Return
+		totalDays += float64(roundTrip.HoldingDays)
+		if roundTrip.PnL > 0 {
+			wins++
+			grossProfit += roundTrip.PnL
+		} else if roundTrip.PnL < 0 {
+			losses++
+			grossLoss += roundTrip.PnL
+		}
+	}
+
+	count := float64(len(roundTrips))
+	metrics.WinRate = float64(wins) / count * 100
+	metrics.AvgTradeReturn = totalReturn / count
+	metrics.Expectancy = totalPnL / count
+	metrics.AvgHoldingDays = totalDays / count
+	if wins > 0 {
+		metrics.AvgWin = grossProfit / float64(wins)
+	}
+	// Without a losing round trip the profit factor is unbounded. It stays 0, like the other
+	// undefined ratios, because JSON has no infinity.
+	if losses > 0 {
+		metrics.AvgLoss = grossLoss / float64(losses)
+		metrics.ProfitFactor = grossProfit / -grossLoss
+	}
+}
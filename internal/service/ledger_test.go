@@ -0,0 +1,123 @@
+package service
+
+import (
+	"math"
+	"testing"
+
+	"github.com/Paaaark/hanquant/internal/data"
+)
+
+func fill(date, symbol, side string, quantity int, price, commission, tax float64) data.Trade {
+	return data.Trade{
+		Date:       date,
+		Symbol:     symbol,
+		Side:       side,
+		Quantity:   quantity,
+		Price:      price,
+		Value:      float64(quantity) * price,
+		Commission: commission,
+		Tax:        tax,
+	}
+}
+
+func TestBuildRoundTrips(t *testing.T) {
+	trades := []data.Trade{
+		fill("2024-01-02", "A", "BUY", 10, 100, 10, 0),
+		fill("2024-01-03", "B", "BUY", 1, 50, 0, 0),
+		fill("2024-01-05", "A", "BUY", 10, 110, 20, 0),
+		// Spans both lots: 10 shares close the first lot and 5 take half the second
+		fill("2024-01-10", "A", "SELL", 15, 120, 15, 30),
+		// Nothing to match against
+		fill("2024-01-11", "C", "SELL", 3, 70, 1, 1),
+		fill("2024-01-12", "A", "SELL", 5, 90, 5, 0),
+	}
+
+	want := []data.RoundTrip{
+		{Symbol: "A", EntryDate: "2024-01-02", ExitDate: "2024-01-10", EntryPrice: 100, ExitPrice: 120, Quantity: 10, HoldingDays: 8, PnL: 160, Return: 160.0 / 1010 * 100},
+		{Symbol: "A", EntryDate: "2024-01-05", ExitDate: "2024-01-10", EntryPrice: 110, ExitPrice: 120, Quantity: 5, HoldingDays: 5, PnL: 25, Return: 25.0 / 560 * 100},
+		{Symbol: "A", EntryDate: "2024-01-05", ExitDate: "2024-01-12", EntryPrice: 110, ExitPrice: 90, Quantity: 5, HoldingDays: 7, PnL: -115, Return: -115.0 / 560 * 100},
+	}
+
+	got := buildRoundTrips(trades)
+	if len(got) != len(want) {
+		t.Fatalf("got %d round trips, want %d: %+v", len(got), len(want), got)
+	}
+	for i := range want {
+		g, w := got[i], want[i]
+		if g.Symbol != w.Symbol || g.EntryDate != w.EntryDate || g.ExitDate != w.ExitDate ||
+			g.EntryPrice != w.EntryPrice || g.ExitPrice != w.ExitPrice || g.Quantity != w.Quantity ||
+			g.HoldingDays != w.HoldingDays || math.Abs(g.PnL-w.PnL) > 1e-9 || math.Abs(g.Return-w.Return) > 1e-9 {
+			t.Errorf("round trip %d = %+v, want %+v", i, g, w)
+		}
+	}
+}
+
+func TestCalculateRoundTripMetrics(t *testing.T) {
+	tests := []struct {
+		name       string
+		roundTrips []data.RoundTrip
+		want       data.BacktestMetrics
+	}{
+		{
+			name: "wins and a loss",
+			roundTrips: []data.RoundTrip{
+				{PnL: 160, Return: 16, HoldingDays: 8},
+				{PnL: 25, Return: 4, HoldingDays: 5},
+				{PnL: -115, Return: -20, HoldingDays: 7},
+				{PnL: 0, Return: 0, HoldingDays: 4},
+			},
+			want: data.BacktestMetrics{
+				RoundTripCount: 4,
+				WinRate:        50,
+				AvgTradeReturn: 0,
+				Expectancy:     17.5,
+				AvgHoldingDays: 6,
+				AvgWin:         92.5,
+				AvgLoss:        -115,
+				ProfitFactor:   185.0 / 115,
+			},
+		},
+		{
+			// Without a losing round trip the profit factor stays 0
+			name: "no losses",
+			roundTrips: []data.RoundTrip{
+				{PnL: 100, Return: 10, HoldingDays: 3},
+				{PnL: 50, Return: 5, HoldingDays: 1},
+			},
+			want: data.BacktestMetrics{
+				RoundTripCount: 2,
+				WinRate:        100,
+				AvgTradeReturn: 7.5,
+				Expectancy:     75,
+				AvgHoldingDays: 2,
+				AvgWin:         75,
+			},
+		},
+		{
+			name: "no round trips",
+			want: data.BacktestMetrics{},
+		},
+	}
+	for _, tt := range tests {
+		var got data.BacktestMetrics
+		calculateRoundTripMetrics(&got, tt.roundTrips)
+		fields := []struct {
+			name      string
+			got, want float64
+		}{
+			{"RoundTripCount", float64(got.RoundTripCount), float64(tt.want.RoundTripCount)},
+			{"WinRate", got.WinRate, tt.want.WinRate},
+			{"AvgTradeReturn", got.AvgTradeReturn, tt.want.AvgTradeReturn},
+			{"Expectancy", got.Expectancy, tt.want.Expectancy},
+			{"AvgHoldingDays", got.AvgHoldingDays, tt.want.AvgHoldingDays},
+			{"AvgWin", got.AvgWin, tt.want.AvgWin},
+			{"AvgLoss", got.AvgLoss, tt.want.AvgLoss},
+			{"ProfitFactor", got.ProfitFactor, tt.want.ProfitFactor},
+		}
+		for _, field := range fields {
+			if math.Abs(field.got-field.want) > 1e-9 {
+				t.Errorf("%s: %s = %v, want %v", tt.name, field.name, field.got, field.want)
+			}
+		}
+	}
+}
@@ -0,0 +1,287 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"runtime"
+	"sort"
+	"sync"
+
+	"github.com/Paaaark/hanquant/internal/data"
+)
+
+const (
+	maxOptimizeRuns    = 2000
+	maxOptimizeWorkers = 16
+)
+
+// rankMetrics maps the rank_by names to a metric and whether lower values rank higher
+var rankMetrics = map[string]struct {
+	value       func(m data.BacktestMetrics) float64
+	lowerBetter bool
+}{
+	"sharpe":        {func(m data.BacktestMetrics) float64 { return m.SharpeRatio }, false},
+	"cagr":          {func(m data.BacktestMetrics) float64 { return m.Risk.CAGR }, false},
+	"total_return":  {func(m data.BacktestMetrics) float64 { return m.TotalReturn }, false},
+	"sortino":       {func(m data.BacktestMetrics) float64 { return m.Risk.SortinoRatio }, false},
+	"calmar":        {func(m data.BacktestMetrics) float64 { return m.Risk.CalmarRatio }, false},
+	"max_drawdown":  {func(m data.BacktestMetrics) float64 { return m.MaxDrawdown }, true},
+	"win_rate":      {func(m data.BacktestMetrics) float64 { return m.WinRate }, false},
+	"profit_factor": {func(m data.BacktestMetrics) float64 { return m.ProfitFactor }, false},
+}
+
+// Optimize runs the strategy for every combination of the parameter grid over history that
+// is loaded once, and ranks the runs by the chosen metric
+func (s *BacktestService) Optimize(params data.OptimizeParams) (*data.OptimizeResult, error) {
+	search, err := newGridSearch(&params)
+	if err != nil {
+		return nil, err
+	}
+
+	prepared, err := s.prepareBacktest(context.Background(), params.BacktestParams, nil)
+	if err != nil {
+		return nil, err
+	}
+	params.BacktestParams = prepared.params
+
+	runs := search.run(s, prepared)
+
+	result := &data.OptimizeResult{
+		Params:   params,
+		Universe: prepared.universe,
+		RankBy:   params.RankBy,
+	}
+	if len(search.axes) == 2 {
+		result.Heatmap = buildHeatmap(search.axes, runs)
+	}
+	result.Runs = rankRuns(runs, search.lowerBetter)
+	return result, nil
+}
+
+// gridSearch is a validated parameter grid ready to be run over prepared data
+type gridSearch struct {
+	strategy     string
+	axes         []gridAxis
+	combinations []map[string]float64
+	score        func(m data.BacktestMetrics) float64
+	lowerBetter  bool
+	workers      int
+}
+
+// newGridSearch applies the optimize defaults to params and expands its grid
+func newGridSearch(params *data.OptimizeParams) (*gridSearch, error) {
+	// A rule set has no parameters to sweep, and running the default strategy in its place
+	// would report another strategy's results as the rules'
+	if params.Rules != "" || params.Strategy == RulesStrategyName {
+		return nil, fmt.Errorf("rules cannot be optimized")
+	}
+	if params.Strategy == "" {
+		params.Strategy = "sma_crossover"
+	}
+	if _, exists := strategyRegistry[params.Strategy]; !exists {
+		return nil, fmt.Errorf("unknown strategy: %q", params.Strategy)
+	}
+	if params.RankBy == "" {
+		params.RankBy = "sharpe"
+	}
+	rank, exists := rankMetrics[params.RankBy]
+	if !exists {
+		return nil, fmt.Errorf("unknown rank_by metric: %q", params.RankBy)
+	}
+	if params.Workers <= 0 {
+		params.Workers = runtime.NumCPU()
+	}
+	if params.Workers > maxOptimizeWorkers {
+		params.Workers = maxOptimizeWorkers
+	}
+
+	axes, err := expandGrid(params.Grid)
+	if err != nil {
+		return nil, err
+	}
+	return &gridSearch{
+		strategy:     params.Strategy,
+		axes:         axes,
+		combinations: gridCombinations(axes),
+		score:        rank.value,
+		lowerBetter:  rank.lowerBetter,
+		workers:      params.Workers,
+	}, nil
+}
+
+// run simulates every combination over prepared and scores the successful runs. Runs are in grid order.
+func (g *gridSearch) run(s *BacktestService, prepared *preparedBacktest) []data.OptimizeRun {
+	runs := s.runGrid(prepared, g.strategy, g.combinations, g.workers)
+	for i := range runs {
+		if runs[i].Error == "" {
+			runs[i].Score = g.score(runs[i].Metrics)
+		}
+	}
+	return runs
+}
+
+// runGrid simulates every combination on a pool of workers. Runs are returned in grid order.
+func (s *BacktestService) runGrid(prepared *preparedBacktest, strategyName string, combinations []map[string]float64, workers int) []data.OptimizeRun {
+	runs := make([]data.OptimizeRun, len(combinations))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				runs[i] = s.optimizeRun(prepared, strategyName, combinations[i])
+			}
+		}()
+	}
+	for i := range combinations {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	return runs
+}
+
+// optimizeRun simulates a single grid combination on top of the base strategy parameters
+func (s *BacktestService) optimizeRun(prepared *preparedBacktest, strategyName string, combination map[string]float64) data.OptimizeRun {
+	strategyParams := make(map[string]float64, len(prepared.params.StrategyParams)+len(combination))
+	for name, value := range prepared.params.StrategyParams {
+		strategyParams[name] = value
+	}
+	for name, value := range combination {
+		strategyParams[name] = value
+	}
+	run := data.OptimizeRun{StrategyParams: strategyParams}
+
+	strategy, resolved, err := NewStrategy(strategyName, strategyParams)
+	if err != nil {
+		run.Error = err.Error()
+		return run
+	}
+	run.StrategyParams = resolved
+
+	params := prepared.params
+	params.StrategyParams = resolved
+	result, err := s.simulate(prepared, params, strategy)
+	if err != nil {
+		run.Error = err.Error()
+		return run
+	}
+
+	run.Metrics = result.Metrics
+	run.Metrics.Risk.MonthlyReturns = nil
+	run.Metrics.Risk.YearlyReturns = nil
+	return run
+}
+
+// gridAxis is one swept parameter with its expanded values
+type gridAxis struct {
+	name   string
+	values []float64
+}
+
+// expandGrid validates the ranges and expands min..max by step into explicit values
+func expandGrid(grid []data.ParamRange) ([]gridAxis, error) {
+	if len(grid) == 0 {
+		return nil, fmt.Errorf("grid must contain at least one parameter")
+	}
+
+	axes := make([]gridAxis, 0, len(grid))
+	seen := make(map[string]bool, len(grid))
+	total := 1
+	for _, r := range grid {
+		if r.Name == "" {
+			return nil, fmt.Errorf("grid parameter name is required")
+		}
+		if seen[r.Name] {
+			return nil, fmt.Errorf("grid parameter %q is listed twice", r.Name)
+		}
+		seen[r.Name] = true
+
+		values := r.Values
+		if len(values) == 0 {
+			if r.Step <= 0 || r.Max < r.Min {
+				return nil, fmt.Errorf("grid parameter %q needs values or min <= max with a positive step", r.Name)
+			}
+			steps := int(math.Floor((r.Max-r.Min)/r.Step + 1e-9))
+			if steps >= maxOptimizeRuns {
+				return nil, fmt.Errorf("grid parameter %q has more than %d values", r.Name, maxOptimizeRuns)
+			}
+			for i := 0; i <= steps; i++ {
+				// Round away float drift so 0.1 steps print as 0.3, not 0.30000000000000004
+				values = append(values, math.Round((r.Min+float64(i)*r.Step)*1e9)/1e9)
+			}
+		}
+
+		total *= len(values)
+		if total > maxOptimizeRuns {
+			return nil, fmt.Errorf("grid has more than %d combinations", maxOptimizeRuns)
+		}
+		axes = append(axes, gridAxis{name: r.Name, values: values})
+	}
+	return axes, nil
+}
+
+// gridCombinations returns the cartesian product of the axes, the last axis varying fastest
+func gridCombinations(axes []gridAxis) []map[string]float64 {
+	combinations := []map[string]float64{{}}
+	for _, axis := range axes {
+		next := make([]map[string]float64, 0, len(combinations)*len(axis.values))
+		for _, base := range combinations {
+			for _, value := range axis.values {
+				combination := make(map[string]float64, len(base)+1)
+				for name, v := range base {
+					combination[name] = v
+				}
+				combination[axis.name] = value
+				next = append(next, combination)
+			}
+		}
+		combinations = next
+	}
+	return combinations
+}
+
+// buildHeatmap lays out a two-parameter sweep with the first axis as rows (Y) and the second as columns (X).
+// runs must still be in grid order.
+func buildHeatmap(axes []gridAxis, runs []data.OptimizeRun) *data.Heatmap {
+	heatmap := &data.Heatmap{
+		XParam: axes[1].name,
+		YParam: axes[0].name,
+		X:      axes[1].values,
+		Y:      axes[0].values,
+		Values: make([][]*float64, len(axes[0].values)),
+	}
+	for y := range axes[0].values {
+		heatmap.Values[y] = make([]*float64, len(axes[1].values))
+		for x := range axes[1].values {
+			run := runs[y*len(axes[1].values)+x]
+			if run.Error == "" {
+				score := run.Score
+				heatmap.Values[y][x] = &score
+			}
+		}
+	}
+	return heatmap
+}
+
+// rankRuns sorts successful runs by score and numbers them, keeping failed runs at the end
+func rankRuns(runs []data.OptimizeRun, lowerBetter bool) []data.OptimizeRun {
+	ranked := append([]data.OptimizeRun(nil), runs...)
+	sort.SliceStable(ranked, func(i, j int) bool {
+		if (ranked[i].Error == "") != (ranked[j].Error == "") {
+			return ranked[i].Error == ""
+		}
+		if lowerBetter {
+			return ranked[i].Score < ranked[j].Score
+		}
+		return ranked[i].Score > ranked[j].Score
+	})
+	for i := range ranked {
+		if ranked[i].Error == "" {
+			ranked[i].Rank = i + 1
+		}
+	}
+	return ranked
+}
@@ -0,0 +1,40 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/Paaaark/hanquant/internal/data"
+)
+
+func TestNewGridSearchStrategy(t *testing.T) {
+	grid := []data.ParamRange{{Name: "short_window", Values: []float64{5, 10}}}
+	tests := []struct {
+		name    string
+		params  data.BacktestParams
+		want    string
+		wantErr bool
+	}{
+		{name: "default strategy", want: "sma_crossover"},
+		{name: "named strategy", params: data.BacktestParams{Strategy: "sma_crossover"}, want: "sma_crossover"},
+		{name: "rules", params: data.BacktestParams{Rules: "entry: rsi(14) < 30"}, wantErr: true},
+		{name: "rules by name", params: data.BacktestParams{Strategy: RulesStrategyName}, wantErr: true},
+		{name: "unknown strategy", params: data.BacktestParams{Strategy: "momentum_magic"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		params := data.OptimizeParams{BacktestParams: tt.params, Grid: grid}
+		search, err := newGridSearch(&params)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%s: ran %q, want an error", tt.name, search.strategy)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if search.strategy != tt.want || params.Strategy != tt.want {
+			t.Errorf("%s: strategy %q, want %q", tt.name, search.strategy, tt.want)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Paaaark/hanquant/internal/data"
+)
+
+// RunPaper trades the strategy of params on live daily bars with the simulated broker until ctx
+// is cancelled, then returns the result like a backtest that ended on the last live day. The
+// run starts flat on the first trading day after today's stored history; From only sets how much
+// history the strategy warms up on and defaults to a year ago. onSession, if set, sees the
+// portfolio after every live session. retry is the wait between attempts to read a session.
+func (s *BacktestService) RunPaper(ctx context.Context, params data.BacktestParams, retry time.Duration, onSession SessionFunc) (*data.BacktestResult, error) {
+	if params.Strategy == "" && params.Rules == "" {
+		return nil, fmt.Errorf("strategy or rules is required")
+	}
+	if params.Interval > 0 {
+		return nil, fmt.Errorf("paper trading runs on daily bars")
+	}
+	if params.Source != "" && params.Source != "store" {
+		return nil, fmt.Errorf("paper trading continues the stored history, source must be store")
+	}
+	if params.Benchmark != "" {
+		return nil, fmt.Errorf("paper trading does not compare against a benchmark")
+	}
+
+	strategy, resolved, err := newRunStrategy(params.Strategy, params.StrategyParams, params.Rules)
+	if err != nil {
+		return nil, err
+	}
+	params.Strategy = strategy.Name()
+	params.StrategyParams = resolved
+
+	now := time.Now().In(time.FixedZone("KST", 9*60*60))
+	if params.From == "" {
+		params.From = now.AddDate(-1, 0, 0).Format("20060102")
+	}
+	params.To = now.Format("20060102")
+
+	prepared, err := s.prepareBacktest(ctx, params, nil)
+	if err != nil {
+		return nil, err
+	}
+	prepared.onSession = onSession
+	// Cancelling ctx ends the live feed, and with it the run, instead of failing it
+	prepared.ctx = context.Background()
+
+	var feed Feed = NewLiveFeed(s.stockService, prepared.universe, prepared.stockData, retry, ctx.Done())
+	if prepared.params.Rebalance.Frequency != "" {
+		feed = newRebalancingFeed(feed, prepared.params.Rebalance)
+	}
+
+	result, err := s.simulateFeed(prepared, prepared.params, strategy, feed)
+	if err != nil {
+		return nil, err
+	}
+	compactResult(result)
+	return result, nil
+}
@@ -0,0 +1,97 @@
+package service
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Paaaark/hanquant/internal/data"
+	"github.com/Paaaark/hanquant/internal/metrics"
+)
+
+// GetPortfolioRisk replays the account's current holdings over past daily closes and computes
+// the risk metrics of the resulting equity curve. Cash is held constant at today's deposit.
+func (s *StockService) GetPortfolioRisk(kis *data.KISClient, accNo string, mock bool, from, to string, riskFreeRate float64) (*data.PortfolioRisk, error) {
+	if to == "" {
+		to = time.Now().Format("20060102")
+	}
+	if from == "" {
+		toDate, err := time.Parse("20060102", to)
+		if err != nil {
+			return nil, fmt.Errorf("invalid to date: %w", err)
+		}
+		from = toDate.AddDate(-1, 0, 0).Format("20060102")
+	}
+
+	positions, summary, err := s.GetAccountPortfolio(kis, accNo, mock)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &data.PortfolioRisk{
+		AccountID: accNo,
+		From:      from,
+		To:        to,
+		Holdings:  make(map[string]int),
+	}
+	if summary != nil {
+		report.Cash, _ = strconv.ParseFloat(strings.TrimSpace(summary.TotalDeposit), 64)
+	}
+	for _, position := range positions {
+		quantity, err := strconv.Atoi(strings.TrimSpace(position.HoldingQty))
+		if err != nil || quantity <= 0 {
+			continue
+		}
+		report.Holdings[position.Symbol] += quantity
+	}
+
+	// Closes per symbol keyed by YYYYMMDD, and every date any holding traded
+	closes := make(map[string]map[string]float64, len(report.Holdings))
+	dateSet := make(map[string]bool)
+	for symbol := range report.Holdings {
+		// Adjusted, so a split is not mistaken for a loss
+		raw, err := s.GetHistoricalPrice(symbol, from, to, "D", true)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch data for %s: %w", symbol, err)
+		}
+		prices, _ := raw.(data.SlicePriceStruct)
+		closes[symbol] = make(map[string]float64, len(prices))
+		for _, price := range prices {
+			value, err := strconv.ParseFloat(price.Close, 64)
+			if err != nil || value <= 0 {
+				continue
+			}
+			closes[symbol][price.Date] = value
+			dateSet[price.Date] = true
+		}
+	}
+
+	dates := make([]string, 0, len(dateSet))
+	for date := range dateSet {
+		dates = append(dates, date)
+	}
+	sort.Strings(dates)
+
+	// Value the holdings each day, carrying a symbol's last close over days it did not trade
+	lastClose := make(map[string]float64, len(report.Holdings))
+	curve := make([]metrics.Point, 0, len(dates))
+	for _, day := range dates {
+		date, err := time.Parse("20060102", day)
+		if err != nil {
+			continue
+		}
+		total := report.Cash
+		for symbol, quantity := range report.Holdings {
+			if value, ok := closes[symbol][day]; ok {
+				lastClose[symbol] = value
+			}
+			total += float64(quantity) * lastClose[symbol]
+		}
+		curve = append(curve, metrics.Point{Date: date, Value: total})
+	}
+
+	report.Risk = metrics.Compute(curve, metrics.Options{RiskFreeRate: riskFreeRate})
+	return report, nil
+}
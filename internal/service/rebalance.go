@@ -0,0 +1,211 @@
+package service
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/Paaaark/hanquant/internal/data"
+)
+
+// minRebalanceTrade is the smallest adjustment, as a fraction of portfolio value, worth trading.
+// Smaller drifts are left alone so every rebalance does not pay costs on dust.
+const minRebalanceTrade = 0.001
+
+// WeightStrategy allocates the whole universe by target weights instead of emitting orders.
+// On every rebalance day the engine asks for weights and trades the difference between them
+// and the current holdings, selling before buying.
+type WeightStrategy interface {
+	// Name returns the registry name of the strategy (e.g. "equal_weight")
+	Name() string
+	// Init receives the complete history for every symbol before the run starts
+	Init(history map[string][]data.StockData) error
+	// Weights returns the target fraction of portfolio value per symbol, using bars up to and
+	// including day. Symbols left out are sold and whatever does not add up to 1 stays in cash.
+	Weights(day data.MarketDay) map[string]float64
+}
+
+// WeightStrategyFactory builds a target-weight strategy from already validated parameters
+type WeightStrategyFactory func(params map[string]float64) (WeightStrategy, error)
+
+// RegisterWeightStrategy makes a target-weight strategy available to RunBacktest under info.Name.
+func RegisterWeightStrategy(info data.StrategyInfo, factory WeightStrategyFactory) {
+	info.Rebalances = true
+	RegisterStrategy(info, func(params map[string]float64) (Strategy, error) {
+		strategy, err := factory(params)
+		if err != nil {
+			return nil, err
+		}
+		return &rebalancer{strategy: strategy}, nil
+	})
+}
+
+// rebalancer drives a WeightStrategy through the order-based engine
+type rebalancer struct {
+	strategy WeightStrategy
+}
+
+func (r *rebalancer) Name() string {
+	return r.strategy.Name()
+}
+
+func (r *rebalancer) Init(history map[string][]data.StockData) error {
+	return r.strategy.Init(history)
+}
+
+// OnDay turns the weight deltas of a rebalance day into market orders for explicit quantities.
+// Targets are priced at the day's close; the broker fills them at the next bar with costs and
+// shrinks the last buys if the fills leave too little cash.
+func (r *rebalancer) OnDay(day data.MarketDay, portfolio *data.Portfolio) []data.StrategyOrder {
+	if !day.Rebalance || portfolio.Total <= 0 {
+		return nil
+	}
+	weights := normalizeWeights(r.strategy.Weights(day))
+
+	var sells, buys []data.StrategyOrder
+	for _, bar := range day.Bars {
+		if bar.Close <= 0 {
+			continue
+		}
+		held := portfolio.Positions[bar.Symbol]
+		target := int(weights[bar.Symbol] * portfolio.Total / bar.Close)
+		delta := target - held
+		if delta == 0 {
+			continue
+		}
+		// Always close positions that dropped out; only skip small adjustments of kept ones
+		if target > 0 && math.Abs(float64(delta))*bar.Close < minRebalanceTrade*portfolio.Total {
+			continue
+		}
+		if delta < 0 {
+			sells = append(sells, data.StrategyOrder{Symbol: bar.Symbol, Side: "SELL", Quantity: -delta})
+		} else {
+			buys = append(buys, data.StrategyOrder{Symbol: bar.Symbol, Side: "BUY", Quantity: delta})
+		}
+	}
+	return append(sells, buys...)
+}
+
+// normalizeWeights drops negative and invalid weights and scales the rest down if they add up to more than 1
+func normalizeWeights(weights map[string]float64) map[string]float64 {
+	total := 0.0
+	for symbol, weight := range weights {
+		if weight <= 0 || math.IsNaN(weight) || math.IsInf(weight, 0) {
+			delete(weights, symbol)
+			continue
+		}
+		total += weight
+	}
+	if total > 1 {
+		for symbol := range weights {
+			weights[symbol] /= total
+		}
+	}
+	return weights
+}
+
+// applyRebalanceDefaults gives target-weight strategies a monthly schedule when none is set
+func applyRebalanceDefaults(params *data.BacktestParams) {
+	entry, exists := strategyRegistry[params.Strategy]
+	if exists && entry.info.Rebalances && params.Rebalance.Frequency == "" {
+		params.Rebalance.Frequency = "monthly"
+	}
+}
+
+// validateRebalance checks the rebalance schedule
+func validateRebalance(schedule data.RebalanceSchedule) error {
+	switch schedule.Frequency {
+	case "", "monthly", "quarterly":
+		if schedule.Days != 0 {
+			return fmt.Errorf("rebalance days is only used with frequency \"days\"")
+		}
+	case "days":
+		if schedule.Days < 1 {
+			return fmt.Errorf("rebalance days must be at least 1")
+		}
+	default:
+		return fmt.Errorf("unknown rebalance frequency %q", schedule.Frequency)
+	}
+	return nil
+}
+
+// markRebalanceDays flags the first step of every scheduled session in days. Sessions are counted
+// on the trading calendar from the first day of the backtest, which always rebalances.
+func markRebalanceDays(days []data.MarketDay, schedule data.RebalanceSchedule) error {
+	if schedule.Frequency == "" {
+		return nil
+	}
+	marker := &rebalanceMarker{schedule: schedule}
+	return marker.mark(days)
+}
+
+// rebalanceMarker flags rebalance sessions like markRebalanceDays, across calls that each pass
+// the steps that followed the previous call, as a feed does
+type rebalanceMarker struct {
+	schedule data.RebalanceSchedule
+	start    string // first session, where the calendar walk begins
+	session  string // last session marked
+	walked   string // last trading day of the calendar walked so far
+	count    int    // trading days walked so far
+	period   string // rebalance period of the last scheduled trading day
+}
+
+// mark flags the first step of every scheduled session in days, which follow the ones of earlier calls
+func (m *rebalanceMarker) mark(days []data.MarketDay) error {
+	for i := range days {
+		date := days[i].Date.Format("20060102")
+		if date == m.session {
+			continue
+		}
+		if m.start == "" {
+			m.start = date
+		}
+		scheduled, err := m.advance(date)
+		if err != nil {
+			return err
+		}
+		days[i].Rebalance = m.session == "" || scheduled
+		m.session = date
+	}
+	return nil
+}
+
+// advance walks the trading calendar up to date and reports whether date is scheduled
+func (m *rebalanceMarker) advance(date string) (bool, error) {
+	from := m.walked
+	if from == "" {
+		from = m.start
+	}
+	calendar, err := data.TradingDaysInRange(from, date)
+	if err != nil {
+		return false, err
+	}
+
+	scheduled := false
+	for _, day := range calendar {
+		if day <= m.walked {
+			continue
+		}
+		due := false
+		switch m.schedule.Frequency {
+		case "monthly":
+			// YYYYMM changes on the first trading day of a month
+			if period := day[:6]; period != m.period {
+				due = true
+				m.period = period
+			}
+		case "quarterly":
+			month, _ := strconv.Atoi(day[4:6])
+			if period := fmt.Sprintf("%s-Q%d", day[:4], (month+2)/3); period != m.period {
+				due = true
+				m.period = period
+			}
+		case "days":
+			due = m.count%m.schedule.Days == 0
+		}
+		m.walked = day
+		m.count++
+		scheduled = due && day == date
+	}
+	return scheduled, nil
+}
@@ -0,0 +1,78 @@
+package service
+
+import (
+	"context"
+	"io"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/Paaaark/hanquant/internal/data"
+)
+
+// intradaySteps returns a morning and a closing step for every trading day from..to
+func intradaySteps(t *testing.T, from, to string) []data.MarketDay {
+	t.Helper()
+	calendar, err := data.TradingDaysInRange(from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var steps []data.MarketDay
+	for _, day := range calendar {
+		session, _ := time.Parse("20060102", day)
+		steps = append(steps,
+			data.MarketDay{Date: session.Add(9 * time.Hour)},
+			data.MarketDay{Date: session.Add(15*time.Hour + 30*time.Minute), SessionEnd: true})
+	}
+	return steps
+}
+
+func rebalanceDates(steps []data.MarketDay) []string {
+	var dates []string
+	for _, step := range steps {
+		if step.Rebalance {
+			dates = append(dates, step.Date.Format("20060102 15:04"))
+		}
+	}
+	return dates
+}
+
+func TestRebalancingFeedMatchesSchedule(t *testing.T) {
+	t.Setenv("TRADING_DAYS_CSV", "../../weekdays.csv")
+
+	tests := []struct {
+		schedule data.RebalanceSchedule
+		want     []string
+	}{
+		// October 1st is a holiday, so October rebalances on the 2nd
+		{data.RebalanceSchedule{Frequency: "monthly"}, []string{"20240826 09:00", "20240902 09:00", "20241002 09:00", "20241101 09:00"}},
+		{data.RebalanceSchedule{Frequency: "quarterly"}, []string{"20240826 09:00", "20241002 09:00"}},
+		// Counted on the calendar, which skips Chuseok (September 16th to 18th) and October 1st, 3rd and 9th
+		{data.RebalanceSchedule{Frequency: "days", Days: 10}, []string{"20240826 09:00", "20240909 09:00", "20240926 09:00", "20241015 09:00", "20241029 09:00"}},
+	}
+	for _, tt := range tests {
+		batch := intradaySteps(t, "20240826", "20241108")
+		if err := markRebalanceDays(batch, tt.schedule); err != nil {
+			t.Fatalf("%+v: markRebalanceDays: %v", tt.schedule, err)
+		}
+		if got := rebalanceDates(batch); !slices.Equal(got, tt.want) {
+			t.Errorf("%+v: markRebalanceDays = %v, want %v", tt.schedule, got, tt.want)
+		}
+
+		feed := newRebalancingFeed(newReplayFeed(intradaySteps(t, "20240826", "20241108")), tt.schedule)
+		var streamed []data.MarketDay
+		for {
+			step, err := feed.Next(context.Background())
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("%+v: Next: %v", tt.schedule, err)
+			}
+			streamed = append(streamed, step)
+		}
+		if got := rebalanceDates(streamed); !slices.Equal(got, tt.want) {
+			t.Errorf("%+v: rebalancingFeed = %v, want %v", tt.schedule, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,228 @@
+package service
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+
+	"github.com/Paaaark/hanquant/internal/data"
+	"github.com/Paaaark/hanquant/internal/metrics"
+)
+
+const (
+	defaultRobustnessSimulations = 1000
+	maxRobustnessSimulations     = 10000
+)
+
+// applyRobustnessDefaults fills in the method, simulation count and block size
+func applyRobustnessDefaults(params *data.RobustnessParams) {
+	if params.Method == "" {
+		params.Method = "bootstrap"
+	}
+	if params.Simulations == 0 {
+		params.Simulations = defaultRobustnessSimulations
+	}
+	if params.Method == "bootstrap" && params.BlockSize == 0 {
+		params.BlockSize = 1
+	}
+}
+
+// validateRobustness checks params after defaults have been applied
+func validateRobustness(params data.RobustnessParams) error {
+	if params.Method != "bootstrap" && params.Method != "trade_shuffle" {
+		return fmt.Errorf("unknown robustness method %q", params.Method)
+	}
+	if params.Simulations < 1 || params.Simulations > maxRobustnessSimulations {
+		return fmt.Errorf("simulations must be between 1 and %d", maxRobustnessSimulations)
+	}
+	if params.BlockSize < 0 || (params.Method == "trade_shuffle" && params.BlockSize != 0) {
+		return fmt.Errorf("block_size must be a positive number of days and is only used by bootstrap")
+	}
+	return nil
+}
+
+// robustnessPath is the statistics of one simulated path
+type robustnessPath struct {
+	finalReturn float64
+	maxDrawdown float64
+	sharpe      float64
+}
+
+// AnalyzeRobustness runs a Monte Carlo analysis of a finished backtest given its equity curve and trades.
+//
+// bootstrap draws daily returns of the equity curve with replacement, in blocks of BlockSize days
+// to keep some autocorrelation, and compounds them into new curves of the same length.
+// trade_shuffle replays the net P&L of the round trips in random order from the initial cash. The
+// final return is then the same on every path; what changes is the drawdown along the way.
+// Positions still open at the end are not round trips and are left out.
+func AnalyzeRobustness(params data.RobustnessParams, history []data.PortfolioSnapshot, trades []data.Trade, initialCash, riskFreeRate float64) (*data.RobustnessResult, error) {
+	applyRobustnessDefaults(&params)
+	if err := validateRobustness(params); err != nil {
+		return nil, err
+	}
+	rng := rand.New(rand.NewSource(params.Seed))
+
+	var observed robustnessPath
+	var samples int
+	var simulate func() robustnessPath
+
+	switch params.Method {
+	case "bootstrap":
+		returns := metrics.Returns(metrics.FromSnapshots(history))
+		if len(returns) < 2 {
+			return nil, fmt.Errorf("bootstrap needs at least 3 days of equity curve")
+		}
+		if params.BlockSize > len(returns) {
+			return nil, fmt.Errorf("block_size is longer than the %d daily returns", len(returns))
+		}
+		samples = len(returns)
+		observed = returnsPath(returns, riskFreeRate)
+
+		sample := make([]float64, len(returns))
+		simulate = func() robustnessPath {
+			// Circular block bootstrap: blocks start anywhere and wrap around the end
+			for i := 0; i < len(sample); {
+				start := rng.Intn(len(returns))
+				for j := 0; j < params.BlockSize && i < len(sample); j++ {
+					sample[i] = returns[(start+j)%len(returns)]
+					i++
+				}
+			}
+			return returnsPath(sample, riskFreeRate)
+		}
+
+	case "trade_shuffle":
+		roundTrips := buildRoundTrips(trades)
+		if len(roundTrips) < 2 {
+			return nil, fmt.Errorf("trade_shuffle needs at least 2 round trips")
+		}
+		if initialCash <= 0 {
+			initialCash = defaultInitialCash
+		}
+		pnls := make([]float64, len(roundTrips))
+		for i, roundTrip := range roundTrips {
+			pnls[i] = roundTrip.PnL
+		}
+		tradesPerYear := tradeFrequency(history, len(pnls))
+		samples = len(pnls)
+		observed = tradePath(pnls, initialCash, tradesPerYear)
+
+		shuffled := make([]float64, len(pnls))
+		simulate = func() robustnessPath {
+			for i, j := range rng.Perm(len(pnls)) {
+				shuffled[i] = pnls[j]
+			}
+			return tradePath(shuffled, initialCash, tradesPerYear)
+		}
+	}
+
+	paths := make([]robustnessPath, params.Simulations)
+	losses := 0
+	for i := range paths {
+		paths[i] = simulate()
+		if paths[i].finalReturn < 0 {
+			losses++
+		}
+	}
+
+	return &data.RobustnessResult{
+		Params:            params,
+		Samples:           samples,
+		FinalReturn:       distribution(paths, observed, func(p robustnessPath) float64 { return p.finalReturn }),
+		MaxDrawdown:       distribution(paths, observed, func(p robustnessPath) float64 { return p.maxDrawdown }),
+		Sharpe:            distribution(paths, observed, func(p robustnessPath) float64 { return p.sharpe }),
+		ProbabilityOfLoss: float64(losses) / float64(len(paths)),
+	}, nil
+}
+
+// returnsPath compounds daily returns into a curve starting at 1
+func returnsPath(returns []float64, riskFreeRate float64) robustnessPath {
+	value, peak, drawdown := 1.0, 1.0, 0.0
+	for _, r := range returns {
+		value *= 1 + r
+		peak = math.Max(peak, value)
+		drawdown = math.Max(drawdown, 1-value/peak)
+	}
+	return robustnessPath{
+		finalReturn: (value - 1) * 100,
+		maxDrawdown: drawdown * 100,
+		sharpe:      metrics.Sharpe(returns, riskFreeRate),
+	}
+}
+
+// tradePath adds round-trip P&L to the initial cash one trade at a time. Its Sharpe ratio is
+// taken over per-trade returns, annualized by the trade frequency, without a risk-free rate.
+func tradePath(pnls []float64, initialCash, tradesPerYear float64) robustnessPath {
+	value, peak, drawdown := initialCash, initialCash, 0.0
+	returns := make([]float64, 0, len(pnls))
+	for _, pnl := range pnls {
+		if value > 0 {
+			returns = append(returns, pnl/value)
+		}
+		value += pnl
+		peak = math.Max(peak, value)
+		drawdown = math.Max(drawdown, 1-value/peak)
+	}
+
+	sharpe := 0.0
+	mean := metrics.Mean(returns)
+	if stdDev := metrics.StdDev(returns, mean); stdDev > 0 {
+		sharpe = mean / stdDev * math.Sqrt(tradesPerYear)
+	}
+	return robustnessPath{
+		finalReturn: (value/initialCash - 1) * 100,
+		maxDrawdown: math.Min(drawdown, 1) * 100,
+		sharpe:      sharpe,
+	}
+}
+
+// tradeFrequency returns how many round trips a year the backtest made
+func tradeFrequency(history []data.PortfolioSnapshot, count int) float64 {
+	curve := metrics.FromSnapshots(history)
+	if len(curve) < 2 {
+		return float64(count)
+	}
+	years := curve[len(curve)-1].Date.Sub(curve[0].Date).Hours() / 24 / 365.25
+	if years <= 0 {
+		return float64(count)
+	}
+	return float64(count) / years
+}
+
+// distribution summarizes one statistic of paths with percentiles by linear interpolation.
+// Paths within float rounding of the observed value count as ties, not as below it.
+func distribution(paths []robustnessPath, observed robustnessPath, stat func(robustnessPath) float64) data.Distribution {
+	values := make([]float64, len(paths))
+	for i, path := range paths {
+		values[i] = stat(path)
+	}
+	sort.Float64s(values)
+
+	value := stat(observed)
+	below := sort.SearchFloat64s(values, value-1e-9*math.Max(1, math.Abs(value)))
+	mean := metrics.Mean(values)
+	return data.Distribution{
+		Observed:     value,
+		ObservedRank: float64(below) / float64(len(values)),
+		Mean:         mean,
+		StdDev:       metrics.StdDev(values, mean),
+		Min:          values[0],
+		P5:           percentile(values, 0.05),
+		P25:          percentile(values, 0.25),
+		P50:          percentile(values, 0.5),
+		P75:          percentile(values, 0.75),
+		P95:          percentile(values, 0.95),
+		Max:          values[len(values)-1],
+	}
+}
+
+// percentile returns the p-quantile of sorted values
+func percentile(sorted []float64, p float64) float64 {
+	position := p * float64(len(sorted)-1)
+	lower := int(math.Floor(position))
+	if lower+1 >= len(sorted) {
+		return sorted[len(sorted)-1]
+	}
+	return sorted[lower] + (position-float64(lower))*(sorted[lower+1]-sorted[lower])
+}
@@ -0,0 +1,137 @@
+package service
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Paaaark/hanquant/internal/data"
+)
+
+// defaultSettlementDays is the KRX equity settlement cycle, D+2
+const defaultSettlementDays = 2
+
+// applySettlementDefaults fills in the settlement settings that were not set explicitly
+func applySettlementDefaults(model *data.SettlementModel) {
+	if model.Days == nil {
+		v := defaultSettlementDays
+		model.Days = &v
+	}
+	if model.BuyingPower == "" {
+		model.BuyingPower = "d2"
+	}
+}
+
+// validateSettlement rejects out-of-range settlement settings
+func validateSettlement(model data.SettlementModel) error {
+	if model.Days != nil && (*model.Days < 0 || *model.Days > 5) {
+		return fmt.Errorf("settlement days must be between 0 and 5")
+	}
+	switch model.BuyingPower {
+	case "", "d2", "settled":
+	default:
+		return fmt.Errorf("unknown buying_power %q: use d2 or settled", model.BuyingPower)
+	}
+	if model.InterestRate < 0 || model.InterestRate > 0.2 {
+		return fmt.Errorf("interest_rate must be an annual fraction between 0 and 0.2")
+	}
+	if model.MarginRatio < 0 || model.MarginRatio > 1 {
+		return fmt.Errorf("margin_ratio must be between 0 and 1")
+	}
+	if model.MarginRate < 0 || model.MarginRate > 0.3 {
+		return fmt.Errorf("margin_rate must be an annual fraction between 0 and 0.3")
+	}
+	return nil
+}
+
+// pendingSettlement is cash a trade moves once it settles: negative for buys, positive for sells
+type pendingSettlement struct {
+	date   string // YYYYMMDD the trade settles on
+	amount float64
+}
+
+// settlementLedger follows the trades of a run to settlement. portfolio.Cash moves with every
+// fill, like the D+2 deposit a broker shows, while portfolio.Settled only moves once a trade
+// settles. Interest accrues on Settled between sessions.
+type settlementLedger struct {
+	model   data.SettlementModel
+	pending []pendingSettlement
+	session string // YYYYMMDD of the current session
+
+	interestIncome float64
+	marginInterest float64
+}
+
+func newSettlementLedger(model data.SettlementModel) *settlementLedger {
+	return &settlementLedger{model: model}
+}
+
+// startSession accrues interest on the settled cash since the previous session, then settles
+// the trades due on session
+func (l *settlementLedger) startSession(session string, portfolio *data.Portfolio) {
+	if l.session != "" {
+		previous, _ := time.Parse("20060102", l.session)
+		current, _ := time.Parse("20060102", session)
+		years := current.Sub(previous).Hours() / 24 / 365
+		var interest float64
+		if portfolio.Settled > 0 {
+			interest = portfolio.Settled * l.model.InterestRate * years
+			l.interestIncome += interest
+		} else {
+			interest = portfolio.Settled * l.model.MarginRate * years
+			l.marginInterest -= interest
+		}
+		portfolio.Settled += interest
+		portfolio.Cash += interest
+	}
+	l.session = session
+
+	pending := l.pending[:0]
+	for _, entry := range l.pending {
+		if entry.date <= session {
+			portfolio.Settled += entry.amount
+		} else {
+			pending = append(pending, entry)
+		}
+	}
+	l.pending = pending
+}
+
+// record queues the cash a trade on tradeDate (YYYYMMDD) moves at settlement
+func (l *settlementLedger) record(tradeDate string, amount float64, portfolio *data.Portfolio) {
+	if *l.model.Days == 0 {
+		portfolio.Settled += amount
+		return
+	}
+	l.pending = append(l.pending, pendingSettlement{date: settlementDate(tradeDate, *l.model.Days), amount: amount})
+}
+
+// buyingPower is the cash BUYs may spend: the D+2 cash, or with "settled" the settled cash less
+// unsettled purchases, plus the margin allowance
+func (l *settlementLedger) buyingPower(portfolio *data.Portfolio) float64 {
+	power := portfolio.Cash
+	if l.model.BuyingPower == "settled" {
+		power = portfolio.Settled
+		for _, entry := range l.pending {
+			if entry.amount < 0 {
+				power += entry.amount
+			}
+		}
+	}
+	return power + l.model.MarginRatio*portfolio.Total
+}
+
+// settlementDate is days trading days after tradeDate. Past the end of the trading calendar it
+// counts weekdays instead.
+func settlementDate(tradeDate string, days int) string {
+	if date, err := data.AddTradingDays(tradeDate, days); err == nil {
+		return date
+	}
+	date, _ := time.Parse("20060102", tradeDate)
+	for days > 0 {
+		date = date.AddDate(0, 0, 1)
+		if date.Weekday() != time.Saturday && date.Weekday() != time.Sunday {
+			days--
+		}
+	}
+	return date.Format("20060102")
+}
@@ -0,0 +1,81 @@
+package service
+
+import (
+	"math"
+	"testing"
+
+	"github.com/Paaaark/hanquant/internal/data"
+)
+
+func TestSettlementDate(t *testing.T) {
+	t.Setenv("TRADING_DAYS_CSV", "../../weekdays.csv")
+	tests := []struct {
+		trade string
+		days  int
+		want  string
+	}{
+		{"20240910", 2, "20240912"},
+		// Chuseok closed the market from 16 to 18 September 2024
+		{"20240912", 2, "20240919"},
+		{"20240913", 2, "20240920"},
+		// 1 October (Armed Forces Day) and 3 October (National Foundation Day) were holidays
+		{"20240927", 2, "20241002"},
+		{"20240930", 2, "20241004"},
+		{"20240930", 1, "20241002"},
+		{"20240102", 0, "20240102"},
+		// Past the end of the calendar only weekends are skipped
+		{"20251230", 2, "20260101"},
+		{"20260102", 2, "20260106"},
+	}
+	for _, tt := range tests {
+		if got := settlementDate(tt.trade, tt.days); got != tt.want {
+			t.Errorf("settlementDate(%s, %d) = %s, want %s", tt.trade, tt.days, got, tt.want)
+		}
+	}
+}
+
+func TestSettlementLedger(t *testing.T) {
+	t.Setenv("TRADING_DAYS_CSV", "../../weekdays.csv")
+	model := data.SettlementModel{BuyingPower: "settled", InterestRate: 0.0365}
+	applySettlementDefaults(&model)
+	ledger := newSettlementLedger(model)
+	portfolio := &data.Portfolio{Cash: 1000000, Settled: 1000000, Total: 1000000}
+
+	ledger.startSession("20240912", portfolio)
+	// Buy on Thursday: the cash leaves at once, the settled cash after Chuseok
+	portfolio.Cash -= 400000
+	ledger.record("20240912", -400000, portfolio)
+	if got := ledger.buyingPower(portfolio); got != 600000 {
+		t.Errorf("settled buying power after the buy = %v, want 600000", got)
+	}
+
+	// A day of interest on 1,000,000 won at 3.65% a year is 100 won
+	ledger.startSession("20240913", portfolio)
+	if portfolio.Settled != 1000100 {
+		t.Errorf("settled cash on 13 September = %v, want 1000100", portfolio.Settled)
+	}
+	// Sale proceeds on Friday only become buying power once they settle
+	portfolio.Cash += 100000
+	ledger.record("20240913", 100000, portfolio)
+	if got := ledger.buyingPower(portfolio); got != 600100 {
+		t.Errorf("settled buying power after the sale = %v, want 600100", got)
+	}
+
+	// Six calendar days of interest on 1,000,100 won, then the buy settles
+	ledger.startSession("20240919", portfolio)
+	if want := 1000100 + 600.06 - 400000; math.Abs(portfolio.Settled-want) > 1e-6 {
+		t.Errorf("settled cash on 19 September = %v, want %v", portfolio.Settled, want)
+	}
+	// A day of interest on 600,700.06 won, then the sale settles
+	ledger.startSession("20240920", portfolio)
+	interest := 100 + 600.06 + 600700.06*0.0365/365
+	if want := 1000000 + interest - 400000 + 100000; math.Abs(portfolio.Settled-want) > 1e-6 {
+		t.Errorf("settled cash on 20 September = %v, want %v", portfolio.Settled, want)
+	}
+	if math.Abs(portfolio.Cash-portfolio.Settled) > 1e-6 {
+		t.Errorf("cash %v and settled cash %v differ once nothing is pending", portfolio.Cash, portfolio.Settled)
+	}
+	if math.Abs(ledger.interestIncome-interest) > 1e-6 {
+		t.Errorf("interest income = %v, want %v", ledger.interestIncome, interest)
+	}
+}
@@ -0,0 +1,151 @@
+package service
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/Paaaark/hanquant/internal/data"
+)
+
+const (
+	defaultInitialCash = 10000000 // 10M KRW starting capital
+	minInitialCash     = 100000
+)
+
+// applySizingDefaults fills in the defaults of the chosen sizing method
+func applySizingDefaults(rule *data.SizingRule) {
+	if rule.Method == "" {
+		rule.Method = "fixed_fraction"
+	}
+	switch rule.Method {
+	case "fixed_fraction":
+		if rule.Fraction == 0 {
+			rule.Fraction = 0.1 // 10% of portfolio per stock
+		}
+	case "vol_target":
+		if rule.TargetVol == 0 {
+			rule.TargetVol = 0.02
+		}
+		if rule.VolWindow == 0 {
+			rule.VolWindow = 20
+		}
+	}
+}
+
+// validateSizing checks the sizing rule against the starting capital
+func validateSizing(rule data.SizingRule, initialCash float64) error {
+	switch rule.Method {
+	case "fixed_fraction":
+		if rule.Fraction <= 0 || rule.Fraction > 1 {
+			return fmt.Errorf("sizing fraction must be in (0, 1]")
+		}
+	case "equal_weight":
+	case "vol_target":
+		if rule.TargetVol <= 0 || rule.TargetVol > 1 {
+			return fmt.Errorf("sizing target_vol must be in (0, 1]")
+		}
+		if rule.VolWindow < 2 {
+			return fmt.Errorf("sizing vol_window must be at least 2")
+		}
+	case "fixed_amount":
+		if rule.Amount <= 0 {
+			return fmt.Errorf("sizing amount must be positive")
+		}
+		if rule.Amount > initialCash {
+			return fmt.Errorf("sizing amount cannot exceed initial cash")
+		}
+	default:
+		return fmt.Errorf("unknown sizing method: %q", rule.Method)
+	}
+	return nil
+}
+
+// positionSizer turns a BUY order into a target position value according to a SizingRule
+type positionSizer struct {
+	rule         data.SizingRule
+	universeSize int
+	history      map[string][]data.StockData
+	dateIndex    map[string]map[string]int // symbol -> barKey -> bar index
+	barsPerYear  float64                   // annualizes per-bar volatility
+}
+
+func newPositionSizer(rule data.SizingRule, universeSize int, history map[string][]data.StockData, barsPerYear float64) *positionSizer {
+	sizer := &positionSizer{
+		rule:         rule,
+		universeSize: universeSize,
+		barsPerYear:  barsPerYear,
+	}
+	sizer.reindex(history)
+	return sizer
+}
+
+// reindex switches the sizer to history, which may have grown since the sizer was created
+func (p *positionSizer) reindex(history map[string][]data.StockData) {
+	p.history = history
+	if p.rule.Method != "vol_target" {
+		return
+	}
+	p.dateIndex = make(map[string]map[string]int, len(history))
+	for symbol, bars := range history {
+		index := make(map[string]int, len(bars))
+		for i, bar := range bars {
+			index[barKey(bar.Date)] = i
+		}
+		p.dateIndex[symbol] = index
+	}
+}
+
+// positionValue returns how many KRW to invest in symbol on the given day
+func (p *positionSizer) positionValue(portfolio *data.Portfolio, symbol string, day data.MarketDay) float64 {
+	switch p.rule.Method {
+	case "equal_weight":
+		if p.universeSize == 0 {
+			return 0
+		}
+		return portfolio.Total / float64(p.universeSize)
+	case "vol_target":
+		vol := p.annualizedVolatility(symbol, day)
+		if vol == 0 {
+			return 0
+		}
+		// Never lever up beyond the whole portfolio
+		return math.Min(portfolio.Total*p.rule.TargetVol/vol, portfolio.Total)
+	case "fixed_amount":
+		return p.rule.Amount
+	default:
+		return portfolio.Total * p.rule.Fraction
+	}
+}
+
+// annualizedVolatility of close-to-close bar returns over the lookback ending on day
+func (p *positionSizer) annualizedVolatility(symbol string, day data.MarketDay) float64 {
+	idx, exists := p.dateIndex[symbol][barKey(day.Date)]
+	if !exists || idx < p.rule.VolWindow {
+		return 0
+	}
+
+	bars := p.history[symbol]
+	returns := make([]float64, 0, p.rule.VolWindow)
+	for i := idx - p.rule.VolWindow + 1; i <= idx; i++ {
+		if bars[i-1].Close > 0 {
+			returns = append(returns, bars[i].Close/bars[i-1].Close-1)
+		}
+	}
+	if len(returns) < 2 {
+		return 0
+	}
+
+	mean := 0.0
+	for _, r := range returns {
+		mean += r
+	}
+	mean /= float64(len(returns))
+
+	variance := 0.0
+	for _, r := range returns {
+		variance += (r - mean) * (r - mean)
+	}
+	variance /= float64(len(returns) - 1)
+
+	return math.Sqrt(variance) * math.Sqrt(p.barsPerYear)
+}
@@ -3,11 +3,16 @@ package service
 import (
 	"fmt"
 	"os"
+	"sort"
+	"strconv"
 	"time"
 
 	"github.com/Paaaark/hanquant/internal/data"
 )
 
+// indexChunkDays keeps each index chart request under the 50 bars KIS returns per call
+const indexChunkDays = 70
+
 type StockService struct {
 	store     *data.StockStore
 	kis       *data.KISClient // default, but not used for user-specific calls
@@ -53,8 +58,9 @@ func (s *StockService) GetRecentPrice(symbol string) (interface{}, error) {
 	return s.kis.GetRecentDailyPrice(symbol)
 }
 
-// GetHistoricalPrice prioritizes S3 data over KIS API calls
-func (s *StockService) GetHistoricalPrice(symbol, from, to, duration string) (interface{}, error) {
+// GetHistoricalPrice prioritizes S3 data over KIS API calls. With adjusted set, prices before
+// splits and other corporate actions are put on today's share basis.
+func (s *StockService) GetHistoricalPrice(symbol, from, to, duration string, adjusted bool) (interface{}, error) {
 	// Set default date range to 3 months if not specified
 	if from == "" || to == "" {
 		now := time.Now()
@@ -69,7 +75,7 @@ func (s *StockService) GetHistoricalPrice(symbol, from, to, duration string) (in
 
 	// Try to get data from S3 first
 	if s.s3Storage != nil {
-		data, err := s.getHistoricalDataFromS3(symbol, from, to, duration)
+		data, err := s.getHistoricalDataFromS3(symbol, from, to, duration, adjusted)
 		if err != nil {
 			fmt.Printf("DEBUG: S3 error: %v\n", err)
 		} else if data != nil {
@@ -90,11 +96,11 @@ func (s *StockService) GetHistoricalPrice(symbol, from, to, duration string) (in
 
 	// If S3 data is not available or insufficient, fetch from KIS API
 	fmt.Printf("DEBUG: Fetching from KIS API...\n")
-	return s.getHistoricalDataFromKIS(symbol, from, to, duration)
+	return s.getHistoricalDataFromKIS(symbol, from, to, duration, adjusted)
 }
 
 // getHistoricalDataFromS3 retrieves historical data from S3 storage
-func (s *StockService) getHistoricalDataFromS3(symbol, from, to, duration string) (interface{}, error) {
+func (s *StockService) getHistoricalDataFromS3(symbol, from, to, duration string, adjusted bool) (interface{}, error) {
 	fmt.Printf("DEBUG: getHistoricalDataFromS3 called for %s duration %s\n", symbol, duration)
 	
 	if duration == "D" {
@@ -108,6 +114,15 @@ func (s *StockService) getHistoricalDataFromS3(symbol, from, to, duration string
 
 		fmt.Printf("DEBUG: Loaded %d records from S3\n", len(allData))
 
+		// S3 keeps traded prices; adjust them with the symbol's corporate action log
+		if adjusted {
+			actions, err := s.s3Storage.LoadCorporateActions(symbol)
+			if err != nil {
+				return nil, err
+			}
+			allData = adjustPrices(allData, actions)
+		}
+
 		// Filter data to requested date range
 		filteredData := s.filterDataByDateRange(allData, from, to)
 		if sliceData, ok := filteredData.([]data.PriceStruct); ok {
@@ -156,9 +171,74 @@ func (s *StockService) filterDataByDateRange(input interface{}, from, to string)
 }
 
 // getHistoricalDataFromKIS fetches historical data from KIS API with chunking for large ranges
-func (s *StockService) getHistoricalDataFromKIS(symbol, from, to, duration string) (interface{}, error) {
+func (s *StockService) getHistoricalDataFromKIS(symbol, from, to, duration string, adjusted bool) (interface{}, error) {
 	// For now, just use the original method
-	return s.kis.GetDailyPrice(symbol, from, to, duration)
+	return s.kis.GetDailyPrice(symbol, from, to, duration, adjusted)
+}
+
+// GetCorporateActions returns the corporate action log of symbol, oldest first
+func (s *StockService) GetCorporateActions(symbol string) ([]data.CorporateAction, error) {
+	if s.s3Storage == nil {
+		return nil, fmt.Errorf("corporate actions are kept in S3, but S3 storage is not configured")
+	}
+	return s.s3Storage.LoadCorporateActions(symbol)
+}
+
+// GetDailyBars returns daily bars of symbol between from and to (YYYYMMDD), oldest first,
+// using the same S3-then-KIS lookup as GetHistoricalPrice
+func (s *StockService) GetDailyBars(symbol, from, to string, adjusted bool) ([]data.StockData, error) {
+	raw, err := s.GetHistoricalPrice(symbol, from, to, "D", adjusted)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch data for %s: %w", symbol, err)
+	}
+	bars, err := convertToStockData(symbol, raw)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert data for %s: %w", symbol, err)
+	}
+	return bars, nil
+}
+
+func convertToStockData(symbol string, rawData interface{}) ([]data.StockData, error) {
+	var result []data.StockData
+
+	// Try to convert from SlicePriceStruct
+	if sliceData, ok := rawData.(data.SlicePriceStruct); ok {
+		for _, price := range sliceData {
+			// Parse date
+			date, err := time.Parse("20060102", price.Date)
+			if err != nil {
+				continue // Skip invalid dates
+			}
+
+			// Parse numeric values
+			open, _ := strconv.ParseFloat(price.Open, 64)
+			high, _ := strconv.ParseFloat(price.High, 64)
+			low, _ := strconv.ParseFloat(price.Low, 64)
+			close, _ := strconv.ParseFloat(price.Close, 64)
+			volume, _ := strconv.ParseInt(price.Volume, 10, 64)
+
+			stockData := data.StockData{
+				Symbol: symbol,
+				Date:   date,
+				Open:   open,
+				High:   high,
+				Low:    low,
+				Close:  close,
+				Volume: volume,
+			}
+
+			result = append(result, stockData)
+		}
+
+		// KIS returns the newest bar first; strategies expect oldest first
+		sort.Slice(result, func(i, j int) bool {
+			return result[i].Date.Before(result[j].Date)
+		})
+		return result, nil
+	}
+
+	// If not SlicePriceStruct, return empty result
+	return result, nil
 }
 
 func (s *StockService) GetTopFluctuationStocks() (data.SliceRankingStock, error) {
@@ -181,6 +261,46 @@ func (s *StockService) GetIndexPrice(code string) (*data.IndexStruct, error) {
 	return s.kis.GetIndexPrice(code)
 }
 
+// GetIndexHistory returns daily index bars between from and to (YYYYMMDD), oldest first.
+// The KIS index chart caps each response, so the range is requested in chunks.
+func (s *StockService) GetIndexHistory(code, from, to string) (data.SliceIndexPriceStruct, error) {
+	fromDate, err := time.Parse("20060102", from)
+	if err != nil {
+		return nil, fmt.Errorf("invalid from date: %w", err)
+	}
+	toDate, err := time.Parse("20060102", to)
+	if err != nil {
+		return nil, fmt.Errorf("invalid to date: %w", err)
+	}
+
+	kis := s.kis.WithPriority(data.PriorityBulk)
+	seen := make(map[string]bool)
+	var result data.SliceIndexPriceStruct
+	for chunkStart := fromDate; !chunkStart.After(toDate); chunkStart = chunkStart.AddDate(0, 0, indexChunkDays) {
+		chunkEnd := chunkStart.AddDate(0, 0, indexChunkDays-1)
+		if chunkEnd.After(toDate) {
+			chunkEnd = toDate
+		}
+
+		bars, err := kis.GetDailyIndexPrice(code, chunkStart.Format("20060102"), chunkEnd.Format("20060102"))
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch index %s from %s: %w", code, chunkStart.Format("20060102"), err)
+		}
+		for _, bar := range bars {
+			if bar.Date == "" || seen[bar.Date] {
+				continue
+			}
+			seen[bar.Date] = true
+			result = append(result, bar)
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Date < result[j].Date
+	})
+	return result, nil
+}
+
 // Accepts a KISClient instance with user credentials
 func (s *StockService) GetAccountPortfolio(kis *data.KISClient, accNo string, mock bool) (data.SlicePortfolioPosition, *data.AccountSummary, error) {
 	return kis.GetAccountPortfolio(accNo, mock)
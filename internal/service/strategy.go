@@ -0,0 +1,165 @@
+package service
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/Paaaark/hanquant/internal/data"
+)
+
+// Strategy is a trading strategy that the backtest engine drives one trading day at a time.
+//
+// The engine calls Init once with the full price history of the universe, then OnDay
+// for every trading day in [From, To], or for every bar in intraday runs. The orders returned from OnDay are sized and
+// filled by the engine, so a strategy only decides *what* to trade, not how much.
+type Strategy interface {
+	// Name returns the registry name of the strategy (e.g. "sma_crossover")
+	Name() string
+	// Init receives the complete history for every symbol before the run starts
+	Init(history map[string][]data.StockData) error
+	// OnDay receives the bars of the current trading day and returns the orders to place
+	OnDay(day data.MarketDay, portfolio *data.Portfolio) []data.StrategyOrder
+}
+
+// HistoryExtender is implemented by strategies that keep state of their own during a run, such as
+// the positions they opened. When a feed adds bars during the run, as paper trading does, the
+// engine hands the grown history to Extend, which must keep that state. Strategies without it
+// are initialised again with the grown history.
+type HistoryExtender interface {
+	Extend(history map[string][]data.StockData) error
+}
+
+// extendStrategy passes bars added during a run to strategy
+func extendStrategy(strategy Strategy, history map[string][]data.StockData) error {
+	if extender, ok := strategy.(HistoryExtender); ok {
+		return extender.Extend(history)
+	}
+	return strategy.Init(history)
+}
+
+// StrategyFactory builds a strategy from already validated parameters
+type StrategyFactory func(params map[string]float64) (Strategy, error)
+
+type strategyEntry struct {
+	info    data.StrategyInfo
+	factory StrategyFactory
+}
+
+var strategyRegistry = make(map[string]strategyEntry)
+
+// RegisterStrategy makes a strategy available to RunBacktest under info.Name.
+func RegisterStrategy(info data.StrategyInfo, factory StrategyFactory) {
+	if _, exists := strategyRegistry[info.Name]; exists {
+		panic(fmt.Sprintf("strategy %q already registered", info.Name))
+	}
+	strategyRegistry[info.Name] = strategyEntry{info: info, factory: factory}
+}
+
+// ListStrategies returns every registered strategy with its parameter schema, sorted by name.
+func ListStrategies() []data.StrategyInfo {
+	infos := make([]data.StrategyInfo, 0, len(strategyRegistry))
+	for _, entry := range strategyRegistry {
+		infos = append(infos, entry.info)
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Name < infos[j].Name
+	})
+	return infos
+}
+
+// NewStrategy looks up a registered strategy, fills in default parameters and validates
+// the given ones against its schema. The resolved parameters are returned alongside
+// the strategy so they can be echoed back in the result.
+func NewStrategy(name string, params map[string]float64) (Strategy, map[string]float64, error) {
+	entry, exists := strategyRegistry[name]
+	if !exists {
+		return nil, nil, fmt.Errorf("unknown strategy: %q", name)
+	}
+
+	resolved, err := resolveStrategyParams(entry.info, params)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	strategy, err := entry.factory(resolved)
+	if err != nil {
+		return nil, nil, err
+	}
+	return strategy, resolved, nil
+}
+
+// resolveStrategyParams applies defaults and checks types and bounds of strategy parameters
+func resolveStrategyParams(info data.StrategyInfo, params map[string]float64) (map[string]float64, error) {
+	known := make(map[string]data.StrategyParamSpec, len(info.Params))
+	for _, spec := range info.Params {
+		known[spec.Name] = spec
+	}
+	for name := range params {
+		if _, ok := known[name]; !ok {
+			return nil, fmt.Errorf("unknown parameter %q for strategy %q", name, info.Name)
+		}
+	}
+
+	resolved := make(map[string]float64, len(info.Params))
+	for _, spec := range info.Params {
+		value, ok := params[spec.Name]
+		if !ok {
+			value = spec.Default
+		}
+		if spec.Type == "int" && value != math.Trunc(value) {
+			return nil, fmt.Errorf("parameter %q must be an integer", spec.Name)
+		}
+		if value < spec.Min {
+			return nil, fmt.Errorf("parameter %q must be at least %g", spec.Name, spec.Min)
+		}
+		if spec.Max != 0 && value > spec.Max {
+			return nil, fmt.Errorf("parameter %q must be at most %g", spec.Name, spec.Max)
+		}
+		resolved[spec.Name] = value
+	}
+	return resolved, nil
+}
+
+// barKey identifies a bar by its timestamp, which is the trading date for daily bars
+func barKey(date time.Time) string {
+	return date.Format("20060102150405")
+}
+
+// buildMarketDays groups the bars of the universe by timestamp for sessions within (fromDate, toDate),
+// so daily bars give one step per trading day and intraday bars one step per interval.
+// Bars inside a step follow the order of the universe so that order execution is deterministic.
+func buildMarketDays(universe []string, stockData map[string][]data.StockData, fromDate, toDate time.Time) []data.MarketDay {
+	byDate := make(map[string]*data.MarketDay)
+	var days []*data.MarketDay
+
+	for _, symbol := range universe {
+		for _, bar := range stockData[symbol] {
+			session := time.Date(bar.Date.Year(), bar.Date.Month(), bar.Date.Day(), 0, 0, 0, 0, bar.Date.Location())
+			if !session.After(fromDate) || !session.Before(toDate) {
+				continue
+			}
+			key := barKey(bar.Date)
+			day, exists := byDate[key]
+			if !exists {
+				day = &data.MarketDay{Date: bar.Date}
+				byDate[key] = day
+				days = append(days, day)
+			}
+			day.Bars = append(day.Bars, bar)
+		}
+	}
+
+	sort.Slice(days, func(i, j int) bool {
+		return days[i].Date.Before(days[j].Date)
+	})
+
+	result := make([]data.MarketDay, len(days))
+	for i, day := range days {
+		result[i] = *day
+		result[i].SessionEnd = i == len(days)-1 || days[i+1].Date.Format("20060102") != day.Date.Format("20060102")
+		result[i].IndexBars()
+	}
+	return result
+}
@@ -0,0 +1,57 @@
+package service
+
+import (
+	"github.com/Paaaark/hanquant/internal/data"
+)
+
+func init() {
+	RegisterStrategy(data.StrategyInfo{
+		Name:        "buy_and_hold",
+		Description: "Splits the initial portfolio evenly across the universe, buys each stock on its first bar and never sells",
+	}, func(params map[string]float64) (Strategy, error) {
+		return &BuyAndHoldStrategy{}, nil
+	})
+}
+
+// BuyAndHoldStrategy buys an equal slice of the starting portfolio in every stock once
+type BuyAndHoldStrategy struct {
+	symbols int
+	budget  float64 // KRW per stock, set on the first day
+	bought  map[string]bool
+}
+
+func (s *BuyAndHoldStrategy) Name() string {
+	return "buy_and_hold"
+}
+
+func (s *BuyAndHoldStrategy) Init(history map[string][]data.StockData) error {
+	s.symbols = len(history)
+	s.budget = 0
+	s.bought = make(map[string]bool, len(history))
+	return nil
+}
+
+// Extend keeps the budget and the stocks already bought, so a grown history buys nothing again
+func (s *BuyAndHoldStrategy) Extend(history map[string][]data.StockData) error {
+	return nil
+}
+
+// OnDay buys stocks seen for the first time. Stocks that start trading later in the run, such as
+// new listings, are bought then with the same budget if cash allows.
+func (s *BuyAndHoldStrategy) OnDay(day data.MarketDay, portfolio *data.Portfolio) []data.StrategyOrder {
+	if s.budget == 0 && s.symbols > 0 {
+		s.budget = portfolio.Total / float64(s.symbols)
+	}
+
+	var orders []data.StrategyOrder
+	for _, bar := range day.Bars {
+		if s.bought[bar.Symbol] || bar.Close <= 0 {
+			continue
+		}
+		s.bought[bar.Symbol] = true
+		if quantity := int(s.budget / bar.Close); quantity > 0 {
+			orders = append(orders, data.StrategyOrder{Symbol: bar.Symbol, Side: "BUY", Quantity: quantity})
+		}
+	}
+	return orders
+}
@@ -0,0 +1,111 @@
+package service
+
+import (
+	"fmt"
+
+	"github.com/Paaaark/hanquant/internal/data"
+	"github.com/Paaaark/hanquant/internal/rules"
+)
+
+// RulesStrategyName is the strategy name of backtests that run params.Rules
+const RulesStrategyName = "rules"
+
+// newRunStrategy builds the strategy of a run: the rule set when rules is given, otherwise the
+// registered strategy name with its parameters
+func newRunStrategy(name string, params map[string]float64, source string) (Strategy, map[string]float64, error) {
+	if source == "" {
+		return NewStrategy(name, params)
+	}
+	if name != "" && name != RulesStrategyName {
+		return nil, nil, fmt.Errorf("rules cannot be combined with strategy %q", name)
+	}
+	if len(params) > 0 {
+		return nil, nil, fmt.Errorf("rules take no strategy_params")
+	}
+	strategy, err := NewRuleStrategy(source)
+	if err != nil {
+		return nil, nil, err
+	}
+	return strategy, nil, nil
+}
+
+// RuleStrategy trades a rule set: it buys a stock it does not hold when the entry condition
+// holds on a bar and sells the whole position when the exit condition does
+type RuleStrategy struct {
+	program    *rules.Program
+	evaluators map[string]*rules.Evaluator
+	dateIndex  map[string]map[string]int // symbol -> barKey -> bar index
+	positions  map[string]*rules.Position
+}
+
+// NewRuleStrategy parses source, see package rules. Parse errors carry their line and column.
+func NewRuleStrategy(source string) (*RuleStrategy, error) {
+	program, err := rules.Parse(source)
+	if err != nil {
+		return nil, fmt.Errorf("rules: %w", err)
+	}
+	return &RuleStrategy{program: program}, nil
+}
+
+func (s *RuleStrategy) Name() string {
+	return RulesStrategyName
+}
+
+// Init binds the rules to the history of every symbol. Indicators are computed on first use.
+func (s *RuleStrategy) Init(history map[string][]data.StockData) error {
+	s.positions = make(map[string]*rules.Position)
+	return s.Extend(history)
+}
+
+// Extend binds the rules to a grown history, keeping the entry price and bars held of open
+// positions
+func (s *RuleStrategy) Extend(history map[string][]data.StockData) error {
+	s.evaluators = make(map[string]*rules.Evaluator, len(history))
+	s.dateIndex = make(map[string]map[string]int, len(history))
+
+	for symbol, bars := range history {
+		index := make(map[string]int, len(bars))
+		for i, bar := range bars {
+			index[barKey(bar.Date)] = i
+		}
+		s.evaluators[symbol] = s.program.Bind(bars)
+		s.dateIndex[symbol] = index
+	}
+	return nil
+}
+
+// OnDay checks the exit of held stocks and the entry of the others. The strategy does not see
+// fills, so entry_price is the open of the first bar a position is held on, which is what a
+// market buy fills at before slippage.
+func (s *RuleStrategy) OnDay(day data.MarketDay, portfolio *data.Portfolio) []data.StrategyOrder {
+	var orders []data.StrategyOrder
+
+	for _, bar := range day.Bars {
+		idx, exists := s.dateIndex[bar.Symbol][barKey(bar.Date)]
+		if !exists {
+			continue
+		}
+		evaluator := s.evaluators[bar.Symbol]
+
+		if portfolio.Positions[bar.Symbol] <= 0 {
+			delete(s.positions, bar.Symbol)
+			if evaluator.Entry(idx) {
+				orders = append(orders, data.StrategyOrder{Symbol: bar.Symbol, Side: "BUY"})
+			}
+			continue
+		}
+
+		position, held := s.positions[bar.Symbol]
+		if !held {
+			position = &rules.Position{EntryPrice: bar.Open}
+			s.positions[bar.Symbol] = position
+		} else {
+			position.BarsHeld++
+		}
+		if evaluator.Exit(idx, *position) {
+			orders = append(orders, data.StrategyOrder{Symbol: bar.Symbol, Side: "SELL"})
+		}
+	}
+
+	return orders
+}
@@ -0,0 +1,109 @@
+package service
+
+import (
+	"fmt"
+
+	"github.com/Paaaark/hanquant/internal/data"
+	"github.com/Paaaark/hanquant/internal/indicators"
+)
+
+func init() {
+	RegisterStrategy(data.StrategyInfo{
+		Name:        "sma_crossover",
+		Description: "Buys on a golden cross (short SMA crosses above long SMA) and sells the whole position on a death cross",
+		Params: []data.StrategyParamSpec{
+			{Name: "sma_short", Type: "int", Default: 20, Min: 1, Description: "Short SMA window in trading days"},
+			{Name: "sma_long", Type: "int", Default: 50, Min: 2, Description: "Long SMA window in trading days"},
+		},
+	}, func(params map[string]float64) (Strategy, error) {
+		return NewSMACrossoverStrategy(int(params["sma_short"]), int(params["sma_long"]))
+	})
+}
+
+// SMACrossoverStrategy trades the crossover of a short and a long simple moving average
+type SMACrossoverStrategy struct {
+	shortWindow int
+	longWindow  int
+	smas        map[string]data.SMACalculation
+	dateIndex   map[string]map[string]int // symbol -> barKey -> bar index
+}
+
+// NewSMACrossoverStrategy creates an SMA crossover strategy with the given windows
+func NewSMACrossoverStrategy(shortWindow, longWindow int) (*SMACrossoverStrategy, error) {
+	if shortWindow < 1 || longWindow < 1 {
+		return nil, fmt.Errorf("SMA windows must be positive integers")
+	}
+	if shortWindow >= longWindow {
+		return nil, fmt.Errorf("short SMA window must be less than long SMA window")
+	}
+	return &SMACrossoverStrategy{
+		shortWindow: shortWindow,
+		longWindow:  longWindow,
+	}, nil
+}
+
+func (s *SMACrossoverStrategy) Name() string {
+	return "sma_crossover"
+}
+
+// Init calculates both SMAs for every symbol. Values are aligned with the bars and
+// NaN until the window is filled.
+func (s *SMACrossoverStrategy) Init(history map[string][]data.StockData) error {
+	s.smas = make(map[string]data.SMACalculation, len(history))
+	s.dateIndex = make(map[string]map[string]int, len(history))
+
+	for symbol, bars := range history {
+		if len(bars) < s.longWindow {
+			continue
+		}
+
+		dates := make([]string, len(bars))
+		index := make(map[string]int, len(bars))
+		for i, bar := range bars {
+			dates[i] = bar.Date.Format("2006-01-02")
+			index[barKey(bar.Date)] = i
+		}
+
+		s.smas[symbol] = data.SMACalculation{
+			ShortSMA: indicators.SMA(bars, s.shortWindow),
+			LongSMA:  indicators.SMA(bars, s.longWindow),
+			Dates:    dates,
+		}
+		s.dateIndex[symbol] = index
+	}
+	return nil
+}
+
+// OnDay emits a BUY on a golden cross and a SELL on a death cross
+func (s *SMACrossoverStrategy) OnDay(day data.MarketDay, portfolio *data.Portfolio) []data.StrategyOrder {
+	var orders []data.StrategyOrder
+
+	for _, bar := range day.Bars {
+		calculation, exists := s.smas[bar.Symbol]
+		if !exists {
+			continue
+		}
+		idx, exists := s.dateIndex[bar.Symbol][barKey(bar.Date)]
+		// Both SMAs must be defined on the previous bar to detect a cross
+		if !exists || idx < s.longWindow {
+			continue
+		}
+
+		prevShort := calculation.ShortSMA[idx-1]
+		prevLong := calculation.LongSMA[idx-1]
+		currShort := calculation.ShortSMA[idx]
+		currLong := calculation.LongSMA[idx]
+
+		// Golden cross: short SMA crosses above long SMA
+		if prevShort <= prevLong && currShort > currLong {
+			orders = append(orders, data.StrategyOrder{Symbol: bar.Symbol, Side: "BUY"})
+		}
+
+		// Death cross: short SMA crosses below long SMA
+		if prevShort >= prevLong && currShort < currLong {
+			orders = append(orders, data.StrategyOrder{Symbol: bar.Symbol, Side: "SELL"})
+		}
+	}
+
+	return orders
+}
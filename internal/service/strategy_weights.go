@@ -0,0 +1,340 @@
+package service
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/Paaaark/hanquant/internal/data"
+)
+
+func init() {
+	RegisterWeightStrategy(data.StrategyInfo{
+		Name:        "equal_weight",
+		Description: "Holds every stock of the universe that trades on the rebalance day at the same weight",
+	}, func(params map[string]float64) (WeightStrategy, error) {
+		return &EqualWeightStrategy{}, nil
+	})
+
+	RegisterWeightStrategy(data.StrategyInfo{
+		Name:        "inverse_vol",
+		Description: "Weights each stock by the inverse of its return volatility, so calmer stocks get more capital",
+		Params: []data.StrategyParamSpec{
+			{Name: "lookback", Type: "int", Default: 60, Min: 2, Description: "Bars of returns used to measure volatility"},
+		},
+	}, func(params map[string]float64) (WeightStrategy, error) {
+		return &InverseVolStrategy{lookback: int(params["lookback"])}, nil
+	})
+
+	RegisterWeightStrategy(data.StrategyInfo{
+		Name:        "min_variance",
+		Description: "Long-only minimum variance portfolio from the covariance of recent returns",
+		Params: []data.StrategyParamSpec{
+			{Name: "lookback", Type: "int", Default: 120, Min: 2, Description: "Bars of returns used to estimate the covariance"},
+			{Name: "shrinkage", Type: "float", Default: 0.1, Min: 0, Max: 1, Description: "Weight of the diagonal target the covariance is shrunk towards"},
+		},
+	}, func(params map[string]float64) (WeightStrategy, error) {
+		return &MinVarianceStrategy{lookback: int(params["lookback"]), shrinkage: params["shrinkage"]}, nil
+	})
+
+	RegisterWeightStrategy(data.StrategyInfo{
+		Name:        "momentum_top_n",
+		Description: "Holds the N stocks with the highest trailing return, skipping the most recent bars, at equal weight",
+		Params: []data.StrategyParamSpec{
+			{Name: "lookback", Type: "int", Default: 252, Min: 1, Description: "Bars the momentum return is measured over"},
+			{Name: "skip", Type: "int", Default: 21, Min: 0, Description: "Most recent bars left out of the momentum return"},
+			{Name: "top_n", Type: "int", Default: 5, Min: 1, Description: "Number of stocks to hold"},
+		},
+	}, func(params map[string]float64) (WeightStrategy, error) {
+		return &MomentumStrategy{lookback: int(params["lookback"]), skip: int(params["skip"]), topN: int(params["top_n"])}, nil
+	})
+}
+
+// barHistory gives weight strategies the bars of a symbol up to any step of the backtest
+type barHistory struct {
+	bars  map[string][]data.StockData
+	index map[string]map[string]int // symbol -> barKey -> bar index
+}
+
+func newBarHistory(history map[string][]data.StockData) *barHistory {
+	h := &barHistory{
+		bars:  history,
+		index: make(map[string]map[string]int, len(history)),
+	}
+	for symbol, bars := range history {
+		index := make(map[string]int, len(bars))
+		for i, bar := range bars {
+			index[barKey(bar.Date)] = i
+		}
+		h.index[symbol] = index
+	}
+	return h
+}
+
+// closes returns the n+1 closes of bar's symbol ending at bar, or nil without enough history
+func (h *barHistory) closes(bar data.StockData, n int) []float64 {
+	idx, exists := h.index[bar.Symbol][barKey(bar.Date)]
+	if !exists || idx < n {
+		return nil
+	}
+	closes := make([]float64, n+1)
+	for i, past := range h.bars[bar.Symbol][idx-n : idx+1] {
+		if past.Close <= 0 {
+			return nil
+		}
+		closes[i] = past.Close
+	}
+	return closes
+}
+
+// returns returns the last n simple returns of bar's symbol ending at bar, or nil without enough history
+func (h *barHistory) returns(bar data.StockData, n int) []float64 {
+	closes := h.closes(bar, n)
+	if closes == nil {
+		return nil
+	}
+	returns := make([]float64, n)
+	for i := range returns {
+		returns[i] = closes[i+1]/closes[i] - 1
+	}
+	return returns
+}
+
+// EqualWeightStrategy splits the portfolio evenly across the universe
+type EqualWeightStrategy struct{}
+
+func (s *EqualWeightStrategy) Name() string {
+	return "equal_weight"
+}
+
+func (s *EqualWeightStrategy) Init(history map[string][]data.StockData) error {
+	return nil
+}
+
+// Weights gives every stock with a bar on day the same weight
+func (s *EqualWeightStrategy) Weights(day data.MarketDay) map[string]float64 {
+	weights := make(map[string]float64, len(day.Bars))
+	for _, bar := range day.Bars {
+		weights[bar.Symbol] = 1 / float64(len(day.Bars))
+	}
+	return weights
+}
+
+// InverseVolStrategy weights stocks by the inverse of their return standard deviation
+type InverseVolStrategy struct {
+	lookback int
+	history  *barHistory
+}
+
+func (s *InverseVolStrategy) Name() string {
+	return "inverse_vol"
+}
+
+func (s *InverseVolStrategy) Init(history map[string][]data.StockData) error {
+	s.history = newBarHistory(history)
+	return nil
+}
+
+// Weights skips stocks without lookback bars of history or with flat prices
+func (s *InverseVolStrategy) Weights(day data.MarketDay) map[string]float64 {
+	weights := make(map[string]float64)
+	total := 0.0
+	for _, bar := range day.Bars {
+		returns := s.history.returns(bar, s.lookback)
+		if returns == nil {
+			continue
+		}
+		volatility := math.Sqrt(covariance(returns, returns))
+		if volatility == 0 {
+			continue
+		}
+		weights[bar.Symbol] = 1 / volatility
+		total += 1 / volatility
+	}
+	for symbol := range weights {
+		weights[symbol] /= total
+	}
+	return weights
+}
+
+// MinVarianceStrategy holds the long-only portfolio with the lowest estimated variance
+type MinVarianceStrategy struct {
+	lookback  int
+	shrinkage float64
+	history   *barHistory
+}
+
+func (s *MinVarianceStrategy) Name() string {
+	return "min_variance"
+}
+
+func (s *MinVarianceStrategy) Init(history map[string][]data.StockData) error {
+	s.history = newBarHistory(history)
+	return nil
+}
+
+// Weights solves for the minimum variance weights, Σ⁻¹1 / 1ᵀΣ⁻¹1, on the shrunk covariance Σ.
+// Stocks that come out with a non-positive weight are dropped and the rest solved again,
+// until every weight is positive.
+func (s *MinVarianceStrategy) Weights(day data.MarketDay) map[string]float64 {
+	var symbols []string
+	var returns [][]float64
+	for _, bar := range day.Bars {
+		r := s.history.returns(bar, s.lookback)
+		if r == nil || covariance(r, r) == 0 {
+			continue
+		}
+		symbols = append(symbols, bar.Symbol)
+		returns = append(returns, r)
+	}
+
+	for len(symbols) > 0 {
+		n := len(symbols)
+		sigma := make([][]float64, n)
+		for i := range sigma {
+			sigma[i] = make([]float64, n)
+			for j := range sigma[i] {
+				sigma[i][j] = covariance(returns[i], returns[j])
+				if i != j {
+					sigma[i][j] *= 1 - s.shrinkage
+				}
+			}
+		}
+		ones := make([]float64, n)
+		for i := range ones {
+			ones[i] = 1
+		}
+
+		x, err := solveLinear(sigma, ones)
+		if err != nil {
+			return nil
+		}
+		total := 0.0
+		for _, v := range x {
+			total += v
+		}
+
+		var keptSymbols []string
+		var keptReturns [][]float64
+		for i, v := range x {
+			if v/total > 0 {
+				keptSymbols = append(keptSymbols, symbols[i])
+				keptReturns = append(keptReturns, returns[i])
+			}
+		}
+		if len(keptSymbols) == n {
+			weights := make(map[string]float64, n)
+			for i, symbol := range symbols {
+				weights[symbol] = x[i] / total
+			}
+			return weights
+		}
+		symbols, returns = keptSymbols, keptReturns
+	}
+	return nil
+}
+
+// MomentumStrategy holds the top N stocks by trailing return at equal weight
+type MomentumStrategy struct {
+	lookback int
+	skip     int
+	topN     int
+	history  *barHistory
+}
+
+func (s *MomentumStrategy) Name() string {
+	return "momentum_top_n"
+}
+
+func (s *MomentumStrategy) Init(history map[string][]data.StockData) error {
+	s.history = newBarHistory(history)
+	return nil
+}
+
+// Weights ranks stocks by the return from lookback+skip bars ago to skip bars ago
+func (s *MomentumStrategy) Weights(day data.MarketDay) map[string]float64 {
+	type ranked struct {
+		symbol   string
+		momentum float64
+	}
+	var candidates []ranked
+	for _, bar := range day.Bars {
+		closes := s.history.closes(bar, s.lookback+s.skip)
+		if closes == nil {
+			continue
+		}
+		candidates = append(candidates, ranked{bar.Symbol, closes[s.lookback]/closes[0] - 1})
+	}
+	// Stable so ties keep universe order
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].momentum > candidates[j].momentum
+	})
+	if len(candidates) > s.topN {
+		candidates = candidates[:s.topN]
+	}
+
+	weights := make(map[string]float64, len(candidates))
+	for _, candidate := range candidates {
+		weights[candidate.symbol] = 1 / float64(len(candidates))
+	}
+	return weights
+}
+
+// covariance is the sample covariance of two equally long return series
+func covariance(a, b []float64) float64 {
+	if len(a) < 2 {
+		return 0
+	}
+	meanA, meanB := 0.0, 0.0
+	for i := range a {
+		meanA += a[i]
+		meanB += b[i]
+	}
+	meanA /= float64(len(a))
+	meanB /= float64(len(b))
+
+	sum := 0.0
+	for i := range a {
+		sum += (a[i] - meanA) * (b[i] - meanB)
+	}
+	return sum / float64(len(a)-1)
+}
+
+// solveLinear solves a·x = b by Gaussian elimination with partial pivoting. a and b are not modified.
+func solveLinear(a [][]float64, b []float64) ([]float64, error) {
+	n := len(b)
+	m := make([][]float64, n)
+	for i := range m {
+		m[i] = append(append(make([]float64, 0, n+1), a[i]...), b[i])
+	}
+
+	for col := 0; col < n; col++ {
+		pivot := col
+		for row := col + 1; row < n; row++ {
+			if math.Abs(m[row][col]) > math.Abs(m[pivot][col]) {
+				pivot = row
+			}
+		}
+		if math.Abs(m[pivot][col]) < 1e-18 {
+			return nil, fmt.Errorf("singular matrix")
+		}
+		m[col], m[pivot] = m[pivot], m[col]
+
+		for row := col + 1; row < n; row++ {
+			factor := m[row][col] / m[col][col]
+			for k := col; k <= n; k++ {
+				m[row][k] -= factor * m[col][k]
+			}
+		}
+	}
+
+	x := make([]float64, n)
+	for row := n - 1; row >= 0; row-- {
+		sum := m[row][n]
+		for k := row + 1; k < n; k++ {
+			sum -= m[row][k] * x[k]
+		}
+		x[row] = sum / m[row][row]
+	}
+	return x, nil
+}
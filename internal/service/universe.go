@@ -0,0 +1,267 @@
+package service
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Paaaark/hanquant/internal/data"
+)
+
+const (
+	maxUniverseSize = 200
+	// Whole markets and point-in-time universes, which also count stocks delisted during the
+	// backtest, run to a few thousand codes
+	maxMarketUniverseSize = 5000
+)
+
+var (
+	listingsOnce sync.Once
+	listings     []data.StockMeta
+	listingsErr  error
+
+	listingHistoryOnce sync.Once
+	listingHistory     []data.ListingRecord
+	listingHistoryErr  error
+)
+
+// marketCodes maps market names to the Market column of the listings
+var marketCodes = map[string]string{
+	"KOSPI":  "1",
+	"KOSDAQ": "2",
+}
+
+// loadListings reads the stock listings CSV once and caches it for the process lifetime
+func loadListings() ([]data.StockMeta, error) {
+	listingsOnce.Do(func() {
+		listings, listingsErr = data.LoadStockListings(data.StockListingsPath())
+	})
+	return listings, listingsErr
+}
+
+// loadListingHistory reads the listing history CSV once and caches it for the process lifetime
+func loadListingHistory() ([]data.ListingRecord, error) {
+	listingHistoryOnce.Do(func() {
+		listingHistory, listingHistoryErr = data.LoadListingHistory(data.ListingHistoryPath())
+	})
+	return listingHistory, listingHistoryErr
+}
+
+// ListedStocks returns the common stocks listed on date (YYYYMMDD), including ones delisted
+// since, optionally only those of market ("KOSPI" or "KOSDAQ")
+func ListedStocks(market, date string) ([]data.ListingRecord, error) {
+	code := ""
+	if market != "" {
+		var exists bool
+		if code, exists = marketCodes[strings.ToUpper(market)]; !exists {
+			return nil, fmt.Errorf("unknown market %q: use KOSPI or KOSDAQ", market)
+		}
+	}
+	if _, err := time.Parse("20060102", date); err != nil {
+		return nil, fmt.Errorf("invalid date %q: use YYYYMMDD", date)
+	}
+
+	history, err := loadListingHistory()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load listing history: %w", err)
+	}
+	var stocks []data.ListingRecord
+	for _, record := range data.ListedBetween(history, date, date) {
+		if record.SecurityType == "ST" && (code == "" || record.Market == code) {
+			stocks = append(stocks, record)
+		}
+	}
+	return stocks, nil
+}
+
+// validateUniverse checks that at most one selector is set and that it is well-formed
+func validateUniverse(spec data.UniverseSpec) error {
+	selectors := 0
+	if len(spec.Tickers) > 0 {
+		selectors++
+	}
+	if spec.Sector != "" {
+		selectors++
+	}
+	if spec.TopN != 0 {
+		selectors++
+	}
+	if selectors > 1 {
+		return fmt.Errorf("universe accepts only one of tickers, sector or top_n")
+	}
+
+	if len(spec.Tickers) > maxUniverseSize {
+		return fmt.Errorf("universe cannot have more than %d tickers", maxUniverseSize)
+	}
+	for _, ticker := range spec.Tickers {
+		if len(strings.TrimSpace(ticker)) != 6 {
+			return fmt.Errorf("invalid ticker %q: stock codes have 6 characters", ticker)
+		}
+	}
+	if spec.TopN < 0 || spec.TopN > maxUniverseSize {
+		return fmt.Errorf("top_n must be between 1 and %d", maxUniverseSize)
+	}
+
+	if _, exists := marketCodes[strings.ToUpper(spec.Market)]; spec.Market != "" && !exists {
+		return fmt.Errorf("unknown market %q: use KOSPI or KOSDAQ", spec.Market)
+	}
+	if len(spec.Tickers) > 0 && (spec.Market != "" || spec.PointInTime) {
+		return fmt.Errorf("market and point_in_time do not apply to explicit tickers")
+	}
+	if spec.PointInTime && spec.TopN != 0 {
+		return fmt.Errorf("top_n ranks by today's market cap and cannot be point_in_time")
+	}
+	if spec.PointInTime && spec.Sector == "" && spec.Market == "" {
+		return fmt.Errorf("point_in_time needs a sector or a market")
+	}
+	return nil
+}
+
+// resolveUniverse turns a universe spec into a list of stock codes. Point-in-time universes
+// take every stock listed at some point between from and to (YYYYMMDD).
+func (s *BacktestService) resolveUniverse(spec data.UniverseSpec, from, to string) ([]string, error) {
+	if len(spec.Tickers) > 0 {
+		return dedupeTickers(spec.Tickers), nil
+	}
+	if spec.Sector == "" && spec.TopN == 0 && spec.Market == "" {
+		return s.universe, nil
+	}
+
+	rows, err := universeListings(spec, from, to)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case spec.Sector != "":
+		limit := maxUniverseSize
+		if spec.PointInTime {
+			limit = maxMarketUniverseSize
+		}
+		return sectorUniverse(rows, spec.Sector, limit)
+	case spec.TopN > 0:
+		return topMarketCapUniverse(rows, spec.TopN)
+	default:
+		return marketUniverse(rows, spec.Market)
+	}
+}
+
+// universeListings returns the listings a spec selects from: today's, or those of the listing
+// history during the backtest, narrowed to spec.Market
+func universeListings(spec data.UniverseSpec, from, to string) ([]data.StockMeta, error) {
+	var rows []data.StockMeta
+	if spec.PointInTime {
+		history, err := loadListingHistory()
+		if err != nil {
+			return nil, fmt.Errorf("failed to load listing history: %w", err)
+		}
+		for _, record := range data.ListedBetween(history, from, to) {
+			rows = append(rows, record.StockMeta)
+		}
+	} else {
+		var err error
+		rows, err = loadListings()
+		if err != nil {
+			return nil, fmt.Errorf("failed to load stock listings: %w", err)
+		}
+	}
+
+	if spec.Market == "" {
+		return rows, nil
+	}
+	code := marketCodes[strings.ToUpper(spec.Market)]
+	var filtered []data.StockMeta
+	for _, row := range rows {
+		if row.Market == code {
+			filtered = append(filtered, row)
+		}
+	}
+	return filtered, nil
+}
+
+// marketUniverse returns every common stock of rows, which are already narrowed to market
+func marketUniverse(rows []data.StockMeta, market string) ([]string, error) {
+	var tickers []string
+	for _, row := range rows {
+		if row.SecurityType == "ST" {
+			tickers = append(tickers, row.Code)
+		}
+	}
+
+	if len(tickers) == 0 {
+		return nil, fmt.Errorf("no common stocks found for market %q", market)
+	}
+	if len(tickers) > maxMarketUniverseSize {
+		return nil, fmt.Errorf("market %q has %d stocks, more than the limit of %d", market, len(tickers), maxMarketUniverseSize)
+	}
+	return tickers, nil
+}
+
+// sectorUniverse returns the common stocks whose IndLarge code matches sector, at most limit of them
+func sectorUniverse(rows []data.StockMeta, sector string, limit int) ([]string, error) {
+	want := normalizeIndustryCode(sector)
+	var tickers []string
+	for _, row := range rows {
+		if row.SecurityType == "ST" && normalizeIndustryCode(row.IndLarge) == want {
+			tickers = append(tickers, row.Code)
+		}
+	}
+
+	if len(tickers) == 0 {
+		return nil, fmt.Errorf("no common stocks found for sector %q", sector)
+	}
+	if len(tickers) > limit {
+		return nil, fmt.Errorf("sector %q has %d stocks, more than the limit of %d", sector, len(tickers), limit)
+	}
+	return tickers, nil
+}
+
+// topMarketCapUniverse returns the n largest common stocks by listed market cap
+func topMarketCapUniverse(rows []data.StockMeta, n int) ([]string, error) {
+	var candidates []data.StockMeta
+	for _, row := range rows {
+		if row.SecurityType == "ST" && row.MarketCap > 0 {
+			candidates = append(candidates, row)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("stock listings have no market cap data; re-run convert_stock_listings")
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].MarketCap > candidates[j].MarketCap
+	})
+	if n > len(candidates) {
+		n = len(candidates)
+	}
+
+	tickers := make([]string, n)
+	for i := 0; i < n; i++ {
+		tickers[i] = candidates[i].Code
+	}
+	return tickers, nil
+}
+
+// normalizeIndustryCode strips zero padding so "0027" and "27" compare equal
+func normalizeIndustryCode(code string) string {
+	trimmed := strings.TrimLeft(strings.TrimSpace(code), "0")
+	if trimmed == "" {
+		return "0"
+	}
+	return trimmed
+}
+
+func dedupeTickers(tickers []string) []string {
+	seen := make(map[string]bool, len(tickers))
+	result := make([]string, 0, len(tickers))
+	for _, ticker := range tickers {
+		ticker = strings.TrimSpace(ticker)
+		if ticker == "" || seen[ticker] {
+			continue
+		}
+		seen[ticker] = true
+		result = append(result, ticker)
+	}
+	return result
+}
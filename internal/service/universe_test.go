@@ -0,0 +1,61 @@
+package service
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/Paaaark/hanquant/internal/data"
+)
+
+func TestResolvePointInTimeMarket(t *testing.T) {
+	// More KOSDAQ stocks than a ticker or sector universe may hold
+	var kosdaq []data.StockMeta
+	for i := 0; i < 2*maxUniverseSize; i++ {
+		kosdaq = append(kosdaq, data.StockMeta{Code: fmt.Sprintf("1%05d", i), SecurityType: "ST", Market: "2"})
+	}
+	delisted := data.StockMeta{Code: "900001", SecurityType: "ST", Market: "2"}
+	listedLater := data.StockMeta{Code: "900002", SecurityType: "ST", Market: "2"}
+	kospi := data.StockMeta{Code: "005930", SecurityType: "ST", Market: "1"}
+	etf := data.StockMeta{Code: "069500", SecurityType: "EF", Market: "2"}
+
+	var history []data.ListingRecord
+	history = data.MergeListingSnapshot(history, "20200102", append([]data.StockMeta{delisted, kospi, etf}, kosdaq...))
+	history = data.MergeListingSnapshot(history, "20200701", append([]data.StockMeta{delisted, kospi, etf}, kosdaq...))
+	history = data.MergeListingSnapshot(history, "20210104", append([]data.StockMeta{listedLater, kospi, etf}, kosdaq...))
+
+	path := filepath.Join(t.TempDir(), "listing_history.csv")
+	if err := data.WriteListingHistory(history, path); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("LISTING_HISTORY_CSV", path)
+	listingHistoryOnce = sync.Once{}
+	t.Cleanup(func() { listingHistoryOnce = sync.Once{} })
+
+	spec := data.UniverseSpec{Market: "KOSDAQ", PointInTime: true}
+	if err := validateUniverse(spec); err != nil {
+		t.Fatalf("validateUniverse: %v", err)
+	}
+	s := &BacktestService{}
+	tickers, err := s.resolveUniverse(spec, "20200601", "20200601")
+	if err != nil {
+		t.Fatalf("resolveUniverse: %v", err)
+	}
+
+	if len(tickers) != len(kosdaq)+1 {
+		t.Errorf("resolved %d stocks, want the %d KOSDAQ stocks and the delisted one", len(tickers), len(kosdaq)+1)
+	}
+	found := make(map[string]bool, len(tickers))
+	for _, ticker := range tickers {
+		found[ticker] = true
+	}
+	if !found[delisted.Code] {
+		t.Errorf("universe misses %s, listed on the date and delisted since", delisted.Code)
+	}
+	for _, code := range []string{listedLater.Code, kospi.Code, etf.Code} {
+		if found[code] {
+			t.Errorf("universe has %s, which is not a KOSDAQ common stock listed on the date", code)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Paaaark/hanquant/internal/data"
+)
+
+const (
+	defaultInSampleDays  = 252 // one year of trading days
+	defaultOutSampleDays = 63  // one quarter
+	maxWalkForwardFolds  = 60
+)
+
+// walkForwardWindow is the trading-day span of one fold, inclusive, as YYYYMMDD
+type walkForwardWindow struct {
+	inSampleFrom, inSampleTo   string
+	outSampleFrom, outSampleTo string
+}
+
+// WalkForward optimizes the grid on each in-sample window and trades the winning parameters on
+// the following out-of-sample window. The out-of-sample runs are chained: each starts flat with
+// the previous one's final portfolio value in cash, so open positions are marked to market at
+// fold boundaries without exit costs.
+func (s *BacktestService) WalkForward(params data.WalkForwardParams) (*data.WalkForwardResult, error) {
+	if params.Mode == "" {
+		params.Mode = "rolling"
+	}
+	if params.Mode != "rolling" && params.Mode != "anchored" {
+		return nil, fmt.Errorf("unknown walk-forward mode: %q", params.Mode)
+	}
+	if params.InSampleDays == 0 {
+		params.InSampleDays = defaultInSampleDays
+	}
+	if params.OutSampleDays == 0 {
+		params.OutSampleDays = defaultOutSampleDays
+	}
+	if params.InSampleDays < 20 {
+		return nil, fmt.Errorf("in_sample_days must be at least 20")
+	}
+	if params.OutSampleDays < 5 {
+		return nil, fmt.Errorf("out_sample_days must be at least 5")
+	}
+
+	search, err := newGridSearch(&params.OptimizeParams)
+	if err != nil {
+		return nil, err
+	}
+
+	prepared, err := s.prepareBacktest(context.Background(), params.BacktestParams, nil)
+	if err != nil {
+		return nil, err
+	}
+	params.BacktestParams = prepared.params
+
+	tradingDays, err := data.TradingDaysInRange(params.From, params.To)
+	if err != nil {
+		return nil, err
+	}
+	// Backtests trade strictly between From and To
+	if len(tradingDays) > 0 && tradingDays[0] == params.From {
+		tradingDays = tradingDays[1:]
+	}
+	if len(tradingDays) > 0 && tradingDays[len(tradingDays)-1] == params.To {
+		tradingDays = tradingDays[:len(tradingDays)-1]
+	}
+
+	windows := walkForwardWindows(tradingDays, params.Mode, params.InSampleDays, params.OutSampleDays)
+	if len(windows) == 0 {
+		return nil, fmt.Errorf("%d trading days between %s and %s are not enough for %d in-sample and %d out-of-sample days",
+			len(tradingDays), params.From, params.To, params.InSampleDays, params.OutSampleDays)
+	}
+	if len(windows) > maxWalkForwardFolds {
+		return nil, fmt.Errorf("walk-forward would run %d folds, more than the limit of %d", len(windows), maxWalkForwardFolds)
+	}
+
+	result := &data.WalkForwardResult{
+		Params:   params,
+		Universe: prepared.universe,
+	}
+	cash := params.InitialCash
+	var interestIncome, marginInterest float64 // summed over the out-of-sample folds
+	for i, window := range windows {
+		fold := data.WalkForwardFold{
+			Fold:          i + 1,
+			InSampleFrom:  window.inSampleFrom,
+			InSampleTo:    window.inSampleTo,
+			OutSampleFrom: window.outSampleFrom,
+			OutSampleTo:   window.outSampleTo,
+		}
+
+		// Pick the best parameters in-sample
+		ranked := rankRuns(search.run(s, prepared.window(window.inSampleFrom, window.inSampleTo)), search.lowerBetter)
+		if len(ranked) == 0 || ranked[0].Error != "" {
+			fold.Error = "no grid combination could run in-sample"
+			if len(ranked) > 0 {
+				fold.Error += ": " + ranked[0].Error
+			}
+			result.Folds = append(result.Folds, fold)
+			continue
+		}
+		best := ranked[0]
+		fold.StrategyParams = best.StrategyParams
+		fold.InSampleScore = best.Score
+		fold.InSampleMetrics = best.Metrics
+
+		// Trade them on the following out-of-sample window
+		strategy, _, err := NewStrategy(search.strategy, best.StrategyParams)
+		if err != nil {
+			return nil, err
+		}
+		outParams := prepared.params
+		outParams.StrategyParams = best.StrategyParams
+		outParams.InitialCash = cash
+		outSample, err := s.simulate(prepared.window(window.outSampleFrom, window.outSampleTo), outParams, strategy)
+		if err != nil {
+			return nil, fmt.Errorf("fold %d out-of-sample: %w", fold.Fold, err)
+		}
+		fold.OutSampleMetrics = outSample.Metrics
+		fold.OutSampleMetrics.Risk.MonthlyReturns = nil
+		fold.OutSampleMetrics.Risk.YearlyReturns = nil
+
+		result.PortfolioHistory = append(result.PortfolioHistory, outSample.PortfolioHistory...)
+		result.Trades = append(result.Trades, outSample.Trades...)
+		// Round trips are matched per fold since positions do not carry across folds
+		result.RoundTrips = append(result.RoundTrips, outSample.RoundTrips...)
+		interestIncome += outSample.Metrics.InterestIncome
+		marginInterest += outSample.Metrics.MarginInterest
+		if n := len(outSample.PortfolioHistory); n > 0 {
+			cash = outSample.PortfolioHistory[n-1].Portfolio.Total
+		}
+		result.Folds = append(result.Folds, fold)
+	}
+
+	result.Metrics = s.calculateMetrics(result.PortfolioHistory, result.Trades, result.RoundTrips, params.RiskFreeRate)
+	result.Metrics.InterestIncome = interestIncome
+	result.Metrics.MarginInterest = marginInterest
+	if prepared.benchmark != nil {
+		result.Benchmark = s.buildBenchmarkComparison(result.PortfolioHistory, prepared.benchmark, params.RiskFreeRate)
+	}
+	result.EquityCurve = buildEquityCurve(result.PortfolioHistory)
+	result.PortfolioHistory = compactHistory(result.PortfolioHistory, prepared.params.Snapshots)
+	return result, nil
+}
+
+// walkForwardWindows lays out the folds over the trading days. Rolling folds keep the in-sample
+// length fixed and slide by the out-of-sample length; anchored folds always start in-sample at
+// the first day. The last out-of-sample window may be shorter than outSample.
+func walkForwardWindows(days []string, mode string, inSample, outSample int) []walkForwardWindow {
+	var windows []walkForwardWindow
+	for start := 0; start+inSample < len(days); start += outSample {
+		inFrom := start
+		if mode == "anchored" {
+			inFrom = 0
+		}
+		outFrom := start + inSample
+		outTo := outFrom + outSample - 1
+		if outTo >= len(days) {
+			outTo = len(days) - 1
+		}
+		windows = append(windows, walkForwardWindow{
+			inSampleFrom:  days[inFrom],
+			inSampleTo:    days[outFrom-1],
+			outSampleFrom: days[outFrom],
+			outSampleTo:   days[outTo],
+		})
+	}
+	return windows
+}
+
+// window restricts prepared to the trading days between from and to (YYYYMMDD, inclusive).
+// The full history stays available to strategies for indicator warm-up.
+func (p *preparedBacktest) window(from, to string) *preparedBacktest {
+	windowed := *p
+	windowed.benchmark = nil
+	windowed.days = nil
+	for _, day := range p.days {
+		key := day.Date.Format("20060102")
+		if key >= from && key <= to {
+			windowed.days = append(windowed.days, day)
+		}
+	}
+	// A window starts invested like a full backtest does
+	if len(windowed.days) > 0 && p.params.Rebalance.Frequency != "" {
+		windowed.days[0].Rebalance = true
+	}
+	return &windowed
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/Paaaark/hanquant/internal/data"
@@ -12,12 +13,17 @@ import (
 type WebSocketService struct {
 	kisClient *data.KISClient
 	Hub       *data.Hub
+
+	liveMu sync.Mutex
+	live   map[*data.WSClient]*liveIndicators
 }
 
 func NewWebSocketService(kisClient *data.KISClient) *WebSocketService {
 	return &WebSocketService{
-		kisClient: kisClient,
+		// Polling yields to user requests on the same app key
+		kisClient: kisClient.WithPriority(data.PriorityStreaming),
 		Hub:       data.NewHub(),
+		live:      make(map[*data.WSClient]*liveIndicators),
 	}
 }
 
@@ -34,6 +40,12 @@ func (s *WebSocketService) HandleMessage(client *data.WSClient, msg []byte) {
 	}
 	switch wsMsg.Type {
 	case "subscribe":
+		if wsMsg.Indicators != "" {
+			if err := s.setIndicators(client, wsMsg.Indicators); err != nil {
+				s.sendError(client, err.Error())
+				return
+			}
+		}
 		client.Mu.Lock()
 		for _, t := range wsMsg.Tickers {
 			if len(client.Tickers) < 30 {
@@ -49,6 +61,7 @@ func (s *WebSocketService) HandleMessage(client *data.WSClient, msg []byte) {
 			delete(client.Tickers, t)
 		}
 		client.Mu.Unlock()
+		s.dropIndicators(client, wsMsg.Tickers)
 		// Send immediate snapshot
 		s.sendSnapshot(client)
 	default:
@@ -90,6 +103,7 @@ func (s *WebSocketService) sendSnapshot(client *data.WSClient) {
 	buf.Write(snaps.EncodeJSON())
 	buf.WriteByte('}')
 	client.Send <- buf.Bytes()
+	s.publishIndicators(client, snaps)
 }
 
 func (s *WebSocketService) periodicUpdates() {
@@ -110,6 +124,7 @@ func (s *WebSocketService) broadcastAll() {
 		clients = append(clients, c)
 	}
 	s.Hub.Mu.Unlock()
+	s.pruneIndicators()
 	for _, client := range clients {
 		client.Mu.Lock()
 		tickers := make([]string, 0, len(client.Tickers))
@@ -135,6 +150,7 @@ func (s *WebSocketService) broadcastAll() {
 		buf.Write(snaps.EncodeJSON())
 		buf.WriteByte('}')
 		client.Send <- buf.Bytes()
+		s.publishIndicators(client, snaps)
 	}
 }
 
@@ -0,0 +1,134 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/Paaaark/hanquant/internal/data"
+	"github.com/Paaaark/hanquant/internal/indicators"
+)
+
+// liveIndicators holds the indicator streams of one WebSocket client. Every polled snapshot is
+// fed to them as a bar, so periods count polls (about one a second while the market is open),
+// not days.
+type liveIndicators struct {
+	specs   []indicators.Spec
+	streams map[string][]indicators.Indicator // by ticker, in the order of specs
+	volume  map[string]int64                  // accumulated volume of the ticker's last snapshot
+}
+
+// setIndicators replaces the indicators client streams with the specs of list, e.g. "rsi:14,ema:20".
+// Streams start over, warming up again from the next snapshot.
+func (s *WebSocketService) setIndicators(client *data.WSClient, list string) error {
+	specs, err := indicators.ParseSpecs(list)
+	if err != nil {
+		return err
+	}
+	if len(specs) > maxIndicatorSpecs {
+		return fmt.Errorf("at most %d indicators per connection", maxIndicatorSpecs)
+	}
+
+	s.liveMu.Lock()
+	s.live[client] = &liveIndicators{
+		specs:   specs,
+		streams: make(map[string][]indicators.Indicator),
+		volume:  make(map[string]int64),
+	}
+	s.liveMu.Unlock()
+	return nil
+}
+
+// dropIndicators forgets the streams of tickers the client unsubscribed from
+func (s *WebSocketService) dropIndicators(client *data.WSClient, tickers []string) {
+	s.liveMu.Lock()
+	defer s.liveMu.Unlock()
+	live := s.live[client]
+	if live == nil {
+		return
+	}
+	for _, ticker := range tickers {
+		delete(live.streams, ticker)
+		delete(live.volume, ticker)
+	}
+}
+
+// pruneIndicators forgets the streams of clients that are no longer connected
+func (s *WebSocketService) pruneIndicators() {
+	s.Hub.Mu.Lock()
+	defer s.Hub.Mu.Unlock()
+	s.liveMu.Lock()
+	defer s.liveMu.Unlock()
+	for client := range s.live {
+		if !s.Hub.Clients[client] {
+			delete(s.live, client)
+		}
+	}
+}
+
+// publishIndicators feeds snaps to the client's indicator streams and sends their new values
+func (s *WebSocketService) publishIndicators(client *data.WSClient, snaps data.SliceStockSnapshot) {
+	s.liveMu.Lock()
+	live := s.live[client]
+	if live == nil {
+		s.liveMu.Unlock()
+		return
+	}
+	updates := live.update(snaps, time.Now())
+	s.liveMu.Unlock()
+	if len(updates) == 0 {
+		return
+	}
+
+	resp, _ := json.Marshal(data.WSMessage{
+		Type: "indicators",
+		Data: updates,
+	})
+	client.Send <- resp
+}
+
+// update feeds one bar per snapshot and returns the values of every stream afterwards
+func (l *liveIndicators) update(snaps data.SliceStockSnapshot, now time.Time) []data.LiveIndicators {
+	var updates []data.LiveIndicators
+	for _, snap := range snaps {
+		price, err := strconv.ParseFloat(snap.Price, 64)
+		if err != nil || price <= 0 {
+			continue
+		}
+
+		// The snapshot volume accumulates over the day; a bar gets what traded since the last one
+		accumulated, _ := strconv.ParseInt(snap.Volume, 10, 64)
+		previous, seen := l.volume[snap.Code]
+		volume := accumulated - previous
+		if !seen {
+			volume = 0
+		} else if volume < 0 {
+			volume = accumulated // a new session started
+		}
+		l.volume[snap.Code] = accumulated
+
+		streams, exists := l.streams[snap.Code]
+		if !exists {
+			streams = make([]indicators.Indicator, len(l.specs))
+			for i, spec := range l.specs {
+				streams[i] = spec.New()
+			}
+			l.streams[snap.Code] = streams
+		}
+
+		bar := data.StockData{Symbol: snap.Code, Date: now, Open: price, High: price, Low: price, Close: price, Volume: volume}
+		update := data.LiveIndicators{Code: snap.Code, Price: price, Values: make(map[string]map[string]*float64, len(streams))}
+		for i, stream := range streams {
+			stream.Update(bar)
+			names := stream.Outputs()
+			values := make(map[string]*float64, len(names))
+			for j, value := range stream.Values() {
+				values[names[j]] = nullableFloat(value)
+			}
+			update.Values[l.specs[i].Key()] = values
+		}
+		updates = append(updates, update)
+	}
+	return updates
+}
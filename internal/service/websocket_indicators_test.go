@@ -0,0 +1,57 @@
+package service
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/Paaaark/hanquant/internal/data"
+	"github.com/Paaaark/hanquant/internal/indicators"
+)
+
+func TestLiveIndicatorsUpdate(t *testing.T) {
+	specs, err := indicators.ParseSpecs("sma:3,obv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	live := &liveIndicators{
+		specs:   specs,
+		streams: make(map[string][]indicators.Indicator),
+		volume:  make(map[string]int64),
+	}
+
+	// Accumulated volume drops on the last poll, as it does when a new session starts
+	prices := []string{"100", "103", "101", "106", "104"}
+	volumes := []string{"1000", "1500", "1700", "2600", "300"}
+	// The first poll has no earlier volume to subtract from
+	want := []data.StockData{
+		{Close: 100, Volume: 0},
+		{Close: 103, Volume: 500},
+		{Close: 101, Volume: 200},
+		{Close: 106, Volume: 900},
+		{Close: 104, Volume: 300},
+	}
+	wantSMA := indicators.SMA(want, 3)
+	wantOBV := indicators.OBV(want)
+
+	start := time.Date(2024, 1, 2, 9, 0, 0, 0, time.UTC)
+	for i := range prices {
+		snaps := data.SliceStockSnapshot{
+			{Code: "005930", Price: prices[i], Volume: volumes[i]},
+			{Code: "000660", Price: ""}, // no quote yet
+		}
+		updates := live.update(snaps, start.Add(time.Duration(i)*time.Second))
+		if len(updates) != 1 || updates[0].Code != "005930" || updates[0].Price != want[i].Close {
+			t.Fatalf("poll %d: updates = %+v, want one for 005930 at %v", i, updates, want[i].Close)
+		}
+
+		sma := updates[0].Values["sma_3"]["sma"]
+		if math.IsNaN(wantSMA[i]) != (sma == nil) || (sma != nil && math.Abs(*sma-wantSMA[i]) > 1e-9) {
+			t.Errorf("poll %d: sma_3 = %v, want %v", i, sma, wantSMA[i])
+		}
+		obv := updates[0].Values["obv"]["obv"]
+		if obv == nil || math.Abs(*obv-wantOBV[i]) > 1e-9 {
+			t.Errorf("poll %d: obv = %v, want %v", i, obv, wantOBV[i])
+		}
+	}
+}